@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"printprotocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// clientKeyFile holds the private key this client enrolled with. Losing it
+// means enrolling again, so it is never regenerated while it can be read.
+const clientKeyFile = "data/client_key.json"
+
+// handshakeTimeout bounds the wait for each server reply during
+// authentication
+const handshakeTimeout = 15 * time.Second
+
+// enrollmentRetryInterval is how long to wait before asking again while the
+// enrollment is not approved
+const enrollmentRetryInterval = 30 * time.Second
+
+type clientKeyData struct {
+	PrivateKey string `json:"private_key"` // base64 Ed25519 seed
+}
+
+// enrollmentError is returned when the server will not accept the client's
+// key yet, or at all
+type enrollmentError struct {
+	Status      string
+	Fingerprint string
+	Message     string
+}
+
+func (e *enrollmentError) Error() string {
+	return fmt.Sprintf("enrollment %s: %s", e.Status, e.Message)
+}
+
+// loadOrCreateClientKey reads the client key, generating and saving a new
+// one on first start
+func loadOrCreateClientKey() (ed25519.PrivateKey, error) {
+	var data clientKeyData
+	err := loadJSONFromFile(clientKeyFile, &data)
+	if err == nil {
+		seed, err := base64.StdEncoding.DecodeString(data.PrivateKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("client key file %s is corrupt", clientKeyFile)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client key: %w", err)
+	}
+	file, err := json.MarshalIndent(clientKeyData{PrivateKey: base64.StdEncoding.EncodeToString(key.Seed())}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal client key: %w", err)
+	}
+	if err := os.WriteFile(clientKeyFile, file, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save client key: %w", err)
+	}
+	return key, nil
+}
+
+// publicKeyString returns the public half of key as sent to the server
+func publicKeyString(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// keyFingerprint returns the hex SHA-256 of the public key, the value an
+// admin compares before approving the client
+func keyFingerprint(key ed25519.PrivateKey) string {
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateSession sends the auth message on a new connection and signs
+// the server's nonce. It returns an *enrollmentError when the key is not
+// approved.
+func authenticateSession(c *websocket.Conn, authMessage *printprotocol.Auth, key ed25519.PrivateKey) error {
+	if err := c.WriteJSON(authMessage); err != nil {
+		return fmt.Errorf("failed to send auth message: %w", err)
+	}
+	defer c.SetReadDeadline(time.Time{})
+
+	for {
+		c.SetReadDeadline(time.Now().Add(handshakeTimeout))
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("no reply to authentication: %w", err)
+		}
+		msgType, err := printprotocol.PeekType(data)
+		if err != nil {
+			return err
+		}
+
+		switch msgType {
+		case printprotocol.TypeChallenge:
+			var challenge printprotocol.Challenge
+			if err := json.Unmarshal(data, &challenge); err != nil {
+				return fmt.Errorf("invalid challenge: %w", err)
+			}
+			signature := ed25519.Sign(key, printprotocol.ChallengePayload(authMessage.Token, challenge.Nonce))
+			if err := c.WriteJSON(printprotocol.ChallengeResponse{
+				Type:      printprotocol.TypeChallengeResponse,
+				Signature: base64.StdEncoding.EncodeToString(signature),
+			}); err != nil {
+				return fmt.Errorf("failed to send challenge response: %w", err)
+			}
+		case printprotocol.TypeAuthOK, printprotocol.TypeEnrollment:
+			var result printprotocol.AuthResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				return fmt.Errorf("invalid authentication result: %w", err)
+			}
+			if msgType == printprotocol.TypeAuthOK {
+				return nil
+			}
+			return &enrollmentError{Status: result.Status, Fingerprint: result.Fingerprint, Message: result.Message}
+		}
+	}
+}
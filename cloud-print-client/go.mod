@@ -13,6 +13,7 @@ require (
 	github.com/unidoc/unipdf/v3 v3.69.0
 	golang.org/x/exp/shiny v0.0.0-20240707233637-46b078467d37
 	golang.org/x/image v0.24.0
+	printprotocol v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -52,3 +53,5 @@ require (
 	golang.org/x/xerrors v0.0.0-20240903120638-7835f813f4da // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace printprotocol => ../print-protocol
@@ -22,6 +22,15 @@ func main() {
 		return
 	}
 
+	// The key proves this client to the server once an admin approves it
+	clientKey, err := loadOrCreateClientKey()
+	if err != nil {
+		log.Println("Client key could not be loaded:", err)
+		return
+	}
+	auth_message.PublicKey = publicKeyString(clientKey)
+	log.Println("Client key fingerprint:", keyFingerprint(clientKey))
+
 	appSettings.SetAppID(auth_message.Token)
 	weightdimensionMachineManager.SetPrinterClientID(auth_message.Token)
 
@@ -66,7 +75,7 @@ func main() {
 	<-done
 	go console.LoadMessages(w)
 	// Initiate WebSocket connection
-	go connectWebSocket(console, printManager, auth_message)
+	go connectWebSocket(console, printManager, auth_message, clientKey)
 	// Start message sender
 	go sendMessageWorker(console)
 	// go getPrintQueue(console)
@@ -28,6 +28,8 @@ import (
 
 	mathrand "math/rand"
 
+	"printprotocol"
+
 	"github.com/unidoc/unipdf/v3/model"
 	"github.com/unidoc/unipdf/v3/render"
 )
@@ -45,6 +47,7 @@ type PrintJob struct {
 	Token            string // Job token
 	Width            float64
 	Height           float64
+	PageSizes        []printprotocol.PageSize // Per page of an order, for mixed size kits
 	JobID            string
 	Event            string
 	Barcode          string
@@ -52,6 +55,26 @@ type PrintJob struct {
 	Weight           string
 }
 
+// pageSize returns the paper size in inches of page n (from 1). Kits with
+// pages of different sizes list the size of each page of an order, which
+// repeats for every order; other jobs print every page at Width x Height.
+func (job PrintJob) pageSize(n int) (float64, float64) {
+	if len(job.PageSizes) == 0 || n < 1 {
+		return job.Width, job.Height
+	}
+	size := job.PageSizes[(n-1)%len(job.PageSizes)]
+	return size.Width, size.Height
+}
+
+// pagePixels scales the render size of a Width x Height page to page n
+func (job PrintJob) pagePixels(n, widthPx, heightPx int) (int, int) {
+	width, height := job.pageSize(n)
+	if job.Width <= 0 || job.Height <= 0 {
+		return widthPx, heightPx
+	}
+	return int(float64(widthPx) * width / job.Width), int(float64(heightPx) * height / job.Height)
+}
+
 // PageResult represents a rendered page result from the producer pipeline
 type PageResult struct {
 	jobID   string // Job identifier for isolation
@@ -62,21 +85,23 @@ type PageResult struct {
 
 const (
 	// PRINT_EVENT_JOB_QUEUED is the event for a print job being queued
-	PRINT_EVENT_JOB_QUEUED = "job-queued"
+	PRINT_EVENT_JOB_QUEUED = printprotocol.EventJobQueued
 	// PRINT_EVENT_JOB_STARTED is the event for a spooling job
-	PRINT_EVENT_JOB_STARTED = "job-spooling"
+	PRINT_EVENT_JOB_STARTED = printprotocol.EventJobSpooling
 	// PRINT_EVENT_JOB_PRINTING is the event for a print job being printed
-	PRINT_EVENT_JOB_PRINTING = "job-printing"
+	PRINT_EVENT_JOB_PRINTING = printprotocol.EventJobPrinting
 	// PRINT_EVENT_JOB_RENDERING is the event for a print job being rendered
-	PRINT_EVENT_JOB_RENDERING = "job-rendering"
+	PRINT_EVENT_JOB_RENDERING = printprotocol.EventJobRendering
 	// PRINT_EVENT_JOB_COMPLETED is the event for a print job being completed
-	PRINT_EVENT_JOB_COMPLETED = "job-completed"
+	PRINT_EVENT_JOB_COMPLETED = printprotocol.EventJobCompleted
 	// PRINT_EVENT_JOB_FAILED is the event for a print job failing
-	PRINT_EVENT_JOB_FAILED     = "job-failed"
+	PRINT_EVENT_JOB_FAILED     = printprotocol.EventJobFailed
 	PRINT_EVENT_QUEUE_LENGTH   = "queue-length"
 	PRINT_EVENT_JOB_IGNORE     = "job-ignore"
-	PRINT_EVENT_JOB_PROGRESS   = "job-progress"
-	PRINT_EVENT_QUEUE_PROGRESS = "print-queue-progress"
+	PRINT_EVENT_JOB_PROGRESS   = printprotocol.EventJobProgress
+	PRINT_EVENT_QUEUE_PROGRESS = printprotocol.EventQueueProgress
+	// PRINT_EVENT_PAGES_PRINTED reports the pages the spooler has printed for a live job
+	PRINT_EVENT_PAGES_PRINTED = printprotocol.EventJobPagesPrinted
 )
 
 type PrintEvent struct {
@@ -134,6 +159,7 @@ type PrintJobMonitorRequest struct {
 	PrinterName string
 	QueueID     int
 	JobID       string
+	Command     string
 	TotalPages  int
 }
 
@@ -285,7 +311,7 @@ func (pm *PrintManager) processPrintJob(job PrintJob, console *Console) {
 			Color: colorNRGBA(255, 40, 0, 255), // Red
 		}
 		// return a json response with error message
-		outgoingMessages <- OutGoingLog{JobID: job.JobID, Event: "print-failed", Message: fmt.Sprintf("Error printing file: %v", err)}
+		outgoingMessages <- printprotocol.Event{JobID: job.JobID, Event: printprotocol.EventPrintFailed, Message: fmt.Sprintf("Error printing file: %v", err)}
 		return
 	}
 
@@ -298,7 +324,7 @@ func (pm *PrintManager) processPrintJob(job PrintJob, console *Console) {
 	// No need for additional reset - proper defer sequence ensures clean state
 
 	// Bind print queue for event tracking and start progress monitoring
-	pm.attachPrintQueueWithMonitoring(last_print_event, console, last_print_event_found, job.PrinterName, numPages)
+	pm.attachPrintQueueWithMonitoring(last_print_event, console, last_print_event_found, job.PrinterName, job.Event, numPages)
 
 	if job.Event == "live-print" || job.Event == "specimen-print" {
 		now_time := getNowTime()
@@ -410,7 +436,8 @@ func (pm *PrintManager) printWithPipeline(pdfReader *model.PdfReader, numPages i
 		}
 
 		page1Start := time.Now()
-		img, err := pm.renderPDFPageDirect(pdfReader, 1, widthPx, heightPx)
+		page1WidthPx, page1HeightPx := job.pagePixels(1, widthPx, heightPx)
+		img, err := pm.renderPDFPageDirect(pdfReader, 1, page1WidthPx, page1HeightPx)
 		page1Duration := time.Since(page1Start)
 
 		if err != nil {
@@ -655,9 +682,12 @@ func (pm *PrintManager) printPagesFromChannelWithInit(pageChan <-chan *image.RGB
 	printerNamePtr, _ := syscall.UTF16PtrFromString(job.PrinterName)
 	winspool16Ptr, _ := syscall.UTF16PtrFromString("WINSPOOL")
 
-	// Convert job dimensions from inches to 0.1mm for DEVMODE
-	paperWidthMM := int16(job.Width * 254)   // inches * 25.4 * 10
-	paperLengthMM := int16(job.Height * 254) // inches * 25.4 * 10
+	// Convert job dimensions from inches to 0.1mm for DEVMODE. The paper
+	// starts at the first page's size; kits whose pages differ in size
+	// change it between pages.
+	paperWidth, paperHeight := job.pageSize(1)
+	paperWidthMM := int16(paperWidth * 254)   // inches * 25.4 * 10
+	paperLengthMM := int16(paperHeight * 254) // inches * 25.4 * 10
 
 	// Open printer to get handle for DocumentProperties
 	var hPrinter syscall.Handle
@@ -813,7 +843,7 @@ func (pm *PrintManager) printPagesFromChannelWithInit(pageChan <-chan *image.RGB
 	}
 
 	log.Printf("📄 Creating DC with custom paper size: %.1f x %.1f inches (%dmm x %dmm), orientation: %d, duplex: %d",
-		job.Width, job.Height, paperWidthMM/10, paperLengthMM/10, devMode.Orientation, devMode.Duplex)
+		paperWidth, paperHeight, paperWidthMM/10, paperLengthMM/10, devMode.Orientation, devMode.Duplex)
 
 	// Create DC with validated DEVMODE
 	// CRITICAL: Validate devMode pointer is within buffer bounds
@@ -975,7 +1005,9 @@ func (pm *PrintManager) printPagesFromChannelWithInit(pageChan <-chan *image.RGB
 	var reusableBitmap uintptr
 	var reusableOldBitmap uintptr
 	var reusablePBits uintptr
+	var dibWidth, dibHeight int
 	dibSectionCreated := false
+	dibCleanupDeferred := false
 
 	for img := range pageChan {
 		pageNum++
@@ -1027,6 +1059,24 @@ func (pm *PrintManager) printPagesFromChannelWithInit(pageChan <-chan *image.RGB
 
 		log.Printf("Page %d: Received image %dpx x %dpx (bounds: %v)", pageNum, imgWidth, imgHeight, bounds)
 
+		// Change paper when this page differs in size from the last one.
+		// ResetDC is only allowed between pages, which is where we are.
+		if width, height := job.pageSize(pageNum); width != paperWidth || height != paperHeight {
+			devMode.PaperWidth = int16(width * 254)
+			devMode.PaperLength = int16(height * 254)
+			if resetDC, _, _ := procResetDC.Call(hDC, uintptr(unsafe.Pointer(devMode))); resetDC == 0 {
+				return fmt.Errorf("page %d: failed to change paper to %.2f\" x %.2f\"", pageNum, width, height)
+			}
+			pageWidthPx, _, _ = procGetDeviceCaps.Call(hDC, HORZRES)
+			pageHeightPx, _, _ = procGetDeviceCaps.Call(hDC, VERTRES)
+			if pageWidthPx == 0 || pageHeightPx == 0 {
+				return fmt.Errorf("page %d: printer returned invalid dimensions %dx%d", pageNum, pageWidthPx, pageHeightPx)
+			}
+			paperWidth, paperHeight = width, height
+			log.Printf("📄 Page %d: Paper changed to %.2f\" x %.2f\", printable area %dx%d px",
+				pageNum, width, height, pageWidthPx, pageHeightPx)
+		}
+
 		// CRITICAL: Resize image to match printer's ACTUAL printable area, not paper size
 		// The printer's printable area (pageWidthPx/pageHeightPx) is smaller than paper due to margins
 		// We must fit within this area or the image will be clipped/misaligned
@@ -1116,7 +1166,15 @@ func (pm *PrintManager) printPagesFromChannelWithInit(pageChan <-chan *image.RGB
 		}
 		procSetStretchBltMode.Call(hDC, HALFTONE) // HALFTONE = 4
 
-		// Create DIB section on first page only
+		// A page of another size needs a DIB section of its own
+		if dibSectionCreated && (imgWidth != dibWidth || imgHeight != dibHeight) {
+			log.Printf("Page %d: Replacing %dx%d DIB section for %dx%d page", pageNum, dibWidth, dibHeight, imgWidth, imgHeight)
+			procSelectObject.Call(memDC, reusableOldBitmap)
+			procDeleteObject.Call(reusableBitmap)
+			dibSectionCreated = false
+		}
+
+		// Create DIB section on first page, and again when the size changes
 		if !dibSectionCreated {
 			log.Printf("Creating reusable DIB section for %dx%d bitmap", imgWidth, imgHeight)
 
@@ -1162,14 +1220,18 @@ func (pm *PrintManager) printPagesFromChannelWithInit(pageChan <-chan *image.RGB
 			// Without this, BitBlt will copy empty memory resulting in white pages!
 			reusableOldBitmap, _, _ = procSelectObject.Call(memDC, reusableBitmap)
 			dibSectionCreated = true
-
-			// Cleanup at end of print job
-			defer func() {
-				if dibSectionCreated {
-					procSelectObject.Call(memDC, reusableOldBitmap)
-					procDeleteObject.Call(reusableBitmap)
-				}
-			}()
+			dibWidth, dibHeight = imgWidth, imgHeight
+
+			// Cleanup at end of print job, of whichever section is current
+			if !dibCleanupDeferred {
+				dibCleanupDeferred = true
+				defer func() {
+					if dibSectionCreated {
+						procSelectObject.Call(memDC, reusableOldBitmap)
+						procDeleteObject.Call(reusableBitmap)
+					}
+				}()
+			}
 
 			log.Printf("Reusable DIB section created and selected into memory DC successfully")
 		}
@@ -1287,7 +1349,7 @@ func (pm *PrintManager) printPagesFromChannelWithInit(pageChan <-chan *image.RGB
 		// Send upstream progress update
 		if job.JobID != "test-print" {
 			progressMessage := fmt.Sprintf("Printing: %d/%d pages (%d%%)", pagesPrinted, totalPages, progressPercent)
-			outgoingMessages <- OutGoingLog{
+			outgoingMessages <- printprotocol.Event{
 				JobID:   job.JobID,
 				Event:   PRINT_EVENT_JOB_PROGRESS,
 				Message: progressMessage,
@@ -1337,7 +1399,8 @@ func (pm *PrintManager) renderWorkerRoundRobin(workerID, maxWorkers, numPages in
 		}
 
 		// Render the page (no mutex needed - each worker has own PDF reader)
-		img, err := pm.renderPDFPageDirect(pdfReader, pageNum, widthPx, heightPx)
+		pageWidthPx, pageHeightPx := job.pagePixels(pageNum, widthPx, heightPx)
+		img, err := pm.renderPDFPageDirect(pdfReader, pageNum, pageWidthPx, pageHeightPx)
 		renderDuration := time.Since(pageStartTime)
 
 		if err != nil {
@@ -1401,7 +1464,8 @@ func (pm *PrintManager) renderWorkerRoundRobinFrom(workerID, maxWorkers, startPa
 		}
 
 		// Render the page (no mutex needed - each worker has own PDF reader)
-		img, err := pm.renderPDFPageDirect(pdfReader, pageNum, widthPx, heightPx)
+		pageWidthPx, pageHeightPx := job.pagePixels(pageNum, widthPx, heightPx)
+		img, err := pm.renderPDFPageDirect(pdfReader, pageNum, pageWidthPx, pageHeightPx)
 		renderDuration := time.Since(pageStartTime)
 
 		if err != nil {
@@ -1568,25 +1632,22 @@ func getNowTime() string {
 	return now_time
 }
 
-func testPrint(console *Console, printManager *PrintManager, printCmd *PrintCommand) {
+func testPrint(console *Console, printManager *PrintManager, printCmd *printprotocol.Job) {
 	selectedPrinter := printerList.Value
 	pdfData, err := downloadPDF("test-print", "", "")
 	if err == nil {
 		printJob := PrintJob{
-			PrinterName:      selectedPrinter,
-			JobName:          printCmd.JobName,
-			JobType:          printCmd.JobType,
-			PrintOrientation: printCmd.PrintOrientation,
-			PrintBothSides:   printCmd.PrintBothSides,
-			Data:             pdfData,
-			Token:            "test-print",
-			Width:            printCmd.Width,
-			Height:           printCmd.Height,
-			JobID:            "test-print",
-			Event:            "test-print",
-			Barcode:          printCmd.Barcode,
-			Mashul:           printCmd.Mashul,
-			Weight:           printCmd.Weight,
+			PrinterName: selectedPrinter,
+			JobName:     fmt.Sprintf("Test Print %gx%g %s", printCmd.Width, printCmd.Height, printCmd.Unit),
+			Data:        pdfData,
+			Token:       "test-print",
+			Width:       printCmd.Width,
+			Height:      printCmd.Height,
+			JobID:       "test-print",
+			Event:       "test-print",
+			Barcode:     printCmd.Barcode,
+			Mashul:      printCmd.Mashul,
+			Weight:      printCmd.Weight,
 		}
 		printManager.handlePrintJob(printJob, console)
 
@@ -1598,7 +1659,7 @@ func testPrint(console *Console, printManager *PrintManager, printCmd *PrintComm
 	}
 }
 
-func LivePrint(console *Console, printManager *PrintManager, printCmd *PrintCommand) {
+func LivePrint(console *Console, printManager *PrintManager, printCmd *printprotocol.Job) {
 	log.Println("Received Live Print command")
 	//print full printCmd for debugging
 	log.Println("Print Command: ", printCmd)
@@ -1606,69 +1667,63 @@ func LivePrint(console *Console, printManager *PrintManager, printCmd *PrintComm
 	pdfData, err := downloadPDF("print", printCmd.JobID, printCmd.JobToken)
 	if err == nil {
 		printJob := PrintJob{
-			PrinterName:      selectedPrinter,
-			JobName:          printCmd.JobName,
-			JobType:          printCmd.JobType,
-			PrintBothSides:   printCmd.PrintBothSides,
-			PrintOrientation: printCmd.PrintOrientation,
-			Data:             pdfData,
-			Token:            "live-print",
-			Width:            printCmd.Width,
-			Height:           printCmd.Height,
-			JobID:            printCmd.JobID,
-			Event:            "live-print",
-			Barcode:          printCmd.Barcode,
-			Mashul:           printCmd.Mashul,
-			Weight:           printCmd.Weight,
+			PrinterName: selectedPrinter,
+			Data:        pdfData,
+			Token:       "live-print",
+			Width:       printCmd.Width,
+			Height:      printCmd.Height,
+			PageSizes:   printCmd.PageSizes,
+			JobID:       printCmd.JobID,
+			Event:       "live-print",
+			Barcode:     printCmd.Barcode,
+			Mashul:      printCmd.Mashul,
+			Weight:      printCmd.Weight,
 		}
 		printManager.handlePrintJob(printJob, console)
-		outgoinglog := OutGoingLog{JobID: printCmd.JobID, Event: "live-print-sent-to-printer", Message: "Live Print job sent to printer"}
+		outgoinglog := printprotocol.Event{JobID: printCmd.JobID, Event: printprotocol.EventLivePrintSent, Message: "Live Print job sent to printer"}
 		outgoingMessages <- outgoinglog
 	} else {
 		console.MsgChan <- Message{
 			Text:  fmt.Sprintf("Failed to download live PDF: %v", err),
 			Color: colorNRGBA(255, 40, 0, 255), // Red
 		}
-		outgoinglog := OutGoingLog{JobID: printCmd.JobID, Event: "live-pdf-download-failed", Message: "Failed to download live pdf"}
+		outgoinglog := printprotocol.Event{JobID: printCmd.JobID, Event: printprotocol.EventLivePDFFailed, Message: "Failed to download live pdf"}
 		outgoingMessages <- outgoinglog
 	}
 }
 
-func SpecimenPrint(console *Console, printManager *PrintManager, printCmd *PrintCommand) {
+func SpecimenPrint(console *Console, printManager *PrintManager, printCmd *printprotocol.Job) {
 	selectedPrinter := printerList.Value
 	pdfData, err := downloadPDF("specimen-print", printCmd.JobID, printCmd.JobToken)
 	if err == nil {
 		printJob := PrintJob{
-			PrinterName:      selectedPrinter,
-			JobName:          printCmd.JobName,
-			JobType:          printCmd.JobType,
-			PrintOrientation: printCmd.PrintOrientation,
-			PrintBothSides:   printCmd.PrintBothSides,
-			Data:             pdfData,
-			Token:            "specimen-print",
-			Width:            printCmd.Width,
-			Height:           printCmd.Height,
-			JobID:            printCmd.JobID,
-			Event:            "specimen-print",
-			Barcode:          printCmd.Barcode,
-			Mashul:           printCmd.Mashul,
-			Weight:           printCmd.Weight,
+			PrinterName: selectedPrinter,
+			Data:        pdfData,
+			Token:       "specimen-print",
+			Width:       printCmd.Width,
+			Height:      printCmd.Height,
+			PageSizes:   printCmd.PageSizes,
+			JobID:       printCmd.JobID,
+			Event:       "specimen-print",
+			Barcode:     printCmd.Barcode,
+			Mashul:      printCmd.Mashul,
+			Weight:      printCmd.Weight,
 		}
 		printManager.handlePrintJob(printJob, console)
-		outgoinglog := OutGoingLog{JobID: printCmd.JobID, Event: "specimen-print-sent-to-printer", Message: "Specimen Print job sent to printer"}
+		outgoinglog := printprotocol.Event{JobID: printCmd.JobID, Event: printprotocol.EventSpecimenPrintSent, Message: "Specimen Print job sent to printer"}
 		outgoingMessages <- outgoinglog
 	} else {
 		console.MsgChan <- Message{
 			Text:  fmt.Sprintf("Failed to download live PDF: %v", err),
 			Color: colorNRGBA(255, 40, 0, 255), // Red
 		}
-		outgoinglog := OutGoingLog{JobID: printCmd.JobID, Event: "specimen-pdf-download-failed", Message: "Failed to download Specimen pdf"}
+		outgoinglog := printprotocol.Event{JobID: printCmd.JobID, Event: printprotocol.EventSpecimenPDFFailed, Message: "Failed to download Specimen pdf"}
 		outgoingMessages <- outgoinglog
 	}
 }
 
 // attachPrintQueueWithMonitoring binds print queue and starts progress monitoring goroutine
-func (pm *PrintManager) attachPrintQueueWithMonitoring(last_print_event LastPrintEvent, console *Console, last_print_event_found bool, printerName string, totalPages int) {
+func (pm *PrintManager) attachPrintQueueWithMonitoring(last_print_event LastPrintEvent, console *Console, last_print_event_found bool, printerName string, command string, totalPages int) {
 
 	if !last_print_event_found {
 		time.Sleep(3 * time.Second)
@@ -1794,6 +1849,7 @@ func (pm *PrintManager) attachPrintQueueWithMonitoring(last_print_event LastPrin
 							PrinterName: printerName,
 							QueueID:     queue_id,
 							JobID:       last_print_event.JobID,
+							Command:     command,
 							TotalPages:  totalPages,
 						}
 					}
@@ -1810,7 +1866,7 @@ func (pm *PrintManager) attachPrintQueueWithMonitoring(last_print_event LastPrin
 					Text:  fmt.Sprintf("Print queue not attached for job: %s", last_print_event.JobID),
 					Color: colorNRGBA(255, 40, 0, 255), // Red
 				}
-				outgoingMessages <- OutGoingLog{JobID: last_print_event.JobID, Event: "print-queue-not-attached", Message: "Print queue not attached"}
+				outgoingMessages <- printprotocol.Event{JobID: last_print_event.JobID, Event: printprotocol.EventPrintQueueNotAttached, Message: "Print queue not attached"}
 			}
 			break
 		}
@@ -1822,6 +1878,7 @@ type TrackedPrintJob struct {
 	PrinterName      string
 	QueueID          int
 	JobID            string
+	Command          string
 	TotalPages       int
 	LastPagesPrinted uint32
 	HPrinter         syscall.Handle
@@ -1861,6 +1918,7 @@ func monitorPrintQueueService(printMngr *PrintManager, console *Console) {
 				PrinterName:      req.PrinterName,
 				QueueID:          req.QueueID,
 				JobID:            req.JobID,
+				Command:          req.Command,
 				TotalPages:       req.TotalPages,
 				LastPagesPrinted: 0,
 				HPrinter:         hPrinter,
@@ -1992,6 +2050,19 @@ func monitorPrintQueueService(printMngr *PrintManager, console *Console) {
 					if pagesPrinted != job.LastPagesPrinted {
 						job.LastPagesPrinted = pagesPrinted
 						log.Printf("Job %s progress: %d/%d pages (%d%%)", job.JobID, pagesPrinted, job.TotalPages, progressPercent)
+
+						// Report printed pages upstream so the server can mark the
+						// orders on those pages as printed. Specimen prints share the
+						// live job ID, so only live prints are reported.
+						if job.Command == printprotocol.CommandLivePrint {
+							outgoingMessages <- printprotocol.Event{
+								JobID:        job.JobID,
+								Event:        PRINT_EVENT_PAGES_PRINTED,
+								Message:      fmt.Sprintf("Printed: %d/%d pages", pagesPrinted, job.TotalPages),
+								PagesPrinted: int(pagesPrinted),
+								TotalPages:   job.TotalPages,
+							}
+						}
 					}
 
 					// Check for completion
@@ -2014,9 +2085,9 @@ func monitorPrintQueueService(printMngr *PrintManager, console *Console) {
 		// Send consolidated status update if there are active jobs
 		if statusBuilder.Len() > 0 {
 			statusMessage := strings.TrimSuffix(statusBuilder.String(), "\n")
-			outgoingMessages <- OutGoingLog{
+			outgoingMessages <- printprotocol.Event{
 				JobID:   "queue-status",
-				Event:   "print-queue-progress",
+				Event:   printprotocol.EventQueueProgress,
 				Message: statusMessage,
 			}
 		}
@@ -2249,7 +2320,7 @@ func getAllPrintServiceLogs(console *Console, printMng *PrintManager) {
 									Color: colorNRGBA(0, 255, 0, 255), // Green
 								}
 								if print_event.JobID != "test-print" {
-									outgoingMessages <- OutGoingLog{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_QUEUED, Message: print_event.EventQueued}
+									outgoingMessages <- printprotocol.Event{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_QUEUED, Message: print_event.EventQueued}
 								}
 								store_event_flag = true
 							}
@@ -2261,7 +2332,7 @@ func getAllPrintServiceLogs(console *Console, printMng *PrintManager) {
 									Color: colorNRGBA(0, 255, 0, 255), // Green
 								}
 								if print_event.JobID != "test-print" {
-									outgoingMessages <- OutGoingLog{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_STARTED, Message: print_event.EventSpooling}
+									outgoingMessages <- printprotocol.Event{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_STARTED, Message: print_event.EventSpooling}
 								}
 								store_event_flag = true
 							}
@@ -2273,7 +2344,7 @@ func getAllPrintServiceLogs(console *Console, printMng *PrintManager) {
 									Color: colorNRGBA(0, 255, 0, 255), // Green
 								}
 								if print_event.JobID != "test-print" {
-									outgoingMessages <- OutGoingLog{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_PRINTING, Message: print_event.EventPrinting}
+									outgoingMessages <- printprotocol.Event{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_PRINTING, Message: print_event.EventPrinting}
 								}
 								store_event_flag = true
 							}
@@ -2285,7 +2356,7 @@ func getAllPrintServiceLogs(console *Console, printMng *PrintManager) {
 									Color: colorNRGBA(0, 255, 0, 255), // Green
 								}
 								if print_event.JobID != "test-print" {
-									outgoingMessages <- OutGoingLog{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_RENDERING, Message: print_event.EventRendering}
+									outgoingMessages <- printprotocol.Event{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_RENDERING, Message: print_event.EventRendering}
 								}
 								store_event_flag = true
 							}
@@ -2297,7 +2368,7 @@ func getAllPrintServiceLogs(console *Console, printMng *PrintManager) {
 									Color: colorNRGBA(0, 255, 0, 255), // Green
 								}
 								if print_event.JobID != "test-print" {
-									outgoingMessages <- OutGoingLog{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_COMPLETED, Message: print_event.EventCompleted}
+									outgoingMessages <- printprotocol.Event{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_COMPLETED, Message: print_event.EventCompleted}
 								}
 								// Remove the print event from the tracker
 								delete_event_flag = true
@@ -2311,7 +2382,7 @@ func getAllPrintServiceLogs(console *Console, printMng *PrintManager) {
 									Color: colorNRGBA(255, 40, 0, 255), // Red
 								}
 								if print_event.JobID != "test-print" {
-									outgoingMessages <- OutGoingLog{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_FAILED, Message: print_event.EventFailed}
+									outgoingMessages <- printprotocol.Event{JobID: print_event.JobID, Event: PRINT_EVENT_JOB_FAILED, Message: print_event.EventFailed}
 								}
 								delete_event_flag = true
 							}
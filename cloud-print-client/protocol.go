@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"printprotocol"
+)
+
+// receivedMessagesFile remembers the jobs already accepted, so a job the
+// server sends again after a lost ack is not printed twice, even across
+// restarts
+const receivedMessagesFile = "data/received_messages.json"
+
+// receivedMessageTTL is how long an accepted message ID is remembered. It
+// must outlast the server's message expiry (24 hours by default).
+const receivedMessageTTL = 72 * time.Hour
+
+var (
+	receivedMutex    sync.Mutex
+	receivedMessages map[string]time.Time // message ID -> when it was accepted
+)
+
+// jobCommands are the commands the client knows how to run
+var jobCommands = map[string]bool{
+	printprotocol.CommandSpecimenPrint: true,
+	printprotocol.CommandTestPrint:     true,
+	printprotocol.CommandLivePrint:     true,
+}
+
+// acceptJob acknowledges a job carrying a message ID and reports whether it
+// should run. Duplicates are acked again but not run; jobs the client
+// cannot run are nacked with the reason.
+func acceptJob(console *Console, printCommand *printprotocol.Job) bool {
+	receivedMutex.Lock()
+	defer receivedMutex.Unlock()
+	loadReceivedMessages()
+
+	if _, seen := receivedMessages[printCommand.MessageID]; seen {
+		log.Printf("Job %s (message %s) already received, acknowledging again", printCommand.JobID, printCommand.MessageID)
+		sendReceipt(printprotocol.TypeAck, printCommand, "")
+		return false
+	}
+
+	var reason string
+	switch {
+	case printCommand.Version > printprotocol.Version:
+		reason = fmt.Sprintf("unsupported protocol version %d, client speaks %d", printCommand.Version, printprotocol.Version)
+	case !jobCommands[printCommand.Command]:
+		reason = fmt.Sprintf("unknown command %q", printCommand.Command)
+	case printCommand.JobID == "":
+		reason = "job has no job ID"
+	}
+	if reason != "" {
+		console.MsgChan <- Message{
+			Text:  fmt.Sprintf("Refused job %s: %s", printCommand.JobID, reason),
+			Color: colorNRGBA(255, 40, 0, 255),
+		}
+		sendReceipt(printprotocol.TypeNack, printCommand, reason)
+		return false
+	}
+
+	receivedMessages[printCommand.MessageID] = time.Now()
+	if err := saveReceivedMessages(); err != nil {
+		log.Println("Failed to save received messages:", err)
+	}
+	sendReceipt(printprotocol.TypeAck, printCommand, "")
+	return true
+}
+
+// sendReceipt queues an ack or nack for a job
+func sendReceipt(receiptType string, printCommand *printprotocol.Job, reason string) {
+	outgoingMessages <- printprotocol.Receipt{
+		Type:      receiptType,
+		Version:   printprotocol.Version,
+		MessageID: printCommand.MessageID,
+		JobID:     printCommand.JobID,
+		Reason:    reason,
+	}
+}
+
+// loadReceivedMessages reads the accepted message IDs on first use.
+// receivedMutex must be held.
+func loadReceivedMessages() {
+	if receivedMessages != nil {
+		return
+	}
+	receivedMessages = make(map[string]time.Time)
+	if err := loadJSONFromFile(receivedMessagesFile, &receivedMessages); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println("Failed to load received messages:", err)
+	}
+}
+
+// saveReceivedMessages forgets message IDs older than receivedMessageTTL
+// and writes the rest. receivedMutex must be held.
+func saveReceivedMessages() error {
+	for id, receivedAt := range receivedMessages {
+		if time.Since(receivedAt) > receivedMessageTTL {
+			delete(receivedMessages, id)
+		}
+	}
+	return saveJSONToFile(receivedMessagesFile, receivedMessages)
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -14,42 +16,11 @@ import (
 	"sync"
 	"time"
 
+	"printprotocol"
+
 	"github.com/gorilla/websocket"
 )
 
-// AuthMessage defines the structure of the authentication message for server-side verification
-type AuthMessage struct {
-	Type          string `json:"type"`           // Message type (e.g., "auth")
-	Token         string `json:"token"`          // Unique token generated by the client
-	Processor     string `json:"processor"`      // Machine's processor details
-	Platform      string `json:"platform"`       // Machine's platform details (e.g., OS)
-	HardwareID    string `json:"hardware_id"`    // Unique hardware identifier
-	ClientVersion string `json:"client_version"` // Client Software Version
-}
-
-type PrintCommand struct {
-	PrinterID        string  `json:"printer_id"`
-	JobName          string  `json:"job_name"`
-	JobType          string  `json:"job_type"`
-	PrintBothSides   bool    `json:"print_both_sides"`
-	PrintOrientation string  `json:"print_orientation"`
-	JobID            string  `json:"job_id"`
-	JobToken         string  `json:"job_token"`
-	Command          string  `json:"command"`
-	Width            float64 `json:"width"`
-	Height           float64 `json:"height"`
-	Unit             string  `json:"unit"`
-	Barcode          string  `json:"barcode"`
-	Mashul           string  `json:"mashul"`
-	Weight           string  `json:"weight"`
-}
-
-type OutGoingLog struct {
-	JobID   string `json:"JobId"`
-	Event   string `json:"Event"`
-	Message string `json:"Message"`
-}
-
 var (
 	// socketURL = "wss://ekdak.com/ekdak-cloud-print-subscriber" // WebSocket server URL
 	socketURL = appSettings.SOCKET_URL // WebSocket server URL
@@ -61,14 +32,10 @@ var outgoingMessages = make(chan interface{}, 1000) // Adjust buffer size as nee
 var connMutex sync.Mutex
 var conn *websocket.Conn
 
-func connectWebSocket(console *Console, printManager *PrintManager, authMessage *AuthMessage) {
+func connectWebSocket(console *Console, printManager *PrintManager, authMessage *printprotocol.Auth, clientKey ed25519.PrivateKey) {
 	for {
 		// Attempt to connect to WebSocket server
-		var err error
-		connMutex.Lock()
-		conn, _, err = websocket.DefaultDialer.Dial(socketURL, nil)
-		connMutex.Unlock()
-
+		c, _, err := websocket.DefaultDialer.Dial(socketURL, nil)
 		if err != nil {
 			console.MsgChan <- Message{
 				Text:  fmt.Sprintf("Connection failed, retrying in 2 seconds: %s", err),
@@ -84,17 +51,30 @@ func connectWebSocket(console *Console, printManager *PrintManager, authMessage
 			Color: colorNRGBA(255, 140, 0, 255),
 		}
 
-		// Authenticate immediately
-		if err := sendJSON(authMessage); err != nil {
+		// Authenticate before the connection is shared with the message sender
+		if err := authenticateSession(c, authMessage, clientKey); err != nil {
+			c.Close()
+			var enrollErr *enrollmentError
+			if errors.As(err, &enrollErr) {
+				console.MsgChan <- Message{
+					Text:  fmt.Sprintf("%s (key %s), retrying in %s", enrollErr.Message, keyFingerprint(clientKey)[:16], enrollmentRetryInterval),
+					Color: colorNRGBA(255, 40, 0, 255),
+				}
+				time.Sleep(enrollmentRetryInterval)
+				continue
+			}
 			console.MsgChan <- Message{
 				Text:  fmt.Sprintf("Auth failed, reconnecting: %v", err),
 				Color: colorNRGBA(255, 40, 0, 255),
 			}
-			conn.Close()
 			time.Sleep(2 * time.Second)
 			continue
 		}
 
+		connMutex.Lock()
+		conn = c
+		connMutex.Unlock()
+
 		// Start message receiver
 		receiveMessages(console, printManager)
 
@@ -158,41 +138,46 @@ func receiveMessages(console *Console, printManager *PrintManager) {
 			break
 		}
 
-		var printCommand PrintCommand
+		var printCommand printprotocol.Job
 		if err := json.Unmarshal(message, &printCommand); err != nil {
 			log.Println("Error parsing JSON:", err)
 			continue
 		}
 
+		// Jobs with a message ID are acknowledged, and run only once
+		if printCommand.MessageID != "" && !acceptJob(console, &printCommand) {
+			continue
+		}
+
 		handlePrintCommand(console, printManager, &printCommand)
 	}
 }
 
 // handlePrintCommand processes incoming commands
-func handlePrintCommand(console *Console, printManager *PrintManager, printCommand *PrintCommand) {
+func handlePrintCommand(console *Console, printManager *PrintManager, printCommand *printprotocol.Job) {
 	switch printCommand.Command {
-	case "specimen-print":
+	case printprotocol.CommandSpecimenPrint:
 		console.MsgChan <- Message{
 			Text:  fmt.Sprintf("Specimen Printing job %s", printCommand.JobID),
 			Color: colorNRGBA(255, 140, 0, 255),
 		}
 		go SpecimenPrint(console, printManager, printCommand)
 
-	case "test-print":
+	case printprotocol.CommandTestPrint:
 		console.MsgChan <- Message{
 			Text:  fmt.Sprintf("Test Printing job %s", printCommand.Command),
 			Color: colorNRGBA(255, 140, 0, 255),
 		}
 		go testPrint(console, printManager, printCommand)
 
-	case "live-print":
+	case printprotocol.CommandLivePrint:
 		console.MsgChan <- Message{
 			Text:  fmt.Sprintf("Live Printing job %s", printCommand.JobID),
 			Color: colorNRGBA(255, 140, 0, 255),
 		}
 		go LivePrint(console, printManager, printCommand)
 
-	case "pong":
+	case printprotocol.CommandPong:
 		console.MsgChan <- Message{
 			Text:  "Pong Received",
 			Color: colorNRGBA(255, 140, 0, 255),
@@ -321,7 +306,7 @@ func getMacHardwareID() (string, error) {
 }
 
 // GenerateAuthMessage creates an AuthMessage based on machine details and the public key
-func GenerateAuthMessage() (*AuthMessage, error) {
+func GenerateAuthMessage() (*printprotocol.Auth, error) {
 	// Fetch the public key
 	// publicKeyURL := PUBLIC_KEY_URL
 	// if publicKeyURL == "" {
@@ -349,13 +334,15 @@ func GenerateAuthMessage() (*AuthMessage, error) {
 	// log.Println("Generated token:", token)
 
 	// Create the AuthMessage
-	authMessage := &AuthMessage{
+	authMessage := &printprotocol.Auth{
 		Type:          "auth",       // Set type as "auth"
 		Token:         token,        // Unique token (same as ClientID)
 		Processor:     processor,    // Processor details
 		Platform:      platform,     // Platform details
 		HardwareID:    hardwareID,   // Hardware identifier
 		ClientVersion: getVersion(), // Client Software Version
+
+		ProtocolVersion: printprotocol.Version,
 	}
 
 	return authMessage, nil
@@ -363,7 +350,7 @@ func GenerateAuthMessage() (*AuthMessage, error) {
 
 func PingPong() {
 	for {
-		outgoingMessages <- OutGoingLog{JobID: "ping", Event: "ping", Message: "ping"}
+		outgoingMessages <- printprotocol.Event{JobID: "ping", Event: printprotocol.EventPing, Message: "ping"}
 		time.Sleep(75 * time.Second)
 	}
 }
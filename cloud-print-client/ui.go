@@ -11,6 +11,8 @@ import (
 	"strings"
 	"sync"
 
+	"printprotocol"
+
 	"gioui.org/app"
 	"gioui.org/font"
 	"gioui.org/font/gofont"
@@ -668,8 +670,8 @@ func loop(w *app.Window, console *Console, printManager *PrintManager, printersC
 				}
 
 				// Send printer selection event to server via websocket
-				printerSelectedMsg := OutGoingLog{
-					Event:   "printer-selected",
+				printerSelectedMsg := printprotocol.Event{
+					Event:   printprotocol.EventPrinterSelected,
 					JobID:   client_id,
 					Message: printerList.Value,
 				}
@@ -693,9 +695,8 @@ func loop(w *app.Window, console *Console, printManager *PrintManager, printersC
 						Color: color.NRGBA{R: 255, G: 255, B: 255, A: 255}, // White color
 					}
 
-					printCommand := PrintCommand{
-						Command:   "test-print",
-						JobName:   "Test Print 8.5x7.75 inch",
+					printCommand := printprotocol.Job{
+						Command:   printprotocol.CommandTestPrint,
 						Width:     8.5,
 						Height:    7.75,
 						Unit:      "inch",
@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"time"
 
+	"printprotocol"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -200,7 +202,7 @@ func (wdm *WeightDimMachineManager) GetWeightDimData() (status_data *StatusXML,
 		return nil, err
 	}
 
-	status.Event = "weight-dim-data"
+	status.Event = printprotocol.EventWeightDimData
 	status.MachineID = wdm.allowed_machine.MachineId
 	status.PrinterID = wdm.printer_client_id
 	status.Status = "success"
@@ -282,7 +284,7 @@ func probeIP(ip string, console *Console, client_id string) error {
 	}
 
 	status.MachineID = ip
-	status.Event = "weight-dim-data"
+	status.Event = printprotocol.EventWeightDimData
 	status.PrinterID = client_id
 	status.Status = "success"
 
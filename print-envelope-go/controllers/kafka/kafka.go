@@ -0,0 +1,359 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"printenvelope/logger"
+	logModel "printenvelope/models/log"
+	"printenvelope/models/user"
+	"printenvelope/services"
+	"printenvelope/types"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type KafkaController struct {
+	db             *gorm.DB
+	loggerInstance *logger.AsyncLogger
+	ingest         *services.IngestService
+}
+
+func NewKafkaController(db *gorm.DB, async_logger *logger.AsyncLogger) *KafkaController {
+	return &KafkaController{db: db, loggerInstance: async_logger, ingest: services.NewIngestService(db)}
+}
+
+// MessageList lists logged Kafka messages. By default every message is
+// returned; rejected=true narrows the list to messages refused because of
+// their content and status accepts a comma-separated list of statuses.
+func (kc *KafkaController) MessageList(c *fiber.Ctx) error {
+	// Parse pagination parameters
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "10"))
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	if pageSize > 100 {
+		pageSize = 100 // Max limit
+	}
+
+	query := kc.db.Model(&logModel.KafkaMessageLog{}).Where("is_deleted = ?", false)
+	filters := make(map[string]interface{})
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status IN ?", strings.Split(status, ","))
+		filters["status"] = status
+	} else if c.QueryBool("rejected") {
+		query = query.Where("status IN ?", logModel.KafkaRejectedStatuses)
+		filters["rejected"] = true
+	}
+	if topic := c.Query("topic"); topic != "" {
+		query = query.Where("topic = ?", topic)
+		filters["topic"] = topic
+	}
+	if partition := c.Query("partition"); partition != "" {
+		if p, err := strconv.Atoi(partition); err == nil {
+			query = query.Where("partition = ?", p)
+			filters["partition"] = p
+		}
+	}
+	if key := c.Query("key"); key != "" {
+		query = query.Where("key ILIKE ?", "%"+key+"%")
+		filters["key"] = key
+	}
+	if search := c.Query("search"); search != "" {
+		query = query.Where("value ILIKE ?", "%"+search+"%")
+		filters["search"] = search
+	}
+
+	// Filter by date range on createdAt
+	if startDate := c.Query("start_date"); startDate != "" {
+		parsedStartDate, err := time.Parse("2006-01-02", startDate)
+		if err == nil {
+			query = query.Where("created_at >= ?", parsedStartDate)
+			filters["start_date"] = startDate
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		parsedEndDate, err := time.Parse("2006-01-02", endDate)
+		if err == nil {
+			// Add 1 day to include the entire end date
+			query = query.Where("created_at < ?", parsedEndDate.AddDate(0, 0, 1))
+			filters["end_date"] = endDate
+		}
+	}
+
+	// Count total records
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Error("Failed to count kafka messages", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to count kafka messages",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	var messages []logModel.KafkaMessageLog
+	if err := query.Order("created_at DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&messages).Error; err != nil {
+		logger.Error("Failed to fetch kafka messages", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch kafka messages",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	// Counts per status help the admin see what is waiting to be fixed
+	var statusCounts []struct {
+		Status string `json:"status"`
+		Count  int64  `json:"count"`
+	}
+	kc.db.Model(&logModel.KafkaMessageLog{}).
+		Select("status, COUNT(*) AS count").
+		Where("is_deleted = ?", false).
+		Group("status").
+		Scan(&statusCounts)
+
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Kafka messages fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"messages":      messages,
+			"status_counts": statusCounts,
+			"pagination": fiber.Map{
+				"current_page":  page,
+				"page_size":     pageSize,
+				"total_records": total,
+				"total_pages":   totalPages,
+				"has_next_page": page < totalPages,
+				"has_prev_page": page > 1,
+			},
+			"filters": filters,
+		},
+	})
+}
+
+// MessageDetail returns a single logged Kafka message
+func (kc *KafkaController) MessageDetail(c *fiber.Ctx) error {
+	message, errResp := kc.findMessage(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Kafka message fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"message": message,
+		},
+	})
+}
+
+// UpdateMessage replaces the payload of a message that has not produced an
+// order. The payload as received is kept in original_value.
+func (kc *KafkaController) UpdateMessage(c *fiber.Ctx) error {
+	var req types.KafkaMessageUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse kafka message update request", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	if strings.TrimSpace(req.Value) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "value is required",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	message, errResp := kc.findMessage(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+	if message.Status == logModel.KafkaStatusProcessed {
+		return c.Status(fiber.StatusConflict).JSON(types.ErrorResponse{
+			Message: "Message has already been processed into an order",
+			Status:  fiber.StatusConflict,
+		})
+	}
+
+	admin, errResp := kc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	updates := map[string]interface{}{"value": req.Value}
+	if message.OriginalValue == nil {
+		updates["original_value"] = message.Value
+	}
+
+	err := kc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(message).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     admin.ID,
+			AdminUUID:   admin.Uuid,
+			Action:      "UPDATE_KAFKA_MESSAGE",
+			EntityType:  "KAFKA_MESSAGE_LOG",
+			EntityID:    message.ID,
+			Description: fmt.Sprintf("Edited payload of %s message %s/%d@%d", message.Status, message.Topic, message.Partition, message.Offset),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err != nil {
+		logger.Error("Failed to update kafka message", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to update kafka message",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	kc.db.First(message, message.ID)
+
+	logger.Success(fmt.Sprintf("Kafka message %d payload updated by %s", message.ID, admin.Uuid))
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Kafka message updated successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"message": message,
+		},
+	})
+}
+
+// ReprocessMessage runs a message that has not produced an order through the
+// ingestion pipeline again, using its current (possibly edited) payload
+func (kc *KafkaController) ReprocessMessage(c *fiber.Ctx) error {
+	message, errResp := kc.findMessage(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+	if message.Status == logModel.KafkaStatusProcessed {
+		return c.Status(fiber.StatusConflict).JSON(types.ErrorResponse{
+			Message: "Message has already been processed into an order",
+			Status:  fiber.StatusConflict,
+		})
+	}
+
+	admin, errResp := kc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	previousStatus := message.Status
+	now := time.Now()
+	result, ingestErr := kc.ingest.Ingest(message, []byte(message.Value), message.Source+" (reprocessed)", func(tx *gorm.DB) error {
+		if err := tx.Model(message).Updates(map[string]interface{}{
+			"reprocess_count": gorm.Expr("reprocess_count + 1"),
+			"reprocessed_at":  now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     admin.ID,
+			AdminUUID:   admin.Uuid,
+			Action:      "REPROCESS_KAFKA_MESSAGE",
+			EntityType:  "KAFKA_MESSAGE_LOG",
+			EntityID:    message.ID,
+			Description: fmt.Sprintf("Reprocessed %s message %s/%d@%d", previousStatus, message.Topic, message.Partition, message.Offset),
+			OldValues:   user.JSONMap{"status": previousStatus},
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+
+	// Reload so the response reflects the recorded outcome
+	kc.db.First(message, message.ID)
+
+	if ingestErr != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: fmt.Sprintf("Failed to reprocess message: %s", ingestErr.Error()),
+			Status:  fiber.StatusInternalServerError,
+			Data: fiber.Map{
+				"result":  result,
+				"message": message,
+			},
+		})
+	}
+
+	if result.Status != logModel.KafkaStatusProcessed {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(types.ErrorResponse{
+			Message: fmt.Sprintf("Message rejected again: %s", result.Error),
+			Status:  fiber.StatusUnprocessableEntity,
+			Data: fiber.Map{
+				"result":  result,
+				"message": message,
+			},
+		})
+	}
+
+	logger.Success(fmt.Sprintf("Kafka message %d reprocessed into order %d by %s", message.ID, result.OrderID, admin.Uuid))
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Kafka message reprocessed successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"result":  result,
+			"message": message,
+		},
+	})
+}
+
+// findMessage loads the non-deleted message named by the :id route parameter
+func (kc *KafkaController) findMessage(c *fiber.Ctx) (*logModel.KafkaMessageLog, *types.ErrorResponse) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil || id <= 0 {
+		return nil, &types.ErrorResponse{
+			Message: "Invalid message id",
+			Status:  fiber.StatusBadRequest,
+		}
+	}
+
+	var message logModel.KafkaMessageLog
+	if err := kc.db.Where("id = ? AND is_deleted = ?", id, false).First(&message).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &types.ErrorResponse{
+				Message: "Kafka message not found",
+				Status:  fiber.StatusNotFound,
+			}
+		}
+		logger.Error("Failed to fetch kafka message", err)
+		return nil, &types.ErrorResponse{
+			Message: "Failed to fetch kafka message",
+			Status:  fiber.StatusInternalServerError,
+		}
+	}
+	return &message, nil
+}
+
+// currentUser looks up the authenticated user
+func (kc *KafkaController) currentUser(c *fiber.Ctx) (*user.User, *types.ErrorResponse) {
+	userUUID, ok := c.Locals("user_id").(string)
+	if !ok || userUUID == "" {
+		return nil, &types.ErrorResponse{
+			Message: "User not authenticated",
+			Status:  fiber.StatusUnauthorized,
+		}
+	}
+
+	var u user.User
+	if err := kc.db.Where("uuid = ?", userUUID).First(&u).Error; err != nil {
+		logger.Error("Failed to find user by UUID", err)
+		return nil, &types.ErrorResponse{
+			Message: "Invalid user",
+			Status:  fiber.StatusUnauthorized,
+		}
+	}
+	return &u, nil
+}
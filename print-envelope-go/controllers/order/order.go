@@ -2,11 +2,15 @@ package order
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"printenvelope/logger"
 	"printenvelope/models/order"
+	"printenvelope/services"
 	"printenvelope/types"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -303,9 +307,20 @@ func (oc *OrderController) BatchOrderCreate(c *fiber.Ctx) error {
 		}
 	}()
 
-	// Find orders within the sequence range
+	// Wait for any other batching to finish so its orders are seen as batched
+	if err := services.LockBatching(tx); err != nil {
+		tx.Rollback()
+		logger.Error("Failed to lock batching", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to create batch",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	// Find orders within the sequence range, leaving out cancelled ones
 	var orders []order.Order
 	if err := tx.Where("sequence >= ? AND sequence <= ?", req.StartSequence, req.EndSequence).
+		Where("is_cancelled = ?", false).
 		Order("sequence ASC").
 		Find(&orders).Error; err != nil {
 		tx.Rollback()
@@ -376,8 +391,16 @@ func (oc *OrderController) BatchOrderCreate(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate batch number (using timestamp)
-	batchNumber := fmt.Sprintf("BATCH-%d", time.Now().Unix())
+	// Allocate the next running batch number
+	batchNumber, err := services.NextBatchNumber(tx, services.RangeBatchPrefix)
+	if err != nil {
+		tx.Rollback()
+		logger.Error("Failed to allocate batch number", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to create order batch",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
 
 	// Create the batch
 	batch := order.OrderBatch{
@@ -431,7 +454,7 @@ func (oc *OrderController) BatchOrderCreate(c *fiber.Ctx) error {
 		orderEvent := order.OrderEvent{
 			OrderID:  ord.ID,
 			Status:   order.OrderBatched,
-			Message:  fmt.Sprintf("Order %s has been batched into %s", ord.Sequence, batch.BatchNumber),
+			Message:  fmt.Sprintf("Order %d has been batched into %s", ord.Sequence, batch.BatchNumber),
 			Metadata: &metadataStr,
 		}
 
@@ -467,7 +490,7 @@ func (oc *OrderController) BatchOrderCreate(c *fiber.Ctx) error {
 	}
 
 	// Log the activity
-	logger.Success(fmt.Sprintf("Created batch %s with %d orders (sequences: %s to %s)", batch.BatchNumber, len(orders), req.StartSequence, req.EndSequence))
+	logger.Success(fmt.Sprintf("Created batch %s with %d orders (sequences: %d to %d)", batch.BatchNumber, len(orders), req.StartSequence, req.EndSequence))
 
 	// Return success response
 	return c.Status(fiber.StatusCreated).JSON(types.ApiResponse{
@@ -486,3 +509,152 @@ func (oc *OrderController) BatchOrderCreate(c *fiber.Ctx) error {
 		},
 	})
 }
+
+// AutoBatch groups unbatched orders into batches by district, returning post
+// office, returning zip code or city, creating as many batches as needed
+func (oc *OrderController) AutoBatch(c *fiber.Ctx) error {
+	var req types.AutoBatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse auto batch request", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	rule := services.BatchRule{
+		GroupBy:       req.GroupBy,
+		MaxBatchSize:  req.MaxBatchSize,
+		StartSequence: req.StartSequence,
+		EndSequence:   req.EndSequence,
+	}
+	if err := rule.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: err.Error(),
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	userUUID, ok := c.Locals("user_id").(string)
+	if !ok || userUUID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(types.ErrorResponse{
+			Message: "User not authenticated",
+			Status:  fiber.StatusUnauthorized,
+		})
+	}
+	var user struct {
+		ID uint
+	}
+	if err := oc.db.Table("users").Select("id").Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+		logger.Error("Failed to find user by UUID", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(types.ErrorResponse{
+			Message: "Invalid user",
+			Status:  fiber.StatusUnauthorized,
+		})
+	}
+
+	batches, err := services.NewBatchingService(oc.db).AutoBatch(rule, user.ID, req.DryRun)
+	if err != nil {
+		logger.Error("Failed to auto batch orders", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to create batches",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	totalOrders := 0
+	for _, batch := range batches {
+		totalOrders += batch.TotalOrders
+	}
+
+	if len(batches) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
+			Message: "No unbatched orders found",
+			Status:  fiber.StatusNotFound,
+		})
+	}
+
+	message := "Order batches created successfully"
+	status := fiber.StatusCreated
+	if req.DryRun {
+		message = "Order batches planned, nothing was created"
+		status = fiber.StatusOK
+	} else {
+		logger.Success(fmt.Sprintf("Auto batched %d orders into %d batches by %s", totalOrders, len(batches), strings.Join(rule.GroupBy, ", ")))
+	}
+
+	return c.Status(status).JSON(types.ApiResponse{
+		Message: message,
+		Status:  status,
+		Data: fiber.Map{
+			"batches":        batches,
+			"total_batches":  len(batches),
+			"total_orders":   totalOrders,
+			"group_by":       rule.GroupBy,
+			"max_batch_size": rule.MaxBatchSize,
+			"dry_run":        req.DryRun,
+		},
+	})
+}
+
+// ImportOrders is the HTTP bulk-import order source. It accepts a JSON or
+// CSV voter list, either as a multipart "file" upload or as the raw request
+// body, and runs every message through the same ingestion pipeline as Kafka.
+func (oc *OrderController) ImportOrders(c *fiber.Ctx) error {
+	var name string
+	var data []byte
+
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			logger.Error("Failed to open uploaded order file", err)
+			return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+				Message: "Failed to read uploaded file",
+				Status:  fiber.StatusBadRequest,
+			})
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			logger.Error("Failed to read uploaded order file", err)
+			return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+				Message: "Failed to read uploaded file",
+				Status:  fiber.StatusBadRequest,
+			})
+		}
+		name = fileHeader.Filename
+	} else {
+		data = c.Body()
+		name = "request.json"
+		if strings.Contains(c.Get(fiber.HeaderContentType), "csv") {
+			name = "request.csv"
+		}
+	}
+
+	if len(data) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "No orders supplied",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	summary, err := services.NewIngestService(oc.db).ImportFile(services.SourceHTTP, name, data)
+	if err != nil {
+		logger.Error("Failed to import orders", err)
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidOrderFile) {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(types.ErrorResponse{
+			Message: fmt.Sprintf("Failed to import orders: %s", err.Error()),
+			Status:  status,
+			Data:    summary,
+		})
+	}
+
+	logger.Success(fmt.Sprintf("Imported %s: %d message(s), %d skipped", summary.Import, summary.Total, summary.Skipped))
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Orders imported",
+		Status:  fiber.StatusOK,
+		Data:    summary,
+	})
+}
@@ -5,13 +5,18 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strings"
+
+	"printprotocol"
 )
 
 // ValidateAuthToken validates the authentication message from the client
-// This validation is based on hardware fingerprinting without external JWT verification
-func ValidateAuthToken(authMsg *AuthMessage) (bool, error) {
+// This validation is based on hardware fingerprinting without external JWT verification.
+// The token can be derived by anyone who knows the machine details, so it is
+// only accepted from clients without an enrollment key while
+// PRINT_CLIENT_LEGACY_AUTH is set; see authenticateClient.
+func ValidateAuthToken(authMsg *printprotocol.Auth) (bool, error) {
 	// 1. Structural Validation
-	if authMsg.Type != "auth" {
+	if authMsg.Type != printprotocol.TypeAuth {
 		return false, fmt.Errorf("invalid message type: expected 'auth', got '%s'", authMsg.Type)
 	}
 
@@ -53,6 +58,6 @@ func ValidateAuthToken(authMsg *AuthMessage) (bool, error) {
 }
 
 // ValidateToken is an alias for ValidateAuthToken for backward compatibility
-func ValidateToken(authMsg *AuthMessage) (bool, error) {
+func ValidateToken(authMsg *printprotocol.Auth) (bool, error) {
 	return ValidateAuthToken(authMsg)
 }
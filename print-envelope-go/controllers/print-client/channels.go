@@ -2,7 +2,7 @@ package printclient
 
 import (
 	"log"
-	"printenvelope/types"
+	"printprotocol"
 	"sync"
 	"time"
 )
@@ -16,14 +16,14 @@ var (
 	unDeliveredMessages sync.Map
 
 	// Channels for message passing (replacing RabbitMQ queues)
-	undeliveredChan      = make(chan UndeliveredMsg, 10000) // Buffer for undelivered messages
-	subscribeChan        = make(chan *Subscription, 10000)  // Subscription requests
-	unsubscribeChan      = make(chan Unsubscription, 10000) // Unsubscribe requests
-	broadcastChan        = make(chan BroadcastMsg, 10000)   // Broadcast messages
-	internalMsgChan      = make(chan ChannelMsg, 10000)     // Internal messages (replaces RabbitMQ)
-	upstreamLogsChan     = make(chan UpstreamMsg, 10000)    // Upstream log messages
-	printJobChan         = make(chan types.PrintJob, 10000) // Print job queue
-	channelSubscriptions sync.Map                           // Map to store channel subscriptions
+	undeliveredChan      = make(chan UndeliveredMsg, 10000)    // Buffer for undelivered messages
+	subscribeChan        = make(chan *Subscription, 10000)     // Subscription requests
+	unsubscribeChan      = make(chan Unsubscription, 10000)    // Unsubscribe requests
+	broadcastChan        = make(chan BroadcastMsg, 10000)      // Broadcast messages
+	internalMsgChan      = make(chan ChannelMsg, 10000)        // Internal messages (replaces RabbitMQ)
+	upstreamLogsChan     = make(chan UpstreamMsg, 10000)       // Upstream log messages
+	printJobChan         = make(chan printprotocol.Job, 10000) // Print job queue
+	channelSubscriptions sync.Map                              // Map to store channel subscriptions
 )
 
 // ChannelService manages channel-based messaging
@@ -59,6 +59,10 @@ func (cs *ChannelService) Start() {
 	cs.wg.Add(1)
 	go cs.cleanUndeliveredMessages()
 
+	// Start eviction of silent sessions
+	cs.wg.Add(1)
+	go cs.staleSessionSweeper()
+
 	log.Println("✅ Channel Service started successfully")
 }
 
@@ -107,29 +111,51 @@ func (cs *ChannelService) channelWorker(workerID int) {
 
 // processSubscription handles new subscriptions
 func (cs *ChannelService) processSubscription(sub *Subscription) {
-	subscriptionKey := sub.ChannelName + sub.UserUUID
-	channelSubscriptions.Store(subscriptionKey, sub)
-	log.Printf("User %s subscribed to channel: %s", sub.UserUUID, sub.ChannelName)
+	subscribe(sub)
 }
 
 // processUnsubscription handles unsubscription requests
 func (cs *ChannelService) processUnsubscription(unsub Unsubscription) {
+	if unsub.Session != nil {
+		unsubscribe(unsub.Session)
+		return
+	}
+
 	subscriptionKey := unsub.ChannelName + unsub.UserUUID
 
 	if value, ok := channelSubscriptions.Load(subscriptionKey); ok {
-		if _, ok := value.(*Subscription); ok {
-			channelSubscriptions.Delete(subscriptionKey)
-			log.Printf("User %s unsubscribed from channel: %s", unsub.UserUUID, unsub.ChannelName)
+		if sub, ok := value.(*Subscription); ok {
+			// Closing the session ends its read loop, which unsubscribes it
+			// and reports the disconnect
+			evictSession(sub, "Disconnected by server")
 		} else {
 			log.Printf("Unexpected type for channelSubscriptions[%s]", subscriptionKey)
 		}
-	} else {
+	} else if r := router(); r == nil || !r.Forward(Route{Kind: routeDisconnect, PrinterID: unsub.UserUUID, Reason: "Disconnected by server"}) {
 		log.Printf("No subscriptions found: %s", subscriptionKey)
 	}
 }
 
-// processBroadcast sends messages to subscribed clients
+// processBroadcast sends messages to subscribed clients, forwarding them
+// to the instance holding the session of a client connected elsewhere
 func (cs *ChannelService) processBroadcast(broadcast BroadcastMsg) {
+	if _, ok := channelSubscriptions.Load(broadcast.Channel + broadcast.UserUUID); !ok {
+		if r := router(); r != nil && r.Forward(Route{
+			Kind:      routePush,
+			PrinterID: broadcast.UserUUID,
+			Channel:   broadcast.Channel,
+			Message:   broadcast.Message,
+		}) {
+			log.Printf("📡 Forwarded broadcast for %s to its node", broadcast.UserUUID)
+			return
+		}
+	}
+	deliverBroadcast(broadcast)
+}
+
+// deliverBroadcast sends a message to a client subscribed on this instance,
+// keeping it as undelivered when the client is not
+func deliverBroadcast(broadcast BroadcastMsg) {
 	subscriptionKey := broadcast.Channel + broadcast.UserUUID
 	log.Printf("🔔 Processing broadcast for key: %s, message: %s", subscriptionKey, broadcast.Message)
 
@@ -235,7 +261,7 @@ func PushNotification(channel, userUUID, message string) {
 }
 
 // PublishPrintJob publishes a print job to the job channel
-func PublishPrintJob(job types.PrintJob) {
+func PublishPrintJob(job printprotocol.Job) {
 	printJobChan <- job
 }
 
@@ -278,6 +304,6 @@ func GetUpstreamLogsChannel() chan UpstreamMsg {
 }
 
 // GetPrintJobChannel returns the print job channel for external use
-func GetPrintJobChannel() chan types.PrintJob {
+func GetPrintJobChannel() chan printprotocol.Job {
 	return printJobChan
 }
@@ -0,0 +1,265 @@
+package printclient
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"printenvelope/models/print"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// presenceRenewInterval is how often an instance renews its presence rows.
+// It must stay well below presenceTTL.
+const presenceRenewInterval = 15 * time.Second
+
+// Router lets any server instance reach any printer. Printer sessions live
+// on the instance the client connected to; the presence registry records
+// which one that is, and routes for a printer on another instance travel
+// through the fan-out backend. Print jobs themselves stay in the outbox,
+// so a route only tells the printer's instance to deliver them.
+type Router struct {
+	node     string
+	fanOut   FanOut
+	presence PresenceRegistry
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRouter creates a router for this instance. PRINT_CLIENT_FANOUT selects
+// the backend: "postgres" (the default when there is a database) routes
+// between instances sharing the database with LISTEN/NOTIFY; "local" keeps
+// everything in process for a single instance.
+func NewRouter(db *gorm.DB) *Router {
+	router := &Router{
+		node:     nodeID(),
+		stopChan: make(chan struct{}),
+	}
+
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("PRINT_CLIENT_FANOUT")))
+	switch {
+	case backend == "local" || db == nil:
+		router.fanOut = NewLocalFanOut()
+		router.presence = NewMemoryPresence()
+	default:
+		if backend != "" && backend != "postgres" {
+			log.Printf("Unknown PRINT_CLIENT_FANOUT %q, using postgres", backend)
+		}
+		router.fanOut = NewPostgresFanOut(db)
+		router.presence = NewPostgresPresence(db)
+	}
+	return router
+}
+
+// nodeID identifies this instance, read from PRINT_CLIENT_NODE_ID or made
+// from the hostname and a random suffix so restarts get a new one
+func nodeID() string {
+	if node := strings.TrimSpace(os.Getenv("PRINT_CLIENT_NODE_ID")); node != "" {
+		return node
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "node"
+	}
+	return host + "-" + uuid.New().String()[:8]
+}
+
+// router returns the router of the running service, if any
+func router() *Router {
+	if globalPrintClientService == nil {
+		return nil
+	}
+	return globalPrintClientService.router
+}
+
+// Start begins listening for routes and renewing this instance's presence.
+// Sessions left under this node ID by an earlier run are dropped first.
+func (r *Router) Start() {
+	if err := r.presence.Release(r.node); err != nil {
+		log.Printf("📡 Failed to clear earlier presence of node %s: %v", r.node, err)
+	}
+	if err := r.fanOut.Listen(r.handle); err != nil {
+		log.Printf("📡 Failed to listen for routes: %v", err)
+	}
+
+	r.wg.Add(1)
+	go r.renewWorker()
+
+	log.Printf("✅ Router started on node %s with %s fan-out", r.node, r.fanOut.Name())
+}
+
+// Stop stops routing and forgets this instance's sessions
+func (r *Router) Stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+	if err := r.fanOut.Close(); err != nil {
+		log.Printf("📡 Failed to close %s fan-out: %v", r.fanOut.Name(), err)
+	}
+	if err := r.presence.Release(r.node); err != nil {
+		log.Printf("📡 Failed to release presence of node %s: %v", r.node, err)
+	}
+	log.Println("✅ Router stopped")
+}
+
+// renewWorker periodically renews this instance's presence rows
+func (r *Router) renewWorker() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(presenceRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.presence.Renew(r.node); err != nil {
+				log.Printf("📡 Failed to renew presence of node %s: %v", r.node, err)
+			}
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// Connected records a new session on this instance. A session the printer
+// still has on another instance is closed there, as a local one is by
+// subscribe.
+func (r *Router) Connected(sub *Subscription) {
+	previous, err := r.presence.Connected(print.PrintClientPresence{
+		PrinterID:       sub.UserUUID,
+		NodeID:          r.node,
+		ProtocolVersion: sub.ProtocolVersion,
+		ConnectedAt:     sub.ConnectedAt,
+	})
+	if err != nil {
+		log.Printf("📡 Failed to record presence of printer %s: %v", sub.UserUUID, err)
+		return
+	}
+	if previous != "" && previous != r.node {
+		log.Printf("🔁 Printer %s moved from node %s, closing its session there", sub.UserUUID, previous)
+		r.publish(Route{
+			Node:      previous,
+			Kind:      routeDisconnect,
+			PrinterID: sub.UserUUID,
+			Reason:    "Replaced by a new connection",
+			Replaced:  true,
+		})
+	}
+}
+
+// Disconnected forgets a session that ended on this instance
+func (r *Router) Disconnected(sub *Subscription) {
+	if err := r.presence.Disconnected(sub.UserUUID, r.node); err != nil {
+		log.Printf("📡 Failed to clear presence of printer %s: %v", sub.UserUUID, err)
+	}
+}
+
+// remote returns the printer's session if it is on another instance
+func (r *Router) remote(printerID string) *print.PrintClientPresence {
+	presence, err := r.presence.Locate(printerID)
+	if err != nil {
+		log.Printf("📡 Failed to locate printer %s: %v", printerID, err)
+		return nil
+	}
+	if presence == nil || presence.NodeID == r.node {
+		return nil
+	}
+	return presence
+}
+
+// Online returns every printer with a session on any instance
+func (r *Router) Online() map[string]print.PrintClientPresence {
+	list, err := r.presence.Online()
+	if err != nil {
+		log.Printf("📡 Failed to list online printers: %v", err)
+	}
+	online := make(map[string]print.PrintClientPresence, len(list))
+	for _, presence := range list {
+		online[presence.PrinterID] = presence
+	}
+	return online
+}
+
+// Forward sends a route to the instance holding the printer's session and
+// reports whether the printer is connected to another instance
+func (r *Router) Forward(route Route) bool {
+	presence := r.remote(route.PrinterID)
+	if presence == nil {
+		return false
+	}
+	route.Node = presence.NodeID
+	return r.publish(route)
+}
+
+// publish sends a route from this instance
+func (r *Router) publish(route Route) bool {
+	route.From = r.node
+	if err := r.fanOut.Publish(route); err != nil {
+		log.Printf("📡 Failed to publish %s route for printer %s: %v", route.Kind, route.PrinterID, err)
+		return false
+	}
+	return true
+}
+
+// handle applies a route addressed to this instance. Routes are acted on
+// locally only, never forwarded again, so stale presence cannot bounce
+// them between instances.
+func (r *Router) handle(route Route) {
+	if route.From == r.node || (route.Node != "" && route.Node != r.node) {
+		return
+	}
+
+	switch route.Kind {
+	case routeDeliver:
+		if ob := outbox(); ob != nil {
+			ob.Deliver(route.PrinterID)
+		}
+	case routeReceipt:
+		if ob := outbox(); ob != nil {
+			ob.receiptArrived(route.MessageID)
+		}
+	case routePush:
+		deliverBroadcast(BroadcastMsg{
+			Channel:  route.Channel,
+			UserUUID: route.PrinterID,
+			Message:  route.Message,
+		})
+	case routeDisconnect:
+		sub := localSession(route.PrinterID)
+		if sub == nil {
+			return
+		}
+		if route.Replaced {
+			// The session lives on elsewhere, so this one must not report
+			// the printer as disconnected
+			unsubscribe(sub)
+		}
+		evictSession(sub, route.Reason)
+	default:
+		log.Printf("📡 Ignoring unknown %q route from node %s", route.Kind, route.From)
+	}
+}
+
+// localSession returns the printer's session on this instance, if any
+func localSession(printerID string) *Subscription {
+	if value, ok := channelSubscriptions.Load("printer-channel" + printerID); ok {
+		if sub, ok := value.(*Subscription); ok {
+			return sub
+		}
+	}
+	return nil
+}
+
+// closeSession closes the printer's session on whichever instance holds it
+func closeSession(printerID, reason string) bool {
+	if sub := localSession(printerID); sub != nil {
+		evictSession(sub, reason)
+		return true
+	}
+	if r := router(); r != nil {
+		return r.Forward(Route{Kind: routeDisconnect, PrinterID: printerID, Reason: reason})
+	}
+	return false
+}
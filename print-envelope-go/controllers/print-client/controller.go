@@ -1,9 +1,8 @@
 package printclient
 
 import (
-	"encoding/json"
 	"log"
-	"printenvelope/types"
+	"printenvelope/models/print"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -75,22 +74,76 @@ func (pcc *PrintClientController) GetMetrics(c *fiber.Ctx) error {
 // 	})
 // }
 
-// GetConnectedPrinters returns a list of connected printers
+// GetConnectedPrinters returns a list of printers connected to any instance
+// with the name, print center and enabled flag they are registered with
 func (pcc *PrintClientController) GetConnectedPrinters(c *fiber.Ctx) error {
 	var printers []map[string]interface{}
 
+	registered := make(map[string]print.Printer)
+	if registry := registeredPrinters(); registry != nil {
+		var list []print.Printer
+		if err := registry.db.Where("is_deleted = ?", false).Find(&list).Error; err != nil {
+			log.Printf("Failed to fetch registered printers: %v", err)
+		}
+		for _, printer := range list {
+			registered[printer.PrinterID] = printer
+		}
+	}
+
+	node := ""
+	var online map[string]print.PrintClientPresence
+	if r := router(); r != nil {
+		node = r.node
+		online = r.Online()
+	}
+
+	describe := func(entry map[string]interface{}, printerID string) {
+		if printer, ok := registered[printerID]; ok {
+			entry["registered"] = true
+			entry["id"] = printer.ID
+			entry["name"] = printer.Name
+			entry["print_center"] = printer.PrintCenter
+			entry["operator_id"] = printer.OperatorID
+			entry["enabled"] = printer.Enabled
+			entry["last_seen_at"] = printer.LastSeenAt
+		}
+		printers = append(printers, entry)
+	}
+
 	// Iterate through subscriptions
+	local := make(map[string]bool)
 	channelSubscriptions.Range(func(key, value interface{}) bool {
 		if sub, ok := value.(*Subscription); ok {
-			printers = append(printers, map[string]interface{}{
+			local[sub.UserUUID] = true
+			describe(map[string]interface{}{
 				"printer_id": sub.UserUUID,
 				"channel":    sub.ChannelName,
 				"connected":  !sub.Closed,
-			})
+				"registered": false,
+				"node":       node,
+
+				"connected_at":  sub.ConnectedAt,
+				"last_activity": sub.LastActivity(),
+			}, sub.UserUUID)
 		}
 		return true
 	})
 
+	// Printers connected to other instances
+	for printerID, presence := range online {
+		if local[printerID] || presence.NodeID == node {
+			continue
+		}
+		describe(map[string]interface{}{
+			"printer_id":   printerID,
+			"channel":      "printer-channel",
+			"connected":    true,
+			"registered":   false,
+			"node":         presence.NodeID,
+			"connected_at": presence.ConnectedAt,
+		}, printerID)
+	}
+
 	return c.JSON(fiber.Map{
 		"status":   "success",
 		"count":    len(printers),
@@ -120,23 +173,6 @@ func (pcc *PrintClientController) DisconnectPrinter(c *fiber.Ctx) error {
 	})
 }
 
-// SendPrintJobDirect sends a print job directly without HTTP context
-// Returns the job ID and any error that occurred
-func SendPrintJobDirect(data types.PrintJob) (string, error) {
-
-	// Convert to JSON
-	jobJSON, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("Failed to marshal print job: %v", err)
-		return "", err
-	}
-
-	// Send to printer via channel
-	PushNotification("printer-channel", data.PrinterID, string(jobJSON))
-
-	return data.JobID, nil
-}
-
 func generateJobID() string {
 	return uuid.New().String()
 }
@@ -0,0 +1,255 @@
+package printclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"printenvelope/models/print"
+	"printenvelope/types"
+	"printprotocol"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Resend backoff for unacknowledged messages: retryBaseDelay after the first
+// send, doubling on each attempt up to retryMaxDelay
+const (
+	retryBaseDelay = 15 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// ackWait is how long SendPrintJobDirect waits for a connected client to
+// acknowledge a job before reporting it as sent
+const ackWait = 5 * time.Second
+
+// retryBackoff returns the delay before resending a message sent attempts
+// times
+func retryBackoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// JobDelivery is the delivery state of a print job sent to a printer
+type JobDelivery struct {
+	JobID            string              `json:"job_id"`
+	MessageID        string              `json:"message_id"`
+	Status           print.MessageStatus `json:"status,omitempty"`
+	Attempts         int                 `json:"attempts"`
+	PrinterConnected bool                `json:"printer_connected"`
+	Reason           string              `json:"reason,omitempty"`
+	SentAt           *time.Time          `json:"sent_at,omitempty"`
+	AckedAt          *time.Time          `json:"acked_at,omitempty"`
+	NextAttemptAt    *time.Time          `json:"next_attempt_at,omitempty"`
+}
+
+// deliveryOf describes a queued message as a job delivery
+func deliveryOf(message print.PrintClientMessage) *JobDelivery {
+	return &JobDelivery{
+		JobID:            message.JobUuid,
+		MessageID:        message.MessageID,
+		Status:           message.Status,
+		Attempts:         message.Attempts,
+		PrinterConnected: connectedPrinterIDs()[message.PrinterID],
+		Reason:           message.LastError,
+		SentAt:           message.SentAt,
+		AckedAt:          message.AckedAt,
+		NextAttemptAt:    message.NextAttemptAt,
+	}
+}
+
+// SendPrintJobDirect queues a print job for its printer without HTTP
+// context and sends it right away if the printer is connected, to this
+// instance or, through the router, to another. A client
+// speaking protocol 1 or later is given up to ackWait to acknowledge it, so
+// the returned delivery tells whether the printer actually got the job.
+func SendPrintJobDirect(data printprotocol.Job) (*JobDelivery, error) {
+	data.Type = printprotocol.TypeJob
+	data.Version = printprotocol.Version
+	data.MessageID = uuid.New().String()
+
+	// Convert to JSON
+	jobJSON, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to marshal print job: %v", err)
+		return nil, err
+	}
+
+	ob := outbox()
+	if ob == nil {
+		// No queue without a database; send to printer via channel
+		PushNotification("printer-channel", data.PrinterID, string(jobJSON))
+		return &JobDelivery{JobID: data.JobID, MessageID: data.MessageID}, nil
+	}
+
+	message, err := ob.Enqueue(data.MessageID, data.PrinterID, data.JobID, data.Command, jobJSON)
+	if err != nil {
+		log.Printf("Failed to queue print job: %v", err)
+		return nil, err
+	}
+
+	receipt := ob.awaitReceipt(message.MessageID)
+	protocolVersion := -1
+	if sub := localSession(data.PrinterID); sub != nil {
+		ob.deliverTo(sub, false)
+		protocolVersion = sub.ProtocolVersion
+	} else if r := router(); r != nil {
+		if presence := r.remote(data.PrinterID); presence != nil && r.publish(Route{
+			Node:      presence.NodeID,
+			Kind:      routeDeliver,
+			PrinterID: data.PrinterID,
+		}) {
+			protocolVersion = presence.ProtocolVersion
+		}
+	}
+	if protocolVersion >= 1 {
+		select {
+		case <-receipt:
+		case <-time.After(ackWait):
+		}
+	}
+	ob.waiters.Delete(message.MessageID)
+
+	if err := ob.db.First(message, message.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload message %s: %w", message.MessageID, err)
+	}
+	return deliveryOf(*message), nil
+}
+
+// awaitReceipt returns a channel closed when the client acks or nacks a
+// message
+func (ob *Outbox) awaitReceipt(messageID string) chan struct{} {
+	receipt := make(chan struct{})
+	ob.waiters.Store(messageID, receipt)
+	return receipt
+}
+
+// receiptArrived wakes anyone waiting on a message's ack or nack
+func (ob *Outbox) receiptArrived(messageID string) {
+	if value, ok := ob.waiters.LoadAndDelete(messageID); ok {
+		close(value.(chan struct{}))
+	}
+}
+
+// receiptHandled wakes anyone waiting on a message's ack or nack, here or,
+// as the job may have been sent from there, on any other instance
+func (ob *Outbox) receiptHandled(messageID string) {
+	ob.receiptArrived(messageID)
+	if r := router(); r != nil {
+		r.publish(Route{Kind: routeReceipt, MessageID: messageID})
+	}
+}
+
+// HandleReceipt applies an ack or nack from a printer. An ack settles the
+// message; a nack means the client will not run the job, so the message is
+// not sent again and the job is failed with the client's reason.
+func (ob *Outbox) HandleReceipt(printerID string, receipt printprotocol.Receipt) {
+	if receipt.MessageID == "" {
+		log.Printf("📮 Printer %s sent %s without a message ID", printerID, receipt.Type)
+		return
+	}
+	defer ob.receiptHandled(receipt.MessageID)
+
+	now := time.Now()
+	pending := []print.MessageStatus{print.MessageQueued, print.MessageSent}
+	if receipt.Type == printprotocol.TypeAck {
+		if err := ob.db.Model(&print.PrintClientMessage{}).
+			Where("message_id = ? AND printer_id = ? AND status IN ?", receipt.MessageID, printerID, pending).
+			Updates(map[string]interface{}{"status": print.MessageAcked, "acked_at": now, "next_attempt_at": nil}).Error; err != nil {
+			log.Printf("📮 Failed to record ack of message %s: %v", receipt.MessageID, err)
+		}
+		return
+	}
+
+	reason := receipt.Reason
+	if reason == "" {
+		reason = "Printer refused the job"
+	}
+	var message print.PrintClientMessage
+	if err := ob.db.Where("message_id = ? AND printer_id = ?", receipt.MessageID, printerID).First(&message).Error; err != nil {
+		log.Printf("📮 Printer %s nacked unknown message %s: %s", printerID, receipt.MessageID, reason)
+		return
+	}
+	res := ob.db.Model(&message).Where("status IN ?", pending).Updates(map[string]interface{}{
+		"status":          print.MessageNacked,
+		"nacked_at":       now,
+		"next_attempt_at": nil,
+		"last_error":      reason,
+	})
+	if res.Error != nil {
+		log.Printf("📮 Failed to record nack of message %s: %v", receipt.MessageID, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		return
+	}
+	log.Printf("📮 Printer %s refused message %s (job %s): %s", printerID, message.MessageID, message.JobUuid, reason)
+	ob.undelivered(message, EventJobNacked, reason)
+}
+
+// retry resends the unacknowledged messages that are due to printers that
+// are connected
+func (ob *Outbox) retry() {
+	var printerIDs []string
+	if err := ob.db.Model(&print.PrintClientMessage{}).
+		Where("status = ? AND next_attempt_at <= ? AND expires_at > ?", print.MessageSent, time.Now(), time.Now()).
+		Distinct().Pluck("printer_id", &printerIDs).Error; err != nil {
+		log.Printf("📮 Failed to load messages due for retry: %v", err)
+		return
+	}
+
+	for _, printerID := range printerIDs {
+		value, ok := channelSubscriptions.Load("printer-channel" + printerID)
+		if !ok {
+			continue
+		}
+		if sub, ok := value.(*Subscription); ok {
+			ob.deliverTo(sub, false)
+		}
+	}
+}
+
+// JobDeliveryState returns the delivery state of a print job: the latest
+// message sent for it and all its messages, newest first
+func (pcc *PrintClientController) JobDeliveryState(c *fiber.Ctx) error {
+	ob := outbox()
+	if ob == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(types.ErrorResponse{
+			Message: "Message queue is not available",
+			Status:  fiber.StatusServiceUnavailable,
+		})
+	}
+
+	jobUuid := c.Params("job_uuid")
+	var messages []print.PrintClientMessage
+	if err := ob.db.Where("job_uuid = ?", jobUuid).Order("id DESC").Find(&messages).Error; err != nil {
+		log.Printf("Failed to fetch messages of job %s: %v", jobUuid, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch job delivery",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+	if len(messages) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
+			Message: "No messages found for job",
+			Status:  fiber.StatusNotFound,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Job delivery fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"delivery": deliveryOf(messages[0]),
+			"messages": messages,
+		},
+	})
+}
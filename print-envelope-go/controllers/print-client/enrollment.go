@@ -0,0 +1,369 @@
+package printclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"printenvelope/models/print"
+	"printenvelope/models/user"
+	"printenvelope/types"
+	"printprotocol"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// challengeTimeout bounds the wait for the client's signed nonce
+const challengeTimeout = 10 * time.Second
+
+// legacyAuthAllowed reports whether clients without an enrollment key may
+// still sign in with the hardware-hash token. It is meant only for rolling
+// out enrollment and is off unless PRINT_CLIENT_LEGACY_AUTH is true.
+func legacyAuthAllowed() bool {
+	allowed, _ := strconv.ParseBool(os.Getenv("PRINT_CLIENT_LEGACY_AUTH"))
+	return allowed
+}
+
+// decodePublicKey parses a base64 Ed25519 public key and returns it with its
+// fingerprint
+func decodePublicKey(encoded string) (ed25519.PublicKey, string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, "", fmt.Errorf("public key is not valid base64: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, "", fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	sum := sha256.Sum256(raw)
+	return ed25519.PublicKey(raw), hex.EncodeToString(sum[:]), nil
+}
+
+// Enroll returns the enrollment of the client's key, recording it as pending
+// the first time the key is presented. A key is bound to the printer it was
+// first presented for.
+func (pr *PrinterRegistry) Enroll(auth *printprotocol.Auth) (*print.PrintClientEnrollment, error) {
+	_, fingerprint, err := decodePublicKey(auth.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	enrollment := print.PrintClientEnrollment{
+		PrinterID:     auth.Token,
+		PublicKey:     strings.TrimSpace(auth.PublicKey),
+		Fingerprint:   fingerprint,
+		Status:        print.EnrollmentPending,
+		Platform:      auth.Platform,
+		Processor:     auth.Processor,
+		HardwareID:    auth.HardwareID,
+		ClientVersion: auth.ClientVersion,
+		LastAttemptAt: now,
+	}
+	if err := pr.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "fingerprint"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"client_version":  auth.ClientVersion,
+			"last_attempt_at": now,
+			"updated_at":      now,
+		}),
+	}).Create(&enrollment).Error; err != nil {
+		return nil, fmt.Errorf("failed to record enrollment for %s: %w", auth.Token, err)
+	}
+
+	if err := pr.db.Where("fingerprint = ?", fingerprint).First(&enrollment).Error; err != nil {
+		return nil, err
+	}
+	if enrollment.PrinterID != auth.Token {
+		return nil, fmt.Errorf("key %s is enrolled for printer %s", fingerprint, enrollment.PrinterID)
+	}
+	return &enrollment, nil
+}
+
+// authenticateClient verifies an authenticating client. Clients presenting
+// a key must have it approved and then sign a fresh nonce; clients without
+// one are only let in through the legacy token check when that is allowed.
+// It writes to the connection directly, so it must run before the write
+// handler starts.
+func authenticateClient(c *websocket.Conn, auth *printprotocol.Auth) error {
+	if strings.TrimSpace(auth.PublicKey) == "" {
+		if !legacyAuthAllowed() {
+			_ = c.WriteJSON(printprotocol.AuthResult{
+				Type:    printprotocol.TypeEnrollment,
+				Status:  "UNENROLLED",
+				Message: "This server requires an enrolled client key, please update the print client",
+			})
+			return errors.New("client did not present an enrollment key")
+		}
+		_, err := ValidateAuthToken(auth)
+		return err
+	}
+
+	if auth.Type != printprotocol.TypeAuth || strings.TrimSpace(auth.Token) == "" {
+		return errors.New("auth message has no printer ID")
+	}
+	registry := registeredPrinters()
+	if registry == nil {
+		return errors.New("enrollment store is not available")
+	}
+
+	enrollment, err := registry.Enroll(auth)
+	if err != nil {
+		return err
+	}
+	if enrollment.Status != print.EnrollmentApproved {
+		message := "Waiting for an administrator to approve this client"
+		switch enrollment.Status {
+		case print.EnrollmentRejected:
+			message = "Enrollment of this client was rejected"
+		case print.EnrollmentRevoked:
+			message = "Enrollment of this client was revoked"
+		}
+		_ = c.WriteJSON(printprotocol.AuthResult{
+			Type:        printprotocol.TypeEnrollment,
+			Status:      string(enrollment.Status),
+			Fingerprint: enrollment.Fingerprint,
+			Message:     message,
+		})
+		return fmt.Errorf("enrollment %s is %s", enrollment.Fingerprint, enrollment.Status)
+	}
+
+	nonceBytes := make([]byte, 32)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return fmt.Errorf("failed to create nonce: %w", err)
+	}
+	nonce := base64.StdEncoding.EncodeToString(nonceBytes)
+	if err := c.WriteJSON(printprotocol.Challenge{Type: printprotocol.TypeChallenge, Nonce: nonce}); err != nil {
+		return fmt.Errorf("failed to send challenge: %w", err)
+	}
+
+	if err := c.SetReadDeadline(time.Now().Add(challengeTimeout)); err != nil {
+		return err
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("no challenge response: %w", err)
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	var response printprotocol.ChallengeResponse
+	if err := json.Unmarshal(message, &response); err != nil || response.Type != printprotocol.TypeChallengeResponse {
+		return errors.New("expected a challenge response")
+	}
+	signature, err := base64.StdEncoding.DecodeString(response.Signature)
+	if err != nil {
+		return fmt.Errorf("signature is not valid base64: %w", err)
+	}
+	key, _, err := decodePublicKey(enrollment.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, printprotocol.ChallengePayload(auth.Token, nonce), signature) {
+		return fmt.Errorf("signature does not match enrolled key %s", enrollment.Fingerprint)
+	}
+
+	now := time.Now()
+	if err := registry.db.Model(enrollment).Update("last_auth_at", now).Error; err != nil {
+		log.Printf("Failed to record authentication of enrollment %d: %v", enrollment.ID, err)
+	}
+	return c.WriteJSON(printprotocol.AuthResult{
+		Type:            printprotocol.TypeAuthOK,
+		Status:          string(enrollment.Status),
+		Fingerprint:     enrollment.Fingerprint,
+		ProtocolVersion: printprotocol.Negotiate(printprotocol.Version, auth.ProtocolVersion),
+	})
+}
+
+// ListEnrollments lists print client enrollments, newest first. Filters:
+// status and printer_id.
+func (pcc *PrintClientController) ListEnrollments(c *fiber.Ctx) error {
+	registry := registeredPrinters()
+	if registry == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(types.ErrorResponse{
+			Message: "Printer registry is not available",
+			Status:  fiber.StatusServiceUnavailable,
+		})
+	}
+
+	query := registry.db.Where("is_deleted = ?", false)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status IN ?", strings.Split(strings.ToUpper(status), ","))
+	}
+	if printerID := c.Query("printer_id"); printerID != "" {
+		query = query.Where("printer_id = ?", printerID)
+	}
+
+	var enrollments []print.PrintClientEnrollment
+	if err := query.Order("created_at DESC").Find(&enrollments).Error; err != nil {
+		log.Printf("Failed to fetch enrollments: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch enrollments",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Enrollments fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"enrollments": enrollments,
+			"total":       len(enrollments),
+		},
+	})
+}
+
+// ApproveEnrollment lets a pending key authenticate. Any other approved key
+// of the same printer is revoked, so approving a new key rotates it.
+func (pcc *PrintClientController) ApproveEnrollment(c *fiber.Ctx) error {
+	return pcc.reviewEnrollment(c, print.EnrollmentPending, print.EnrollmentApproved, "APPROVE_PRINT_CLIENT")
+}
+
+// RejectEnrollment turns down a pending key
+func (pcc *PrintClientController) RejectEnrollment(c *fiber.Ctx) error {
+	return pcc.reviewEnrollment(c, print.EnrollmentPending, print.EnrollmentRejected, "REJECT_PRINT_CLIENT")
+}
+
+// RevokeEnrollment withdraws an approved key and drops the client's live
+// session; the client cannot authenticate with the key again
+func (pcc *PrintClientController) RevokeEnrollment(c *fiber.Ctx) error {
+	return pcc.reviewEnrollment(c, print.EnrollmentApproved, print.EnrollmentRevoked, "REVOKE_PRINT_CLIENT")
+}
+
+// reviewEnrollment moves an enrollment from one status to another, recording
+// the admin and note, and writes an admin log entry
+func (pcc *PrintClientController) reviewEnrollment(c *fiber.Ctx, from, to print.EnrollmentStatus, action string) error {
+	registry := registeredPrinters()
+	if registry == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(types.ErrorResponse{
+			Message: "Printer registry is not available",
+			Status:  fiber.StatusServiceUnavailable,
+		})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid enrollment ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	var req types.EnrollmentReviewRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+				Message: "Invalid request payload",
+				Status:  fiber.StatusBadRequest,
+			})
+		}
+	}
+	admin, errResp := registry.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	var enrollment print.PrintClientEnrollment
+	var rotated []print.PrintClientEnrollment
+	err = registry.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_deleted = ?", id, false).First(&enrollment).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fiber.NewError(fiber.StatusNotFound, "Enrollment not found")
+			}
+			return err
+		}
+		if enrollment.Status != from {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Enrollment is %s, only %s enrollments can be changed to %s", enrollment.Status, from, to))
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{"status": to}
+		if to == print.EnrollmentRevoked {
+			updates["revoked_by_id"] = admin.ID
+			updates["revoked_at"] = now
+			updates["revoke_reason"] = req.Note
+		} else {
+			updates["reviewed_by_id"] = admin.ID
+			updates["reviewed_at"] = now
+			updates["review_note"] = req.Note
+		}
+		if err := tx.Model(&enrollment).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if to == print.EnrollmentApproved {
+			if err := tx.Where("printer_id = ? AND status = ? AND id <> ? AND is_deleted = ?",
+				enrollment.PrinterID, print.EnrollmentApproved, enrollment.ID, false).Find(&rotated).Error; err != nil {
+				return err
+			}
+			for i := range rotated {
+				if err := tx.Model(&rotated[i]).Updates(map[string]interface{}{
+					"status":        print.EnrollmentRevoked,
+					"revoked_by_id": admin.ID,
+					"revoked_at":    now,
+					"revoke_reason": fmt.Sprintf("Replaced by enrollment %d", enrollment.ID),
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     admin.ID,
+			AdminUUID:   admin.Uuid,
+			Action:      action,
+			EntityType:  "PRINT_CLIENT_ENROLLMENT",
+			EntityID:    enrollment.ID,
+			Description: fmt.Sprintf("Enrollment %s of printer %s changed from %s to %s", enrollment.Fingerprint, enrollment.PrinterID, from, to),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err != nil {
+		if fiberErr, ok := err.(*fiber.Error); ok {
+			return c.Status(fiberErr.Code).JSON(types.ErrorResponse{
+				Message: fiberErr.Message,
+				Status:  fiberErr.Code,
+			})
+		}
+		log.Printf("Failed to review enrollment %d: %v", id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to update enrollment",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	// A revoked key must not keep its session; a rotated key's session is
+	// ended too so the printer reconnects with the new one
+	if to == print.EnrollmentRevoked || len(rotated) > 0 {
+		disconnectPrinter(enrollment.PrinterID)
+	}
+	log.Printf("Enrollment %d of printer %s is now %s", enrollment.ID, enrollment.PrinterID, enrollment.Status)
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: fmt.Sprintf("Enrollment %s", strings.ToLower(string(to))),
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"enrollment": enrollment,
+			"revoked":    rotated,
+		},
+	})
+}
+
+// disconnectPrinter closes the live session of a printer, if it has one,
+// on whichever instance holds it
+func disconnectPrinter(printerID string) {
+	closeSession(printerID, "Enrollment revoked")
+}
@@ -0,0 +1,351 @@
+package printclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"printenvelope/models/order"
+	"printenvelope/models/print"
+	"printprotocol"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Events the server records itself, next to those the client reports (see
+// printprotocol)
+const (
+	EventPrinterConnected    = "printer-connected"
+	EventPrinterDisconnected = "printer-disconnected"
+
+	// A job's message expired unacknowledged or the client refused it
+	EventJobExpired = "job-expired"
+	EventJobNacked  = "job-nacked"
+
+	// A processing job the client stopped reporting on was failed so it
+	// could be resumed
+	EventJobStalled = "job-stalled"
+)
+
+// unfinishedStatuses are the job statuses client events may still move on
+var unfinishedStatuses = []print.PrintJobStatus{print.PrintJobPending, print.PrintJobProcessing}
+
+// processLogMessage persists an upstream log message and applies job events
+// to the batch job they belong to. Events about a job sent to another
+// printer are recorded without touching that job.
+func (up *UpstreamProcessor) processLogMessage(logMsg UpstreamMsg, workerID int) {
+	log.Printf("📤 Worker %d - Upstream Log: Type=%s, Event=%s, ID=%s, JobID=%s, Message=%s",
+		workerID, logMsg.Type, logMsg.Event, logMsg.ID, logMsg.JobID, logMsg.Message)
+
+	if up.db == nil {
+		return
+	}
+
+	record := print.PrintClientEvent{
+		PrinterID:     logMsg.ID,
+		Type:          logMsg.Type,
+		Event:         logMsg.Event,
+		JobUuid:       logMsg.JobID,
+		Message:       logMsg.Message,
+		ClientVersion: logMsg.ClientVersion,
+	}
+
+	var batchJob *print.PrintBatchJob
+	if logMsg.JobID != "" {
+		var found print.PrintBatchJob
+		err := up.db.Where("job_uuid = ? AND is_deleted = ?", logMsg.JobID, false).First(&found).Error
+		if err == nil && found.PrinterID != logMsg.ID {
+			log.Printf("📤 Worker %d - Rejected %s from printer %s for job %s owned by printer %s",
+				workerID, logMsg.Event, logMsg.ID, logMsg.JobID, found.PrinterID)
+		} else if err == nil {
+			batchJob = &found
+			record.PrintBatchJobID = &found.ID
+		} else if err != gorm.ErrRecordNotFound {
+			log.Printf("📤 Worker %d - Failed to look up job %s: %v", workerID, logMsg.JobID, err)
+		}
+	}
+
+	if err := up.db.Create(&record).Error; err != nil {
+		log.Printf("📤 Worker %d - Failed to save print client event: %v", workerID, err)
+	}
+
+	// Any event for a job shows the client received it
+	if logMsg.JobID != "" {
+		if ob := outbox(); ob != nil {
+			ob.AckedByJob(logMsg.ID, logMsg.JobID)
+		}
+	}
+
+	// Only live prints change job status; specimen and test prints are
+	// recorded but leave the job untouched
+	if batchJob == nil || batchJob.Command != printprotocol.CommandLivePrint {
+		return
+	}
+	if err := applyJobEvent(up.db, batchJob, logMsg); err != nil {
+		log.Printf("📤 Worker %d - Failed to apply %s to job %s: %v", workerID, logMsg.Event, logMsg.JobID, err)
+	}
+}
+
+// applyJobEvent maps a client job event onto batch and single job status.
+// Completed and failed are terminal, so late or repeated events are ignored.
+func applyJobEvent(db *gorm.DB, batchJob *print.PrintBatchJob, logMsg UpstreamMsg) error {
+	switch logMsg.Event {
+	case printprotocol.EventLivePrintSent, printprotocol.EventJobQueued, printprotocol.EventJobSpooling, printprotocol.EventJobPrinting, printprotocol.EventJobRendering, printprotocol.EventJobProgress:
+		return markJobProcessing(db, batchJob)
+	case printprotocol.EventJobPagesPrinted:
+		return applyPagesPrinted(db, batchJob, logMsg)
+	case printprotocol.EventJobCompleted:
+		return finishJob(db, batchJob, logMsg, print.PrintJobCompleted)
+	case printprotocol.EventJobFailed, printprotocol.EventPrintFailed, printprotocol.EventLivePDFFailed:
+		return finishJob(db, batchJob, logMsg, print.PrintJobFailed)
+	}
+	return nil
+}
+
+// FailStalledJob fails a processing job the print client has stopped
+// reporting on, as a job-failed event from the client would, so it can be
+// resumed. Messages for the job still awaiting an ack are expired so the
+// job is not sent to the printer again. tx is the caller's transaction.
+func FailStalledJob(tx *gorm.DB, batchJob *print.PrintBatchJob, reason string) error {
+	now := time.Now()
+	if err := tx.Model(&print.PrintClientMessage{}).
+		Where("job_uuid = ? AND status IN ?", batchJob.JobUuid, []print.MessageStatus{print.MessageQueued, print.MessageSent}).
+		Updates(map[string]interface{}{"status": print.MessageExpired, "expired_at": now, "next_attempt_at": nil, "last_error": reason}).Error; err != nil {
+		return fmt.Errorf("failed to expire messages of job %s: %w", batchJob.JobUuid, err)
+	}
+
+	event := UpstreamMsg{
+		ID:      batchJob.PrinterID,
+		Type:    "server",
+		Event:   EventJobStalled,
+		JobID:   batchJob.JobUuid,
+		Message: reason,
+	}
+	if err := tx.Create(&print.PrintClientEvent{
+		PrinterID:       event.ID,
+		Type:            event.Type,
+		Event:           event.Event,
+		JobUuid:         event.JobID,
+		PrintBatchJobID: &batchJob.ID,
+		Message:         reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record stall of job %s: %w", batchJob.JobUuid, err)
+	}
+	return finishJob(tx, batchJob, event, print.PrintJobFailed)
+}
+
+// markJobProcessing moves a pending job and its orders to processing
+func markJobProcessing(db *gorm.DB, batchJob *print.PrintBatchJob) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&print.PrintBatchJob{}).
+			Where("id = ? AND status = ?", batchJob.ID, print.PrintJobPending).
+			Update("status", print.PrintJobProcessing)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&print.PrintSingleJob{}).
+			Where("print_batch_job_id = ? AND status = ? AND is_deleted = ?", batchJob.ID, print.PrintJobPending, false).
+			Update("status", print.PrintJobProcessing).Error
+	})
+}
+
+// finishJob settles every unfinished single job of the batch with status,
+// records an OrderPrinted or OrderPrintFailed event for each order and
+// recounts the batch totals
+func finishJob(db *gorm.DB, batchJob *print.PrintBatchJob, logMsg UpstreamMsg, status print.PrintJobStatus) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		batchUpdates := map[string]interface{}{"status": status}
+		if status == print.PrintJobCompleted {
+			batchUpdates["completed_at"] = time.Now()
+		} else {
+			batchUpdates["error_message"] = logMsg.Message
+		}
+		res := tx.Model(&print.PrintBatchJob{}).
+			Where("id = ? AND status IN ?", batchJob.ID, unfinishedStatuses).
+			Updates(batchUpdates)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		var singleJobs []print.PrintSingleJob
+		if err := tx.Where("print_batch_job_id = ? AND status IN ? AND is_deleted = ?", batchJob.ID, unfinishedStatuses, false).
+			Find(&singleJobs).Error; err != nil {
+			return err
+		}
+		if err := settleSingleJobs(tx, batchJob, singleJobs, logMsg, status); err != nil {
+			return err
+		}
+		return recountJob(tx, batchJob.ID)
+	})
+}
+
+// applyPagesPrinted marks the orders on the pages printed so far as printed.
+// The live PDF holds PagesPerOrder pages per order in sequence order, so only
+// orders whose every page has printed are settled; the rest stay unfinished
+// and are failed, and can be resumed, if the job stops part way.
+func applyPagesPrinted(db *gorm.DB, batchJob *print.PrintBatchJob, logMsg UpstreamMsg) error {
+	if logMsg.PagesPrinted <= 0 {
+		return nil
+	}
+	if err := markJobProcessing(db, batchJob); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var current print.PrintBatchJob
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", batchJob.ID).First(&current).Error; err != nil {
+			return err
+		}
+		if current.Status != print.PrintJobProcessing || logMsg.PagesPrinted <= current.PagesPrinted {
+			return nil
+		}
+
+		printedOrders := printedOrderCount(logMsg.PagesPrinted, current.PagesPerOrder)
+
+		// Same selection and order as the live PDF
+		var singleJobs []print.PrintSingleJob
+		if printedOrders > 0 {
+			if err := tx.Model(&print.PrintSingleJob{}).
+				Select("print_single_jobs.*").
+				Joins("JOIN print_job_data ON print_job_data.print_single_job_id = print_single_jobs.id").
+				Where("print_single_jobs.print_batch_job_id = ?", current.ID).
+				Where("print_single_jobs.is_deleted = ? AND print_job_data.is_deleted = ?", false, false).
+				Order("print_single_jobs.sequence ASC").
+				Limit(printedOrders).
+				Find(&singleJobs).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := settleSingleJobs(tx, &current, unsettledJobs(singleJobs), logMsg, print.PrintJobCompleted); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&print.PrintBatchJob{}).Where("id = ?", current.ID).
+			Update("pages_printed", logMsg.PagesPrinted).Error; err != nil {
+			return err
+		}
+		return recountJob(tx, current.ID)
+	})
+}
+
+// printedOrderCount is the number of orders whose every page is among the
+// first pagesPrinted pages of a PDF with pagesPerOrder pages per order. Jobs
+// without a recorded page count are taken to have one page per order.
+func printedOrderCount(pagesPrinted, pagesPerOrder int) int {
+	if pagesPerOrder <= 0 {
+		pagesPerOrder = 1
+	}
+	if pagesPrinted <= 0 {
+		return 0
+	}
+	return pagesPrinted / pagesPerOrder
+}
+
+// unsettledJobs returns the single jobs still pending or processing, leaving
+// out those a previous progress report or failure already settled
+func unsettledJobs(singleJobs []print.PrintSingleJob) []print.PrintSingleJob {
+	var unsettled []print.PrintSingleJob
+	for _, singleJob := range singleJobs {
+		if singleJob.Status == print.PrintJobPending || singleJob.Status == print.PrintJobProcessing {
+			unsettled = append(unsettled, singleJob)
+		}
+	}
+	return unsettled
+}
+
+// settleSingleJobs moves the given single jobs to status and records an
+// OrderPrinted or OrderPrintFailed event for each order, or OrderReprinted
+// and OrderReprintFailed for reprint jobs
+func settleSingleJobs(tx *gorm.DB, batchJob *print.PrintBatchJob, singleJobs []print.PrintSingleJob, logMsg UpstreamMsg, status print.PrintJobStatus) error {
+	if len(singleJobs) == 0 {
+		return nil
+	}
+
+	// Reprint jobs settle as reprinted or reprint failed
+	printedStatus, failedStatus, verb := order.OrderPrinted, order.OrderPrintFailed, "print"
+	if batchJob.ReprintRequestID != nil {
+		printedStatus, failedStatus, verb = order.OrderReprinted, order.OrderReprintFailed, "reprint"
+	}
+
+	singleUpdates := map[string]interface{}{"status": status}
+	eventStatus := printedStatus
+	if status == print.PrintJobCompleted {
+		singleUpdates["printed_at"] = time.Now()
+	} else {
+		singleUpdates["error_message"] = logMsg.Message
+		eventStatus = failedStatus
+	}
+
+	meta := map[string]interface{}{
+		"print_batch_job_id": batchJob.ID,
+		"batch_number":       batchJob.BatchNumber,
+		"job_uuid":           batchJob.JobUuid,
+		"job_type":           batchJob.JobType,
+		"printer_id":         logMsg.ID,
+		"client_event":       logMsg.Event,
+	}
+	if logMsg.PagesPrinted > 0 {
+		meta["pages_printed"] = logMsg.PagesPrinted
+	}
+	if batchJob.ReprintRequestID != nil {
+		meta["reprint_request_id"] = *batchJob.ReprintRequestID
+	}
+	metadata, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	metadataStr := string(metadata)
+
+	for _, singleJob := range singleJobs {
+		if err := tx.Model(&print.PrintSingleJob{}).Where("id = ?", singleJob.ID).Updates(singleUpdates).Error; err != nil {
+			return err
+		}
+
+		message := fmt.Sprintf("Order %d %sed in batch %s", singleJob.Sequence, verb, batchJob.BatchNumber)
+		if status != print.PrintJobCompleted {
+			message = fmt.Sprintf("Order %d failed to %s in batch %s: %s", singleJob.Sequence, verb, batchJob.BatchNumber, logMsg.Message)
+		}
+		if err := tx.Create(&order.OrderEvent{
+			OrderID:  singleJob.OrderID,
+			Status:   eventStatus,
+			Message:  message,
+			Metadata: &metadataStr,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recountJob refreshes the completed and failed counters of a batch job
+func recountJob(tx *gorm.DB, batchJobID uint) error {
+	var counts []struct {
+		Status print.PrintJobStatus
+		Count  int
+	}
+	if err := tx.Model(&print.PrintSingleJob{}).
+		Select("status, COUNT(*) AS count").
+		Where("print_batch_job_id = ? AND is_deleted = ?", batchJobID, false).
+		Group("status").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+
+	completed, failed := 0, 0
+	for _, c := range counts {
+		switch c.Status {
+		case print.PrintJobCompleted:
+			completed = c.Count
+		case print.PrintJobFailed:
+			failed = c.Count
+		}
+	}
+	return tx.Model(&print.PrintBatchJob{}).Where("id = ?", batchJobID).Updates(map[string]interface{}{
+		"completed_jobs": completed,
+		"failed_jobs":    failed,
+	}).Error
+}
@@ -0,0 +1,53 @@
+package printclient
+
+import (
+	"reflect"
+	"testing"
+
+	"printenvelope/models/print"
+)
+
+func TestPrintedOrderCount(t *testing.T) {
+	tests := []struct {
+		pagesPrinted  int
+		pagesPerOrder int
+		want          int
+	}{
+		{0, 1, 0},
+		{5, 1, 5},
+		// Kits: an order counts once all of its pages have printed
+		{5, 3, 1},
+		{6, 3, 2},
+		{2, 3, 0},
+		// Jobs from before the page count was recorded
+		{4, 0, 4},
+		{-1, 2, 0},
+	}
+	for _, tt := range tests {
+		if got := printedOrderCount(tt.pagesPrinted, tt.pagesPerOrder); got != tt.want {
+			t.Errorf("printedOrderCount(%d, %d) = %d, want %d", tt.pagesPrinted, tt.pagesPerOrder, got, tt.want)
+		}
+	}
+}
+
+func TestUnsettledJobs(t *testing.T) {
+	singleJobs := []print.PrintSingleJob{
+		{ID: 1, Sequence: 101, Status: print.PrintJobCompleted},
+		{ID: 2, Sequence: 102, Status: print.PrintJobPending},
+		{ID: 3, Sequence: 103, Status: print.PrintJobProcessing},
+		{ID: 4, Sequence: 104, Status: print.PrintJobFailed},
+		{ID: 5, Sequence: 105, Status: print.PrintJobCancelled},
+	}
+
+	var got []uint
+	for _, singleJob := range unsettledJobs(singleJobs) {
+		got = append(got, singleJob.ID)
+	}
+	if want := []uint{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unsettledJobs returned jobs %v, want %v", got, want)
+	}
+
+	if got := unsettledJobs(nil); len(got) != 0 {
+		t.Errorf("unsettledJobs(nil) = %v, want none", got)
+	}
+}
@@ -0,0 +1,196 @@
+package printclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// Route kinds carried between server instances
+const (
+	routeDeliver    = "deliver"    // send the printer's queued messages
+	routeReceipt    = "receipt"    // a message was acked or nacked
+	routePush       = "push"       // write a raw message to the printer
+	routeDisconnect = "disconnect" // close the printer's session
+)
+
+// Route is a message from one server instance to the instance holding a
+// printer's session, or to every instance when Node is empty
+type Route struct {
+	From      string `json:"from"`
+	Node      string `json:"node,omitempty"`
+	Kind      string `json:"kind"`
+	PrinterID string `json:"printer_id,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Replaced  bool   `json:"replaced,omitempty"`
+}
+
+// FanOut carries routes between server instances
+type FanOut interface {
+	// Name identifies the backend in logs
+	Name() string
+	// Publish sends a route to every listening instance
+	Publish(route Route) error
+	// Listen calls handle with every route published until Close
+	Listen(handle func(Route)) error
+	// Close stops listening
+	Close() error
+}
+
+// LocalFanOut hands routes to listeners in the same process. It serves a
+// single instance, where every printer is connected locally.
+type LocalFanOut struct {
+	mu       sync.RWMutex
+	handlers []func(Route)
+}
+
+// NewLocalFanOut creates an in-process fan-out
+func NewLocalFanOut() *LocalFanOut {
+	return &LocalFanOut{}
+}
+
+func (f *LocalFanOut) Name() string { return "local" }
+
+func (f *LocalFanOut) Publish(route Route) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, handle := range f.handlers {
+		go handle(route)
+	}
+	return nil
+}
+
+func (f *LocalFanOut) Listen(handle func(Route)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers = append(f.handlers, handle)
+	return nil
+}
+
+func (f *LocalFanOut) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers = nil
+	return nil
+}
+
+// routeChannel is the Postgres notification channel routes are sent on
+const routeChannel = "print_client_routes"
+
+// maxNotifyPayload is the largest payload Postgres accepts in a NOTIFY
+const maxNotifyPayload = 7999
+
+// listenRetryDelay is how long the listener waits before reconnecting
+const listenRetryDelay = 5 * time.Second
+
+// PostgresFanOut sends routes with Postgres NOTIFY and receives them on a
+// connection of its own that LISTENs for them, so instances sharing the
+// database need nothing else to reach each other
+type PostgresFanOut struct {
+	db     *gorm.DB
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPostgresFanOut creates a fan-out over db's LISTEN/NOTIFY
+func NewPostgresFanOut(db *gorm.DB) *PostgresFanOut {
+	return &PostgresFanOut{db: db}
+}
+
+func (f *PostgresFanOut) Name() string { return "postgres" }
+
+func (f *PostgresFanOut) Publish(route Route) error {
+	payload, err := json.Marshal(route)
+	if err != nil {
+		return fmt.Errorf("failed to marshal route: %w", err)
+	}
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("route of %d bytes is too large to notify", len(payload))
+	}
+	return f.db.Exec("SELECT pg_notify(?, ?)", routeChannel, string(payload)).Error
+}
+
+func (f *PostgresFanOut) Listen(handle func(Route)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.wg.Add(1)
+	go f.listen(ctx, handle)
+	return nil
+}
+
+func (f *PostgresFanOut) Close() error {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.wg.Wait()
+	return nil
+}
+
+// listen keeps a listening connection open, reconnecting after failures
+// until ctx is cancelled
+func (f *PostgresFanOut) listen(ctx context.Context, handle func(Route)) {
+	defer f.wg.Done()
+	for {
+		err := f.listenOnce(ctx, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("📡 Route listener failed: %v, reconnecting in %s", err, listenRetryDelay)
+		select {
+		case <-time.After(listenRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// listenOnce takes a connection from the pool, LISTENs on routeChannel
+// and handles notifications until the connection fails. The connection is
+// closed afterwards rather than returned to the pool still listening.
+func (f *PostgresFanOut) listenOnce(ctx context.Context, handle func(Route)) error {
+	sqlDB, err := f.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("database driver %T cannot listen for notifications", driverConn)
+		}
+		defer stdConn.Close()
+
+		pgConn := stdConn.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+routeChannel); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", routeChannel, err)
+		}
+		log.Printf("📡 Listening for routes on %s", routeChannel)
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			var route Route
+			if err := json.Unmarshal([]byte(notification.Payload), &route); err != nil {
+				log.Printf("📡 Ignoring malformed route: %v", err)
+				continue
+			}
+			go handle(route)
+		}
+	})
+}
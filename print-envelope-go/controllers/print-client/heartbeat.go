@@ -0,0 +1,154 @@
+package printclient
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// defaultPingInterval is how often the server pings each client when
+// PRINT_CLIENT_PING_INTERVAL is not set
+const defaultPingInterval = 30 * time.Second
+
+// defaultPongTimeout is how long a session may stay silent, answering no
+// ping and sending nothing, before it is treated as dead, when
+// PRINT_CLIENT_PONG_TIMEOUT is not set
+const defaultPongTimeout = 75 * time.Second
+
+// staleSweepInterval is how often sessions are checked for silence
+const staleSweepInterval = 15 * time.Second
+
+// pingInterval returns how often clients are pinged, read from
+// PRINT_CLIENT_PING_INTERVAL as a Go duration such as "20s"
+func pingInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("PRINT_CLIENT_PING_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return defaultPingInterval
+}
+
+// pongTimeout returns how long a session may stay silent, read from
+// PRINT_CLIENT_PONG_TIMEOUT. It always leaves room for more than two pings.
+func pongTimeout() time.Duration {
+	timeout := defaultPongTimeout
+	if t, err := time.ParseDuration(os.Getenv("PRINT_CLIENT_PONG_TIMEOUT")); err == nil && t > 0 {
+		timeout = t
+	}
+	if interval := pingInterval(); timeout <= interval {
+		timeout = interval * 5 / 2
+	}
+	return timeout
+}
+
+// startHeartbeat arms the read deadline of a new session and renews it on
+// every pong. A half-open connection then fails its next read instead of
+// holding on to the printer's subscription.
+func startHeartbeat(sub *Subscription) {
+	sub.touch()
+	sub.Conn.SetPongHandler(func(string) error {
+		sub.touch()
+		return nil
+	})
+}
+
+// touch records activity on the session and pushes its read deadline out.
+// It must only be called from the session's reading goroutine.
+func (sub *Subscription) touch() {
+	now := time.Now()
+	sub.lastActivity.Store(now.UnixNano())
+	if err := sub.Conn.SetReadDeadline(now.Add(pongTimeout())); err != nil {
+		log.Printf("Failed to set read deadline for user %s: %v", sub.UserUUID, err)
+	}
+}
+
+// LastActivity returns when a frame was last read from the client
+func (sub *Subscription) LastActivity() time.Time {
+	return time.Unix(0, sub.lastActivity.Load())
+}
+
+// ping sends a ping to the client. The client's pong arrives through the
+// read loop.
+func ping(sub *Subscription) error {
+	sub.Mutex.Lock()
+	defer sub.Mutex.Unlock()
+
+	if sub.Closed {
+		return fmt.Errorf("connection closed")
+	}
+	return sub.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+}
+
+// subscribe makes sub the current session of its printer. A session the
+// printer still has registered is closed: a printer has a single enrolled
+// key, so its new connection means the old one is dead or abandoned.
+func subscribe(sub *Subscription) {
+	subscriptionKey := sub.ChannelName + sub.UserUUID
+	if value, loaded := channelSubscriptions.Swap(subscriptionKey, sub); loaded {
+		if old, ok := value.(*Subscription); ok && old != sub {
+			log.Printf("🔁 Printer %s reconnected, replacing its session from %s", sub.UserUUID, old.ConnectedAt.Format(time.RFC3339))
+			IncrementReplacedSessions()
+			evictSession(old, "Replaced by a new connection")
+		}
+	}
+	log.Printf("User %s subscribed to channel: %s", sub.UserUUID, sub.ChannelName)
+}
+
+// unsubscribe removes sub and reports whether it was still the current
+// session of its printer. A replaced session leaves its successor alone.
+func unsubscribe(sub *Subscription) bool {
+	if !channelSubscriptions.CompareAndDelete(sub.ChannelName+sub.UserUUID, sub) {
+		return false
+	}
+	log.Printf("User %s unsubscribed from channel: %s", sub.UserUUID, sub.ChannelName)
+	return true
+}
+
+// evictSession closes a session with reason. Its read loop then fails and
+// unsubscribes it; a session whose loop has already ended is removed here.
+func evictSession(sub *Subscription, reason string) {
+	sub.Mutex.Lock()
+	closed := sub.Closed
+	if !closed {
+		_ = sub.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason), time.Now().Add(time.Second))
+		sub.Conn.Close()
+	}
+	sub.Mutex.Unlock()
+
+	if closed {
+		unsubscribe(sub)
+	}
+}
+
+// staleSessionSweeper periodically evicts sessions that have been silent
+// for longer than the pong timeout. The read deadline normally ends them
+// first; this catches sessions whose read loop is gone or stuck.
+func (cs *ChannelService) staleSessionSweeper() {
+	defer cs.wg.Done()
+	ticker := time.NewTicker(staleSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			timeout := pongTimeout()
+			channelSubscriptions.Range(func(key, value interface{}) bool {
+				sub, ok := value.(*Subscription)
+				if !ok {
+					return true
+				}
+				if idle := time.Since(sub.LastActivity()); idle > timeout {
+					log.Printf("💀 Printer %s silent for %s, evicting its session", sub.UserUUID, idle.Round(time.Second))
+					IncrementStaleEvictions()
+					evictSession(sub, "No activity")
+				}
+				return true
+			})
+		case <-cs.stopChan:
+			log.Println("Stale session sweeper stopping")
+			return
+		}
+	}
+}
@@ -72,21 +72,15 @@ func NewPrintJobHelper() *PrintJobHelper {
 // 	return nil
 // }
 
-// IsPrinterConnected checks if a printer is currently connected
+// IsPrinterConnected checks if a printer is currently connected to any
+// instance
 func (pjh *PrintJobHelper) IsPrinterConnected(printerID string) bool {
-	subscriptionKey := "printer-channel" + printerID
-	_, ok := channelSubscriptions.Load(subscriptionKey)
-	return ok
+	return connectedPrinterIDs()[printerID]
 }
 
 // GetConnectedPrinterCount returns the number of currently connected printers
 func (pjh *PrintJobHelper) GetConnectedPrinterCount() int {
-	count := 0
-	channelSubscriptions.Range(func(key, value interface{}) bool {
-		count++
-		return true
-	})
-	return count
+	return len(connectedPrinterIDs())
 }
 
 // // BroadcastToAllPrinters sends a message to all connected printers
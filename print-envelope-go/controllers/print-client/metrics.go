@@ -14,6 +14,8 @@ type WebSocketMetrics struct {
 	messagesProcessed    int64
 	authenticationErrors int64
 	connectionErrors     int64
+	staleEvictions       int64
+	replacedSessions     int64
 	mu                   sync.RWMutex
 }
 
@@ -46,6 +48,17 @@ func IncrementConnectionErrors() {
 	atomic.AddInt64(&wsMetrics.connectionErrors, 1)
 }
 
+// IncrementStaleEvictions increases the count of sessions evicted for silence
+func IncrementStaleEvictions() {
+	atomic.AddInt64(&wsMetrics.staleEvictions, 1)
+}
+
+// IncrementReplacedSessions increases the count of sessions replaced by a
+// reconnect of the same printer
+func IncrementReplacedSessions() {
+	atomic.AddInt64(&wsMetrics.replacedSessions, 1)
+}
+
 // GetWebSocketMetrics returns current WebSocket metrics for monitoring
 func GetWebSocketMetrics() map[string]interface{} {
 	return map[string]interface{}{
@@ -54,6 +67,8 @@ func GetWebSocketMetrics() map[string]interface{} {
 		"messages_processed":    atomic.LoadInt64(&wsMetrics.messagesProcessed),
 		"authentication_errors": atomic.LoadInt64(&wsMetrics.authenticationErrors),
 		"connection_errors":     atomic.LoadInt64(&wsMetrics.connectionErrors),
+		"stale_evictions":       atomic.LoadInt64(&wsMetrics.staleEvictions),
+		"replaced_sessions":     atomic.LoadInt64(&wsMetrics.replacedSessions),
 	}
 }
 
@@ -64,6 +79,8 @@ func ResetMetrics() {
 	atomic.StoreInt64(&wsMetrics.messagesProcessed, 0)
 	atomic.StoreInt64(&wsMetrics.authenticationErrors, 0)
 	atomic.StoreInt64(&wsMetrics.connectionErrors, 0)
+	atomic.StoreInt64(&wsMetrics.staleEvictions, 0)
+	atomic.StoreInt64(&wsMetrics.replacedSessions, 0)
 }
 
 // MetricsReporter periodically logs WebSocket metrics
@@ -126,5 +143,7 @@ func (mr *MetricsReporter) logMetrics() {
 	log.Printf("║ Messages Processed:    %-10v                           ║", metrics["messages_processed"])
 	log.Printf("║ Auth Errors:           %-10v                           ║", metrics["authentication_errors"])
 	log.Printf("║ Connection Errors:     %-10v                           ║", metrics["connection_errors"])
+	log.Printf("║ Stale Evictions:       %-10v                           ║", metrics["stale_evictions"])
+	log.Printf("║ Replaced Sessions:     %-10v                           ║", metrics["replaced_sessions"])
 	log.Printf("╚══════════════════════════════════════════════════════════════╝")
 }
@@ -0,0 +1,356 @@
+package printclient
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"printenvelope/models/print"
+	"printenvelope/types"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"gorm.io/gorm"
+)
+
+// defaultMessageTTL is how long a message waits for its printer when
+// PRINT_CLIENT_MESSAGE_TTL is not set
+const defaultMessageTTL = 24 * time.Hour
+
+// sweepInterval is how often messages are checked for expiry and retry
+const sweepInterval = 5 * time.Second
+
+// messageTTL returns how long queued messages live, read from
+// PRINT_CLIENT_MESSAGE_TTL as a Go duration such as "12h"
+func messageTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("PRINT_CLIENT_MESSAGE_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultMessageTTL
+}
+
+// Outbox is the persisted queue of messages for print clients. Messages are
+// written before they are sent, so they survive restarts and wait for
+// printers that are offline. Delivery is serialised per printer to keep
+// each printer's messages in order.
+type Outbox struct {
+	db       *gorm.DB
+	ttl      time.Duration
+	locks    sync.Map // printer ID -> *sync.Mutex
+	waiters  sync.Map // message ID -> chan struct{}, closed on ack or nack
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewOutbox creates an outbox backed by db
+func NewOutbox(db *gorm.DB) *Outbox {
+	return &Outbox{
+		db:       db,
+		ttl:      messageTTL(),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// outbox returns the outbox of the running service, if any
+func outbox() *Outbox {
+	if globalPrintClientService == nil || globalPrintClientService.outbox == nil || globalPrintClientService.outbox.db == nil {
+		return nil
+	}
+	return globalPrintClientService.outbox
+}
+
+// Start begins retrying unacknowledged messages and expiring messages that
+// outlived their TTL
+func (ob *Outbox) Start() {
+	if ob.db == nil {
+		return
+	}
+	log.Printf("📮 Starting outbox, messages expire after %s", ob.ttl)
+	ob.wg.Add(1)
+	go ob.sweepWorker()
+}
+
+// Stop stops the sweep worker
+func (ob *Outbox) Stop() {
+	close(ob.stopChan)
+	ob.wg.Wait()
+	log.Println("✅ Outbox stopped")
+}
+
+// Enqueue stores a message for a printer. It is sent the next time
+// Deliver runs for the printer.
+func (ob *Outbox) Enqueue(messageID, printerID, jobUuid, command string, payload []byte) (*print.PrintClientMessage, error) {
+	message := print.PrintClientMessage{
+		MessageID: messageID,
+		PrinterID: printerID,
+		JobUuid:   jobUuid,
+		Command:   command,
+		Payload:   string(payload),
+		Status:    print.MessageQueued,
+		ExpiresAt: time.Now().Add(ob.ttl),
+	}
+	if jobUuid != "" {
+		var batchJob print.PrintBatchJob
+		if err := ob.db.Select("id").Where("job_uuid = ? AND is_deleted = ?", jobUuid, false).
+			First(&batchJob).Error; err == nil {
+			message.PrintBatchJobID = &batchJob.ID
+		}
+	}
+	if err := ob.db.Create(&message).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue message for printer %s: %w", printerID, err)
+	}
+	return &message, nil
+}
+
+// Deliver sends the queued messages of a printer if it is connected to
+// this instance. Other instances ask for it with a deliver route.
+func (ob *Outbox) Deliver(printerID string) {
+	value, ok := channelSubscriptions.Load("printer-channel" + printerID)
+	if !ok {
+		log.Printf("📮 Printer %s is offline, messages stay queued", printerID)
+		return
+	}
+	if sub, ok := value.(*Subscription); ok {
+		ob.deliverTo(sub, false)
+	}
+}
+
+// deliverTo writes the printer's queued messages to its connection in ID
+// order, marking each sent once written. It stops at the first failed
+// write and leaves the rest queued for the next connection.
+//
+// Clients speaking protocol 1 or later also get their unacknowledged
+// messages again once the backoff has passed, or straight away when resend
+// is set on a new connection. They drop duplicates by message ID. Older
+// clients cannot, so their messages are never sent twice.
+func (ob *Outbox) deliverTo(sub *Subscription, resend bool) {
+	lock, _ := ob.locks.LoadOrStore(sub.UserUUID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	now := time.Now()
+	query := ob.db.Where("printer_id = ? AND expires_at > ?", sub.UserUUID, now)
+	if sub.ProtocolVersion >= 1 {
+		due := ob.db.Where("status = ? AND next_attempt_at IS NOT NULL", print.MessageSent)
+		if !resend {
+			due = due.Where("next_attempt_at <= ?", now)
+		}
+		query = query.Where(ob.db.Where("status = ?", print.MessageQueued).Or(due))
+	} else {
+		query = query.Where("status = ?", print.MessageQueued)
+	}
+
+	var messages []print.PrintClientMessage
+	if err := query.Order("id ASC").Find(&messages).Error; err != nil {
+		log.Printf("📮 Failed to load queued messages for printer %s: %v", sub.UserUUID, err)
+		return
+	}
+
+	for _, message := range messages {
+		if err := writeMessage(sub, []byte(message.Payload)); err != nil {
+			log.Printf("📮 Failed to deliver message %d to printer %s: %v", message.ID, sub.UserUUID, err)
+			if err := ob.db.Model(&message).Updates(map[string]interface{}{
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": err.Error(),
+			}).Error; err != nil {
+				log.Printf("📮 Failed to record delivery error of message %d: %v", message.ID, err)
+			}
+			return
+		}
+
+		sentAt := time.Now()
+		updates := map[string]interface{}{
+			"status":           print.MessageSent,
+			"sent_at":          sentAt,
+			"attempts":         gorm.Expr("attempts + 1"),
+			"protocol_version": sub.ProtocolVersion,
+			"next_attempt_at":  nil,
+		}
+		if sub.ProtocolVersion >= 1 {
+			updates["next_attempt_at"] = sentAt.Add(retryBackoff(message.Attempts + 1))
+		}
+		if err := ob.db.Model(&message).Where("status IN ?", []print.MessageStatus{print.MessageQueued, print.MessageSent}).
+			Updates(updates).Error; err != nil {
+			log.Printf("📮 Failed to mark message %d sent: %v", message.ID, err)
+		}
+		log.Printf("🚀 Delivered message %s (job %s, attempt %d) to printer %s", message.MessageID, message.JobUuid, message.Attempts+1, sub.UserUUID)
+	}
+}
+
+// writeMessage writes one message to a subscription's connection
+func writeMessage(sub *Subscription, message []byte) error {
+	sub.Mutex.Lock()
+	defer sub.Mutex.Unlock()
+
+	if sub.Closed {
+		return fmt.Errorf("connection closed")
+	}
+	if err := sub.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	return sub.Conn.WriteMessage(websocket.TextMessage, message)
+}
+
+// AckedByJob marks the sent messages of a job acknowledged. Any event the
+// client reports for a job shows it received the job, which is the only
+// acknowledgement clients older than protocol 1 give.
+func (ob *Outbox) AckedByJob(printerID, jobUuid string) {
+	if err := ob.db.Model(&print.PrintClientMessage{}).
+		Where("printer_id = ? AND job_uuid = ? AND status = ?", printerID, jobUuid, print.MessageSent).
+		Updates(map[string]interface{}{"status": print.MessageAcked, "acked_at": time.Now(), "next_attempt_at": nil}).Error; err != nil {
+		log.Printf("📮 Failed to acknowledge job %s of printer %s: %v", jobUuid, printerID, err)
+	}
+}
+
+// sweepWorker periodically expires messages past their expiry and resends
+// the unacknowledged ones that are due
+func (ob *Outbox) sweepWorker() {
+	defer ob.wg.Done()
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ob.expire()
+			ob.retry()
+		case <-ob.stopChan:
+			log.Println("📮 Outbox sweep stopping")
+			return
+		}
+	}
+}
+
+// expire marks queued and unacknowledged messages past their expiry
+// expired. Each expiry is recorded as a job-expired client event, and a
+// job the printer never started is failed so it can be resumed.
+func (ob *Outbox) expire() {
+	var messages []print.PrintClientMessage
+	if err := ob.db.Where("status IN ? AND expires_at <= ?",
+		[]print.MessageStatus{print.MessageQueued, print.MessageSent}, time.Now()).
+		Order("id ASC").Find(&messages).Error; err != nil {
+		log.Printf("📮 Failed to load expired messages: %v", err)
+		return
+	}
+
+	for _, message := range messages {
+		res := ob.db.Model(&message).Where("status = ?", message.Status).
+			Updates(map[string]interface{}{"status": print.MessageExpired, "expired_at": time.Now()})
+		if res.Error != nil {
+			log.Printf("📮 Failed to expire message %d: %v", message.ID, res.Error)
+			continue
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+
+		reason := fmt.Sprintf("Job was not delivered to printer %s before it expired", message.PrinterID)
+		if message.Status == print.MessageSent {
+			reason = fmt.Sprintf("Printer %s did not acknowledge the job before it expired", message.PrinterID)
+		}
+		log.Printf("⌛ Message %s (job %s) expired: %s", message.MessageID, message.JobUuid, reason)
+
+		ob.undelivered(message, EventJobExpired, reason)
+	}
+}
+
+// undelivered records that a message will not be delivered as a server
+// event and fails its job if the printer never started it, so the job can
+// be resumed
+func (ob *Outbox) undelivered(message print.PrintClientMessage, event, reason string) {
+	if err := ob.db.Create(&print.PrintClientEvent{
+		PrinterID:       message.PrinterID,
+		Type:            "server",
+		Event:           event,
+		JobUuid:         message.JobUuid,
+		PrintBatchJobID: message.PrintBatchJobID,
+		Message:         reason,
+	}).Error; err != nil {
+		log.Printf("📮 Failed to record %s of message %s: %v", event, message.MessageID, err)
+	}
+
+	if message.PrintBatchJobID == nil {
+		return
+	}
+	var batchJob print.PrintBatchJob
+	if err := ob.db.Where("id = ? AND printer_id = ? AND status = ?", *message.PrintBatchJobID, message.PrinterID, print.PrintJobPending).
+		First(&batchJob).Error; err != nil {
+		return
+	}
+	if err := finishJob(ob.db, &batchJob, UpstreamMsg{
+		ID:      message.PrinterID,
+		Type:    "server",
+		Event:   event,
+		JobID:   message.JobUuid,
+		Message: reason,
+	}, print.PrintJobFailed); err != nil {
+		log.Printf("📮 Failed to fail undelivered job %d: %v", batchJob.ID, err)
+	}
+}
+
+// ListMessages lists queued print client messages, newest first. Filters:
+// printer_id, job_uuid and status (comma separated). limit caps the result
+// (default 100, at most 1000).
+func (pcc *PrintClientController) ListMessages(c *fiber.Ctx) error {
+	ob := outbox()
+	if ob == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(types.ErrorResponse{
+			Message: "Message queue is not available",
+			Status:  fiber.StatusServiceUnavailable,
+		})
+	}
+
+	query := ob.db.Model(&print.PrintClientMessage{})
+	if printerID := c.Query("printer_id"); printerID != "" {
+		query = query.Where("printer_id = ?", printerID)
+	}
+	if jobUuid := c.Query("job_uuid"); jobUuid != "" {
+		query = query.Where("job_uuid = ?", jobUuid)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status IN ?", strings.Split(strings.ToUpper(status), ","))
+	}
+
+	type statusCount struct {
+		Status string
+		Count  int64
+	}
+	var counts []statusCount
+	if err := query.Session(&gorm.Session{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		log.Printf("Failed to count print client messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch messages",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+	byStatus := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		byStatus[count.Status] = count.Count
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+	var messages []print.PrintClientMessage
+	if err := query.Order("id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		log.Printf("Failed to fetch print client messages: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch messages",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Messages fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"messages":  messages,
+			"total":     len(messages),
+			"by_status": byStatus,
+		},
+	})
+}
@@ -0,0 +1,164 @@
+package printclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"printenvelope/models/print"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// presenceTTL is how long a presence row stays valid without its instance
+// renewing it
+const presenceTTL = 45 * time.Second
+
+// PresenceRegistry records which server instance holds each printer's
+// session
+type PresenceRegistry interface {
+	// Connected records that node holds the printer's session and returns
+	// the node that held it before, if any
+	Connected(presence print.PrintClientPresence) (previous string, err error)
+	// Disconnected forgets the printer's session if node still holds it
+	Disconnected(printerID, node string) error
+	// Locate returns the printer's session, nil if it has none
+	Locate(printerID string) (*print.PrintClientPresence, error)
+	// Online returns every printer with a session
+	Online() ([]print.PrintClientPresence, error)
+	// Renew keeps node's sessions alive and drops those of dead instances
+	Renew(node string) error
+	// Release forgets all of node's sessions
+	Release(node string) error
+}
+
+// MemoryPresence keeps presence in memory for a single instance
+type MemoryPresence struct {
+	mu       sync.RWMutex
+	sessions map[string]print.PrintClientPresence
+}
+
+// NewMemoryPresence creates an in-memory presence registry
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{sessions: make(map[string]print.PrintClientPresence)}
+}
+
+func (mp *MemoryPresence) Connected(presence print.PrintClientPresence) (string, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	previous := mp.sessions[presence.PrinterID].NodeID
+	mp.sessions[presence.PrinterID] = presence
+	return previous, nil
+}
+
+func (mp *MemoryPresence) Disconnected(printerID, node string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if mp.sessions[printerID].NodeID == node {
+		delete(mp.sessions, printerID)
+	}
+	return nil
+}
+
+func (mp *MemoryPresence) Locate(printerID string) (*print.PrintClientPresence, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	if presence, ok := mp.sessions[printerID]; ok {
+		return &presence, nil
+	}
+	return nil, nil
+}
+
+func (mp *MemoryPresence) Online() ([]print.PrintClientPresence, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	online := make([]print.PrintClientPresence, 0, len(mp.sessions))
+	for _, presence := range mp.sessions {
+		online = append(online, presence)
+	}
+	return online, nil
+}
+
+func (mp *MemoryPresence) Renew(node string) error {
+	return nil
+}
+
+func (mp *MemoryPresence) Release(node string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	for printerID, presence := range mp.sessions {
+		if presence.NodeID == node {
+			delete(mp.sessions, printerID)
+		}
+	}
+	return nil
+}
+
+// PostgresPresence keeps presence in the print_client_presences table,
+// shared by every instance using the database
+type PostgresPresence struct {
+	db *gorm.DB
+}
+
+// NewPostgresPresence creates a presence registry backed by db
+func NewPostgresPresence(db *gorm.DB) *PostgresPresence {
+	return &PostgresPresence{db: db}
+}
+
+// live selects presence rows renewed within presenceTTL
+func (pp *PostgresPresence) live() *gorm.DB {
+	return pp.db.Where("heartbeat_at > ?", time.Now().Add(-presenceTTL))
+}
+
+func (pp *PostgresPresence) Connected(presence print.PrintClientPresence) (string, error) {
+	var previous string
+	if current, err := pp.Locate(presence.PrinterID); err != nil {
+		return "", err
+	} else if current != nil {
+		previous = current.NodeID
+	}
+
+	presence.ID = 0
+	presence.HeartbeatAt = time.Now()
+	err := pp.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "printer_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"node_id", "protocol_version", "connected_at", "heartbeat_at"}),
+	}).Create(&presence).Error
+	return previous, err
+}
+
+func (pp *PostgresPresence) Disconnected(printerID, node string) error {
+	return pp.db.Where("printer_id = ? AND node_id = ?", printerID, node).
+		Delete(&print.PrintClientPresence{}).Error
+}
+
+func (pp *PostgresPresence) Locate(printerID string) (*print.PrintClientPresence, error) {
+	var presence print.PrintClientPresence
+	if err := pp.live().Where("printer_id = ?", printerID).First(&presence).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &presence, nil
+}
+
+func (pp *PostgresPresence) Online() ([]print.PrintClientPresence, error) {
+	var online []print.PrintClientPresence
+	err := pp.live().Order("printer_id ASC").Find(&online).Error
+	return online, err
+}
+
+func (pp *PostgresPresence) Renew(node string) error {
+	if err := pp.db.Model(&print.PrintClientPresence{}).Where("node_id = ?", node).
+		Update("heartbeat_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return pp.db.Where("heartbeat_at <= ?", time.Now().Add(-presenceTTL)).
+		Delete(&print.PrintClientPresence{}).Error
+}
+
+func (pp *PostgresPresence) Release(node string) error {
+	return pp.db.Where("node_id = ?", node).Delete(&print.PrintClientPresence{}).Error
+}
@@ -0,0 +1,379 @@
+package printclient
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"printenvelope/models/print"
+	"printenvelope/models/user"
+	"printenvelope/types"
+	"printprotocol"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PrinterRegistry keeps the printers table in step with client connections
+type PrinterRegistry struct {
+	db *gorm.DB
+}
+
+// NewPrinterRegistry creates a printer registry backed by db
+func NewPrinterRegistry(db *gorm.DB) *PrinterRegistry {
+	return &PrinterRegistry{db: db}
+}
+
+// registeredPrinters returns the registry of the running service, if any
+func registeredPrinters() *PrinterRegistry {
+	if globalPrintClientService == nil || globalPrintClientService.printers == nil || globalPrintClientService.printers.db == nil {
+		return nil
+	}
+	return globalPrintClientService.printers
+}
+
+// Register records an authenticated client, creating its printer on first
+// auth and refreshing the reported platform, processor and client version
+// on every later one
+func (pr *PrinterRegistry) Register(auth *printprotocol.Auth) (*print.Printer, error) {
+	now := time.Now()
+	printer := print.Printer{
+		PrinterID:       auth.Token,
+		Enabled:         true,
+		Platform:        auth.Platform,
+		Processor:       auth.Processor,
+		ClientVersion:   auth.ClientVersion,
+		FirstSeenAt:     now,
+		LastSeenAt:      now,
+		LastConnectedAt: &now,
+	}
+	if err := pr.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "printer_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"platform":          auth.Platform,
+			"processor":         auth.Processor,
+			"client_version":    auth.ClientVersion,
+			"last_seen_at":      now,
+			"last_connected_at": now,
+			"updated_at":        now,
+		}),
+	}).Create(&printer).Error; err != nil {
+		return nil, fmt.Errorf("failed to register printer %s: %w", auth.Token, err)
+	}
+
+	if err := pr.db.Where("printer_id = ?", auth.Token).First(&printer).Error; err != nil {
+		return nil, err
+	}
+	return &printer, nil
+}
+
+// Seen moves the last-seen time of a printer forward
+func (pr *PrinterRegistry) Seen(printerID string) {
+	if err := pr.db.Model(&print.Printer{}).Where("printer_id = ?", printerID).
+		Update("last_seen_at", time.Now()).Error; err != nil {
+		log.Printf("Failed to update last seen of printer %s: %v", printerID, err)
+	}
+}
+
+// Disconnected records the end of a printer's connection
+func (pr *PrinterRegistry) Disconnected(printerID string) {
+	now := time.Now()
+	if err := pr.db.Model(&print.Printer{}).Where("printer_id = ?", printerID).
+		Updates(map[string]interface{}{"last_seen_at": now, "last_disconnected_at": now}).Error; err != nil {
+		log.Printf("Failed to record disconnect of printer %s: %v", printerID, err)
+	}
+}
+
+// currentUser looks up the authenticated user
+func (pr *PrinterRegistry) currentUser(c *fiber.Ctx) (*user.User, *types.ErrorResponse) {
+	userUUID, ok := c.Locals("user_id").(string)
+	if !ok || userUUID == "" {
+		return nil, &types.ErrorResponse{
+			Message: "User not authenticated",
+			Status:  fiber.StatusUnauthorized,
+		}
+	}
+
+	var u user.User
+	if err := pr.db.Where("uuid = ?", userUUID).First(&u).Error; err != nil {
+		log.Printf("Failed to find user by UUID: %v", err)
+		return nil, &types.ErrorResponse{
+			Message: "Invalid user",
+			Status:  fiber.StatusUnauthorized,
+		}
+	}
+	return &u, nil
+}
+
+// printerView is a registered printer with its operator and live state
+type printerView struct {
+	print.Printer
+	OperatorName string `json:"operator_name"`
+	Connected    bool   `json:"connected"`
+}
+
+// connectedPrinterIDs returns the printers with an open connection to any
+// instance
+func connectedPrinterIDs() map[string]bool {
+	connected := make(map[string]bool)
+	channelSubscriptions.Range(func(key, value interface{}) bool {
+		if sub, ok := value.(*Subscription); ok && !sub.Closed {
+			connected[sub.UserUUID] = true
+		}
+		return true
+	})
+	if r := router(); r != nil {
+		for printerID := range r.Online() {
+			connected[printerID] = true
+		}
+	}
+	return connected
+}
+
+// printerQuery selects printers with the username of their operator
+func (pr *PrinterRegistry) printerQuery() *gorm.DB {
+	return pr.db.Table("printers").
+		Select("printers.*, COALESCE(users.username, '') AS operator_name").
+		Joins("LEFT JOIN users ON users.id = printers.operator_id").
+		Where("printers.is_deleted = ?", false)
+}
+
+// ListPrinters lists registered printers with their connection state.
+// Filters: enabled, print_center, operator_id, connected and search on the
+// name or printer ID.
+func (pcc *PrintClientController) ListPrinters(c *fiber.Ctx) error {
+	registry := registeredPrinters()
+	if registry == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(types.ErrorResponse{
+			Message: "Printer registry is not available",
+			Status:  fiber.StatusServiceUnavailable,
+		})
+	}
+
+	connected := connectedPrinterIDs()
+	query := registry.printerQuery()
+	if enabled := c.Query("enabled"); enabled != "" {
+		query = query.Where("printers.enabled = ?", enabled == "true")
+	}
+	if printCenter := c.Query("print_center"); printCenter != "" {
+		query = query.Where("printers.print_center = ?", printCenter)
+	}
+	if operatorID := c.QueryInt("operator_id"); operatorID > 0 {
+		query = query.Where("printers.operator_id = ?", operatorID)
+	}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		query = query.Where("(printers.name ILIKE ? OR printers.printer_id ILIKE ?)", "%"+search+"%", "%"+search+"%")
+	}
+	if only := c.Query("connected"); only != "" {
+		ids := make([]string, 0, len(connected))
+		for id := range connected {
+			ids = append(ids, id)
+		}
+		if only == "true" {
+			query = query.Where("printers.printer_id IN ?", append(ids, ""))
+		} else {
+			query = query.Where("printers.printer_id NOT IN ?", append(ids, ""))
+		}
+	}
+
+	var list []printerView
+	if err := query.Order("printers.print_center ASC, printers.name ASC, printers.id ASC").Scan(&list).Error; err != nil {
+		log.Printf("Failed to fetch printers: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch printers",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+	for i := range list {
+		list[i].Connected = connected[list[i].PrinterID]
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Printers fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"printers":  list,
+			"total":     len(list),
+			"connected": len(connected),
+		},
+	})
+}
+
+// PrinterDetail returns a registered printer with its connection history,
+// newest first. limit caps the history entries (default 50, at most 500).
+func (pcc *PrintClientController) PrinterDetail(c *fiber.Ctx) error {
+	registry := registeredPrinters()
+	if registry == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(types.ErrorResponse{
+			Message: "Printer registry is not available",
+			Status:  fiber.StatusServiceUnavailable,
+		})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid printer ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var printer printerView
+	result := registry.printerQuery().Where("printers.id = ?", id).Limit(1).Scan(&printer)
+	if result.Error != nil {
+		log.Printf("Failed to fetch printer %d: %v", id, result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch printer",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
+			Message: "Printer not found",
+			Status:  fiber.StatusNotFound,
+		})
+	}
+	printer.Connected = connectedPrinterIDs()[printer.PrinterID]
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+	var history []print.PrintClientEvent
+	if err := registry.db.Where("printer_id = ? AND event IN ?", printer.PrinterID,
+		[]string{EventPrinterConnected, EventPrinterDisconnected}).
+		Order("created_at DESC").Limit(limit).Find(&history).Error; err != nil {
+		log.Printf("Failed to fetch connection history of printer %d: %v", id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch printer connection history",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Printer fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"printer":            printer,
+			"connection_history": history,
+		},
+	})
+}
+
+// UpdatePrinter labels a printer, assigns it to a print center and
+// operator, or enables and disables it. Only the fields sent are changed;
+// an operator_id of 0 removes the operator.
+func (pcc *PrintClientController) UpdatePrinter(c *fiber.Ctx) error {
+	registry := registeredPrinters()
+	if registry == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(types.ErrorResponse{
+			Message: "Printer registry is not available",
+			Status:  fiber.StatusServiceUnavailable,
+		})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid printer ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	var req types.PrinterUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		log.Printf("Failed to parse printer update request: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	admin, errResp := registry.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	updates := make(map[string]interface{})
+	var changes []string
+	if req.Name != nil {
+		updates["name"] = strings.TrimSpace(*req.Name)
+		changes = append(changes, fmt.Sprintf("name=%q", updates["name"]))
+	}
+	if req.PrintCenter != nil {
+		updates["print_center"] = strings.TrimSpace(*req.PrintCenter)
+		changes = append(changes, fmt.Sprintf("print_center=%q", updates["print_center"]))
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+		changes = append(changes, fmt.Sprintf("enabled=%t", *req.Enabled))
+	}
+	if req.OperatorID != nil {
+		if *req.OperatorID == 0 {
+			updates["operator_id"] = nil
+		} else {
+			var operator user.User
+			if err := registry.db.Where("id = ? AND is_deleted = ?", *req.OperatorID, false).First(&operator).Error; err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+					Message: "Operator not found",
+					Status:  fiber.StatusBadRequest,
+				})
+			}
+			updates["operator_id"] = operator.ID
+		}
+		changes = append(changes, fmt.Sprintf("operator_id=%d", *req.OperatorID))
+	}
+	if len(updates) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Nothing to update",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var printer print.Printer
+	err = registry.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND is_deleted = ?", id, false).First(&printer).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&printer).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     admin.ID,
+			AdminUUID:   admin.Uuid,
+			Action:      "UPDATE_PRINTER",
+			EntityType:  "PRINTER",
+			EntityID:    printer.ID,
+			Description: fmt.Sprintf("Updated printer %s: %s", printer.PrinterID, strings.Join(changes, ", ")),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
+			Message: "Printer not found",
+			Status:  fiber.StatusNotFound,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to update printer %d: %v", id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to update printer",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	var view printerView
+	if err := registry.printerQuery().Where("printers.id = ?", printer.ID).Limit(1).Scan(&view).Error; err != nil {
+		log.Printf("Failed to reload printer %d: %v", id, err)
+	}
+	view.Connected = connectedPrinterIDs()[view.PrinterID]
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Printer updated successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"printer": view,
+		},
+	})
+}
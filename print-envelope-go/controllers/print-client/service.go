@@ -5,6 +5,8 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // PrintClientService orchestrates all print client components
@@ -12,6 +14,9 @@ type PrintClientService struct {
 	channelService    *ChannelService
 	metricsReporter   *MetricsReporter
 	upstreamProcessor *UpstreamProcessor
+	printers          *PrinterRegistry
+	outbox            *Outbox
+	router            *Router
 	ctx               context.Context
 	cancel            context.CancelFunc
 	wg                sync.WaitGroup
@@ -19,6 +24,7 @@ type PrintClientService struct {
 
 // UpstreamProcessor handles upstream log processing
 type UpstreamProcessor struct {
+	db          *gorm.DB
 	workerCount int
 	stopChan    chan struct{}
 	wg          sync.WaitGroup
@@ -28,8 +34,11 @@ type UpstreamProcessor struct {
 var globalPrintClientService *PrintClientService
 var serviceInitOnce sync.Once
 
-// InitPrintClientService initializes the print client service
-func InitPrintClientService() *PrintClientService {
+// InitPrintClientService initializes the print client service. Client events
+// are persisted and applied to print jobs through db, which also holds the
+// printer registry, the outbound message queue and, unless
+// PRINT_CLIENT_FANOUT=local, the routing between server instances.
+func InitPrintClientService(db *gorm.DB) *PrintClientService {
 	serviceInitOnce.Do(func() {
 		log.Println("🔄 Initializing Print Client Service...")
 
@@ -38,7 +47,10 @@ func InitPrintClientService() *PrintClientService {
 		service := &PrintClientService{
 			channelService:    NewChannelService(20),                // 20 workers for channel operations
 			metricsReporter:   NewMetricsReporter(60 * time.Second), // Report every minute
-			upstreamProcessor: NewUpstreamProcessor(5),              // 5 workers for upstream logs
+			upstreamProcessor: NewUpstreamProcessor(5, db),          // 5 workers for upstream logs
+			printers:          NewPrinterRegistry(db),
+			outbox:            NewOutbox(db),
+			router:            NewRouter(db),
 			ctx:               ctx,
 			cancel:            cancel,
 		}
@@ -63,6 +75,12 @@ func (pcs *PrintClientService) Start() {
 	// Start upstream processor
 	pcs.upstreamProcessor.Start()
 
+	// Start outbound message expiry
+	pcs.outbox.Start()
+
+	// Start routing to printers connected to other instances
+	pcs.router.Start()
+
 	log.Println("✅ Print Client Service started successfully")
 }
 
@@ -77,6 +95,8 @@ func (pcs *PrintClientService) Stop() {
 	pcs.channelService.Stop()
 	pcs.metricsReporter.Stop()
 	pcs.upstreamProcessor.Stop()
+	pcs.outbox.Stop()
+	pcs.router.Stop()
 
 	// Wait for all goroutines to finish
 	pcs.wg.Wait()
@@ -85,12 +105,13 @@ func (pcs *PrintClientService) Stop() {
 }
 
 // NewUpstreamProcessor creates a new upstream processor
-func NewUpstreamProcessor(workerCount int) *UpstreamProcessor {
+func NewUpstreamProcessor(workerCount int, db *gorm.DB) *UpstreamProcessor {
 	if workerCount <= 0 {
 		workerCount = 5
 	}
 
 	return &UpstreamProcessor{
+		db:          db,
 		workerCount: workerCount,
 		stopChan:    make(chan struct{}),
 	}
@@ -141,25 +162,6 @@ func (up *UpstreamProcessor) logWorker(workerID int) {
 	}
 }
 
-// processLogMessage processes an upstream log message
-func (up *UpstreamProcessor) processLogMessage(logMsg UpstreamMsg, workerID int) {
-	// TODO: Integrate with your database or logging system
-	// For now, just log it
-	log.Printf("📤 Worker %d - Upstream Log: Type=%s, Event=%s, ID=%s, JobID=%s, Message=%s",
-		workerID, logMsg.Type, logMsg.Event, logMsg.ID, logMsg.JobID, logMsg.Message)
-
-	// You can add database insertion here, for example:
-	// if globalPrintClientService.db != nil {
-	//     // Insert into logs table
-	//     globalPrintClientService.db.Create(&PrintClientLog{
-	//         ClientID: logMsg.ID,
-	//         Event: logMsg.Event,
-	//         Message: logMsg.Message,
-	//         ...
-	//     })
-	// }
-}
-
 // GetService returns the global print client service instance
 func GetService() *PrintClientService {
 	return globalPrintClientService
@@ -2,6 +2,7 @@ package printclient
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/websocket/v2"
@@ -9,16 +10,6 @@ import (
 
 // Message types used by WebSocket service
 type (
-	// AuthMessage represents authentication data from the client
-	AuthMessage struct {
-		Type          string `json:"type"`           // Message type (e.g., "auth")
-		Token         string `json:"token"`          // Unique token generated by the client
-		Processor     string `json:"processor"`      // Machine's processor details
-		Platform      string `json:"platform"`       // Machine's platform details (e.g., OS)
-		HardwareID    string `json:"hardware_id"`    // Unique hardware identifier
-		ClientVersion string `json:"client_version"` // Client Software Version
-	}
-
 	// UndeliveredMsg represents a message that couldn't be delivered
 	UndeliveredMsg struct {
 		UserUUID  string
@@ -35,6 +26,10 @@ type (
 		MessageChan chan []byte // Message channel for each connection
 		Closed      bool
 		Mutex       sync.Mutex
+
+		ProtocolVersion int          // Message protocol negotiated for the connection
+		ConnectedAt     time.Time    // When the session authenticated
+		lastActivity    atomic.Int64 // Unix nanoseconds of the last frame read from the client
 	}
 
 	// WeightDimSubscription represents a weight/dimension machine subscription
@@ -43,10 +38,12 @@ type (
 		UserID    string
 	}
 
-	// Unsubscription represents an unsubscribe request
+	// Unsubscription represents an unsubscribe request. Without a Session
+	// the user's current session is closed.
 	Unsubscription struct {
 		ChannelName string
 		UserUUID    string
+		Session     *Subscription // Removed only while still the current session
 	}
 
 	// BroadcastMsg represents a message to be broadcast to a specific channel/user
@@ -72,26 +69,7 @@ type (
 		Message         string
 		ClientVersion   string
 		WeightMachineID string
-	}
-
-	// ClientJob represents a job message from the client
-	ClientJob struct {
-		JobID   string `json:"JobId"`
-		Event   string `json:"Event"`
-		Message string `json:"Message"`
-	}
-
-	// PrintJob represents a print job to be sent to a client
-	PrintJob struct {
-		PrinterID string  `json:"printer_id"`
-		JobID     string  `json:"job_id"`
-		JobToken  string  `json:"job_token"`
-		Command   string  `json:"command"`
-		Width     float64 `json:"width"`
-		Height    float64 `json:"height"`
-		Unit      string  `json:"unit"`
-		Barcode   string  `json:"barcode"`
-		Mashul    string  `json:"mashul"`
-		Weight    string  `json:"weight"`
+		PagesPrinted    int
+		TotalPages      int
 	}
 )
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"time"
 
+	"printprotocol"
+
 	"github.com/gofiber/websocket/v2"
 )
 
@@ -41,7 +43,7 @@ func ConnectWS(c *websocket.Conn) {
 	}
 
 	// Parse authentication message
-	var authMessage AuthMessage
+	var authMessage printprotocol.Auth
 	if err := json.Unmarshal(message, &authMessage); err != nil {
 		log.Println("Failed to parse authentication message:", err)
 		c.Close()
@@ -53,17 +55,9 @@ func ConnectWS(c *websocket.Conn) {
 
 	// Validate authentication
 	var userUUID, channel string
-	if authMessage.Type == "auth" {
-		isValid, err := ValidateAuthToken(&authMessage)
-		if err != nil {
-			log.Println("Invalid authentication message:", err)
-			c.Close()
-			IncrementAuthErrors()
-			return
-		}
-
-		if !isValid {
-			log.Println("Authentication failed for client:", authMessage.Token)
+	if authMessage.Type == printprotocol.TypeAuth {
+		if err := authenticateClient(c, &authMessage); err != nil {
+			log.Println("Authentication failed for client", authMessage.Token+":", err)
 			c.Close()
 			IncrementAuthErrors()
 			return
@@ -72,6 +66,14 @@ func ConnectWS(c *websocket.Conn) {
 		userUUID = authMessage.Token
 		channel = "printer-channel"
 		log.Println("Printer", userUUID, "authenticated successfully")
+
+		if registry := registeredPrinters(); registry != nil {
+			if printer, err := registry.Register(&authMessage); err != nil {
+				log.Println("Failed to register printer:", err)
+			} else if !printer.Enabled {
+				log.Printf("Printer %s is disabled and will not be given print jobs", userUUID)
+			}
+		}
 	}
 
 	if channel == "" {
@@ -95,23 +97,40 @@ func ConnectWS(c *websocket.Conn) {
 		Conn:        c,
 		MessageChan: messageChan,
 		Closed:      false,
+
+		ProtocolVersion: printprotocol.Negotiate(printprotocol.Version, authMessage.ProtocolVersion),
+		ConnectedAt:     time.Now(),
 	}
 
+	// Arm the read deadline, renewed by pongs and client messages
+	startHeartbeat(&sub)
+
 	// Update metrics
 	IncrementActiveConnections()
 
-	// Start WebSocket write handler
+	// Start WebSocket write handler, which also pings the client
 	go handleWebSocketWrites(&sub)
 
-	// Subscribe to channel
-	subscribeChan <- &sub
+	// Subscribe to channel. This is done in place rather than through
+	// subscribeChan so a session this one replaces is closed before any
+	// job can reach it.
+	subscribe(&sub)
+	if r := router(); r != nil {
+		r.Connected(&sub)
+	}
 
 	// Process any undelivered messages
 	go ProcessUndeliveredMessages(userUUID, messageChan)
 
+	// Deliver print jobs queued while the printer was away, and resend
+	// the ones it never acknowledged
+	if ob := outbox(); ob != nil && channel == "printer-channel" {
+		go ob.deliverTo(&sub, true)
+	}
+
 	// Send connection log
 	if channel == "printer-channel" {
-		log.Printf("Printer %s subscribed to channel: %s, client version: %s", userUUID, channel, authMessage.ClientVersion)
+		log.Printf("Printer %s subscribed to channel: %s, client version: %s, protocol: %d", userUUID, channel, authMessage.ClientVersion, sub.ProtocolVersion)
 
 		// Send connection event upstream
 		upstreamLogsChan <- UpstreamMsg{
@@ -125,8 +144,15 @@ func ConnectWS(c *websocket.Conn) {
 
 	// Cleanup on disconnect
 	defer func() {
-		if channel == "printer-channel" {
-			unsubscribeChan <- Unsubscription{ChannelName: channel, UserUUID: userUUID}
+		// A replaced session leaves the printer connected through its
+		// successor, so only the current session reports the disconnect
+		if channel == "printer-channel" && unsubscribe(&sub) {
+			if r := router(); r != nil {
+				r.Disconnected(&sub)
+			}
+			if registry := registeredPrinters(); registry != nil {
+				registry.Disconnected(userUUID)
+			}
 			upstreamLogsChan <- UpstreamMsg{
 				ID:            userUUID,
 				Type:          "printer",
@@ -149,17 +175,40 @@ func ConnectWS(c *websocket.Conn) {
 		if err != nil {
 			break
 		}
+		sub.touch()
 
 		if channel == "printer-channel" {
-			clientJob := ClientJob{}
+			msgType, err := printprotocol.PeekType(message)
+			if err != nil {
+				log.Printf("Error parsing client message from user %s: %v", userUUID, err)
+				continue
+			}
+
+			if msgType == printprotocol.TypeAck || msgType == printprotocol.TypeNack {
+				var receipt printprotocol.Receipt
+				if err := json.Unmarshal(message, &receipt); err != nil {
+					log.Printf("Error parsing %s from user %s: %v", msgType, userUUID, err)
+					continue
+				}
+				if ob := outbox(); ob != nil {
+					ob.HandleReceipt(userUUID, receipt)
+				}
+				IncrementMessagesProcessed()
+				continue
+			}
+
+			clientJob := printprotocol.Event{}
 			err = json.Unmarshal(message, &clientJob)
 			if err != nil {
 				log.Printf("Error parsing client job from user %s: %v", userUUID, err)
 				continue
 			}
 
-			if strings.Compare(clientJob.Event, "ping") == 0 {
+			if strings.Compare(clientJob.Event, printprotocol.EventPing) == 0 {
 				log.Printf("🟢 Printer %s is alive, received ping", userUUID)
+				if registry := registeredPrinters(); registry != nil {
+					registry.Seen(userUUID)
+				}
 			} else {
 				// Send job log upstream
 				upstreamLogsChan <- UpstreamMsg{
@@ -168,6 +217,10 @@ func ConnectWS(c *websocket.Conn) {
 					Event:   clientJob.Event,
 					JobID:   clientJob.JobID,
 					Message: clientJob.Message,
+
+					ClientVersion: authMessage.ClientVersion,
+					PagesPrinted:  clientJob.PagesPrinted,
+					TotalPages:    clientJob.TotalPages,
 				}
 			}
 		}
@@ -185,8 +238,20 @@ func handleWebSocketWrites(sub *Subscription) {
 		}
 	}()
 
+	ticker := time.NewTicker(pingInterval())
+	defer ticker.Stop()
+
 	for {
 		select {
+		case <-ticker.C:
+			if err := ping(sub); err != nil {
+				log.Printf("Failed to ping user %s: %v", sub.UserUUID, err)
+				// Closing the connection ends the read loop, which
+				// unsubscribes the session
+				sub.Conn.Close()
+				return
+			}
+
 		case message, ok := <-sub.MessageChan:
 			if !ok {
 				log.Printf("Message channel closed for user %s", sub.UserUUID)
@@ -210,6 +275,7 @@ func handleWebSocketWrites(sub *Subscription) {
 			if err := sub.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				log.Printf("Failed to write message to user %s: %v", sub.UserUUID, err)
 				sub.Mutex.Unlock()
+				sub.Conn.Close()
 				return
 			}
 			sub.Mutex.Unlock()
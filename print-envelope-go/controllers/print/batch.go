@@ -0,0 +1,580 @@
+package print
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"printenvelope/logger"
+	"printenvelope/models/order"
+	"printenvelope/models/print"
+	"printenvelope/models/user"
+	"printenvelope/services"
+	"printenvelope/types"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Print status of an order batch, derived from the print jobs of its orders
+const (
+	BatchUnprinted = "UNPRINTED"
+	BatchPrinting  = "PRINTING"
+	BatchPartial   = "PARTIAL"
+	BatchFailed    = "FAILED"
+	BatchPrinted   = "PRINTED"
+)
+
+// latestPrintJoin picks, for each batch item, COMPLETED when any print job
+// of the batch printed the order and otherwise the status of its latest job.
+// Resumed jobs belong to the same batch, so their results count too.
+const latestPrintJoin = `LEFT JOIN LATERAL (
+	SELECT psj.status, psj.printed_at
+	FROM print_single_jobs psj
+	JOIN print_batch_jobs pbj ON pbj.id = psj.print_batch_job_id
+	WHERE psj.order_id = order_batch_items.order_id
+		AND pbj.order_batch_id = order_batch_items.order_batch_id
+		AND psj.is_deleted = false AND pbj.is_deleted = false
+	ORDER BY (psj.status = 'COMPLETED') DESC, psj.id DESC
+	LIMIT 1
+) latest ON true`
+
+// batchSummary is an order batch with the print progress of its orders
+type batchSummary struct {
+	order.OrderBatch
+	CreatedBy      string `json:"created_by"`
+	PrintableCount int64  `json:"printable_count"`
+	CancelledCount int64  `json:"cancelled_count"`
+	PrintedCount   int64  `json:"printed_count"`
+	FailedCount    int64  `json:"failed_count"`
+	PendingCount   int64  `json:"pending_count"`
+	PrintStatus    string `json:"print_status"`
+}
+
+// batchSummaries builds the query listing order batches with their counts
+// and print status. Cancelled batches are included only when cancelled is set.
+func batchSummaries(db *gorm.DB, cancelled bool) *gorm.DB {
+	stats := db.Table("order_batch_items").
+		Select(`order_batch_items.order_batch_id,
+			COUNT(*) FILTER (WHERE NOT orders.is_cancelled) AS printable_count,
+			COUNT(*) FILTER (WHERE orders.is_cancelled) AS cancelled_count,
+			COUNT(*) FILTER (WHERE NOT orders.is_cancelled AND latest.status = 'COMPLETED') AS printed_count,
+			COUNT(*) FILTER (WHERE NOT orders.is_cancelled AND latest.status = 'FAILED') AS failed_count`).
+		Joins("JOIN orders ON orders.id = order_batch_items.order_id").
+		Joins(latestPrintJoin).
+		Where("order_batch_items.is_deleted = ?", cancelled).
+		Group("order_batch_items.order_batch_id")
+
+	return db.Table("order_batches").
+		Select(`order_batches.*, COALESCE(users.username, '') AS created_by,
+			COALESCE(stats.printable_count, 0) AS printable_count,
+			COALESCE(stats.cancelled_count, 0) AS cancelled_count,
+			COALESCE(stats.printed_count, 0) AS printed_count,
+			COALESCE(stats.failed_count, 0) AS failed_count,
+			COALESCE(stats.printable_count - stats.printed_count - stats.failed_count, 0) AS pending_count,
+			CASE
+				WHEN stats.printable_count > 0 AND stats.printed_count >= stats.printable_count THEN ?
+				WHEN EXISTS (SELECT 1 FROM print_batch_jobs pbj WHERE pbj.order_batch_id = order_batches.id
+					AND pbj.is_deleted = false AND pbj.status IN ?) THEN ?
+				WHEN stats.failed_count > 0 THEN ?
+				WHEN stats.printed_count > 0 THEN ?
+				ELSE ?
+			END AS print_status`,
+			BatchPrinted, []print.PrintJobStatus{print.PrintJobPending, print.PrintJobProcessing}, BatchPrinting,
+			BatchFailed, BatchPartial, BatchUnprinted).
+		Joins("LEFT JOIN users ON users.id = order_batches.created_by_id").
+		Joins("LEFT JOIN (?) AS stats ON stats.order_batch_id = order_batches.id", stats).
+		Where("order_batches.is_deleted = ?", cancelled)
+}
+
+// BatchList lists order batches with their printed, failed and pending
+// counts. Filters: batch_number, created_by_id, created_by (username),
+// start_date/end_date, print_status and cancelled=true for cancelled batches.
+func (pc *PrintController) BatchList(c *fiber.Ctx) error {
+	page, pageSize := paging(c)
+
+	inner := batchSummaries(pc.db, c.QueryBool("cancelled"))
+	filters := make(map[string]interface{})
+
+	if batchNumber := c.Query("batch_number"); batchNumber != "" {
+		inner = inner.Where("order_batches.batch_number ILIKE ?", "%"+batchNumber+"%")
+		filters["batch_number"] = batchNumber
+	}
+	if createdByID := c.Query("created_by_id"); createdByID != "" {
+		if id, err := strconv.Atoi(createdByID); err == nil {
+			inner = inner.Where("order_batches.created_by_id = ?", id)
+			filters["created_by_id"] = id
+		}
+	}
+	if createdBy := c.Query("created_by"); createdBy != "" {
+		inner = inner.Where("users.username ILIKE ?", "%"+createdBy+"%")
+		filters["created_by"] = createdBy
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		if parsed, err := time.Parse("2006-01-02", startDate); err == nil {
+			inner = inner.Where("order_batches.created_at >= ?", parsed)
+			filters["start_date"] = startDate
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		if parsed, err := time.Parse("2006-01-02", endDate); err == nil {
+			// Add 1 day to include the entire end date
+			inner = inner.Where("order_batches.created_at < ?", parsed.AddDate(0, 0, 1))
+			filters["end_date"] = endDate
+		}
+	}
+	if c.QueryBool("cancelled") {
+		filters["cancelled"] = true
+	}
+
+	query := pc.db.Table("(?) AS batches", inner)
+	if printStatus := c.Query("print_status"); printStatus != "" {
+		query = query.Where("print_status IN ?", strings.Split(strings.ToUpper(printStatus), ","))
+		filters["print_status"] = printStatus
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Error("Failed to count order batches", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to count order batches",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	var batches []batchSummary
+	if err := query.Order("created_at DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&batches).Error; err != nil {
+		logger.Error("Failed to fetch order batches", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch order batches",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Order batches fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"batches":    batches,
+			"pagination": pagination(page, pageSize, total),
+			"filters":    filters,
+		},
+	})
+}
+
+// BatchDetail shows an order batch with its counts, its print batch jobs and
+// a page of its orders with their print status
+func (pc *PrintController) BatchDetail(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid batch ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	page, pageSize := paging(c)
+
+	var batches []batchSummary
+	for _, cancelled := range []bool{false, true} {
+		if err := batchSummaries(pc.db, cancelled).Where("order_batches.id = ?", id).Scan(&batches).Error; err != nil {
+			logger.Error("Failed to fetch order batch", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+				Message: "Failed to fetch order batch",
+				Status:  fiber.StatusInternalServerError,
+			})
+		}
+		if len(batches) > 0 {
+			break
+		}
+	}
+	if len(batches) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
+			Message: "Order batch not found",
+			Status:  fiber.StatusNotFound,
+		})
+	}
+	batch := batches[0]
+
+	var printJobs []print.PrintBatchJob
+	if err := pc.db.Where("order_batch_id = ? AND is_deleted = ?", batch.ID, false).
+		Order("created_at ASC").Find(&printJobs).Error; err != nil {
+		logger.Error("Failed to fetch print batch jobs", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch print jobs",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	items := pc.db.Table("order_batch_items").
+		Select(`orders.id AS order_id, orders.sequence, orders.is_cancelled,
+			addresses.recipient_fore_name, addresses.recipient_other_name, addresses.postal_address,
+			addresses.zip_code, addresses.city, returning_addresses.district_head_post_office,
+			returning_addresses.zip_code AS returning_zip_code, returning_addresses.district,
+			COALESCE(latest.status, ?) AS print_status, latest.printed_at`, BatchUnprinted).
+		Joins("JOIN orders ON orders.id = order_batch_items.order_id").
+		Joins("JOIN addresses ON addresses.id = orders.address_id").
+		Joins("JOIN returning_addresses ON returning_addresses.id = orders.returning_address_id").
+		Joins(latestPrintJoin).
+		Where("order_batch_items.order_batch_id = ? AND order_batch_items.is_deleted = ?", batch.ID, batch.IsDeleted)
+	if printStatus := c.Query("print_status"); printStatus != "" {
+		items = items.Where("COALESCE(latest.status, ?) IN ?", BatchUnprinted, strings.Split(strings.ToUpper(printStatus), ","))
+	}
+
+	var total int64
+	if err := items.Count(&total).Error; err != nil {
+		logger.Error("Failed to count batch orders", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to count batch orders",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	var orders []struct {
+		OrderID                uint       `json:"order_id"`
+		Sequence               int        `json:"sequence"`
+		IsCancelled            bool       `json:"is_cancelled"`
+		RecipientForeName      string     `json:"recipient_fore_name"`
+		RecipientOtherName     string     `json:"recipient_other_name"`
+		PostalAddress          string     `json:"postal_address"`
+		ZipCode                string     `json:"zip_code"`
+		City                   string     `json:"city"`
+		DistrictHeadPostOffice string     `json:"district_head_post_office"`
+		ReturningZipCode       string     `json:"returning_zip_code"`
+		District               string     `json:"district"`
+		PrintStatus            string     `json:"print_status"`
+		PrintedAt              *time.Time `json:"printed_at,omitempty"`
+	}
+	if err := items.Order("orders.sequence ASC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&orders).Error; err != nil {
+		logger.Error("Failed to fetch batch orders", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch batch orders",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Order batch fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"batch":      batch,
+			"print_jobs": printJobs,
+			"orders":     orders,
+			"pagination": pagination(page, pageSize, total),
+		},
+	})
+}
+
+// PrintedList lists printed orders, most recently printed first. Filters:
+// sequence, batch_number, job_type, reprint and start_date/end_date on the
+// print date.
+func (pc *PrintController) PrintedList(c *fiber.Ctx) error {
+	page, pageSize := paging(c)
+
+	query := pc.db.Table("print_single_jobs").
+		Select(`print_single_jobs.id, print_single_jobs.order_id, print_single_jobs.sequence,
+			print_single_jobs.job_type, print_single_jobs.printer_id, print_single_jobs.printed_at,
+			print_batch_jobs.id AS print_batch_job_id, print_batch_jobs.batch_number,
+			print_batch_jobs.reprint_request_id IS NOT NULL AS reprint,
+			addresses.recipient_fore_name, addresses.recipient_other_name, addresses.postal_address,
+			addresses.zip_code, addresses.city, returning_addresses.district_head_post_office,
+			returning_addresses.zip_code AS returning_zip_code, returning_addresses.district`).
+		Joins("JOIN print_batch_jobs ON print_batch_jobs.id = print_single_jobs.print_batch_job_id").
+		Joins("JOIN orders ON orders.id = print_single_jobs.order_id").
+		Joins("JOIN addresses ON addresses.id = orders.address_id").
+		Joins("JOIN returning_addresses ON returning_addresses.id = orders.returning_address_id").
+		Where("print_single_jobs.status = ? AND print_single_jobs.is_deleted = ? AND print_batch_jobs.is_deleted = ?",
+			print.PrintJobCompleted, false, false)
+	filters := make(map[string]interface{})
+
+	if sequence := c.Query("sequence"); sequence != "" {
+		if seq, err := strconv.Atoi(sequence); err == nil {
+			query = query.Where("print_single_jobs.sequence = ?", seq)
+			filters["sequence"] = seq
+		}
+	}
+	if batchNumber := c.Query("batch_number"); batchNumber != "" {
+		query = query.Where("print_batch_jobs.batch_number ILIKE ?", "%"+batchNumber+"%")
+		filters["batch_number"] = batchNumber
+	}
+	if jobType := c.Query("job_type"); jobType != "" {
+		query = query.Where("print_single_jobs.job_type = ?", jobType)
+		filters["job_type"] = jobType
+	}
+	if reprint := c.Query("reprint"); reprint != "" {
+		if c.QueryBool("reprint") {
+			query = query.Where("print_batch_jobs.reprint_request_id IS NOT NULL")
+		} else {
+			query = query.Where("print_batch_jobs.reprint_request_id IS NULL")
+		}
+		filters["reprint"] = reprint
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		if parsed, err := time.Parse("2006-01-02", startDate); err == nil {
+			query = query.Where("print_single_jobs.printed_at >= ?", parsed)
+			filters["start_date"] = startDate
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		if parsed, err := time.Parse("2006-01-02", endDate); err == nil {
+			// Add 1 day to include the entire end date
+			query = query.Where("print_single_jobs.printed_at < ?", parsed.AddDate(0, 0, 1))
+			filters["end_date"] = endDate
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Error("Failed to count printed orders", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to count printed orders",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	var printed []struct {
+		ID                     uint       `json:"id"`
+		OrderID                uint       `json:"order_id"`
+		Sequence               int        `json:"sequence"`
+		JobType                string     `json:"job_type"`
+		PrinterID              string     `json:"printer_id"`
+		PrintedAt              *time.Time `json:"printed_at"`
+		PrintBatchJobID        uint       `json:"print_batch_job_id"`
+		BatchNumber            string     `json:"batch_number"`
+		Reprint                bool       `json:"reprint"`
+		RecipientForeName      string     `json:"recipient_fore_name"`
+		RecipientOtherName     string     `json:"recipient_other_name"`
+		PostalAddress          string     `json:"postal_address"`
+		ZipCode                string     `json:"zip_code"`
+		City                   string     `json:"city"`
+		DistrictHeadPostOffice string     `json:"district_head_post_office"`
+		ReturningZipCode       string     `json:"returning_zip_code"`
+		District               string     `json:"district"`
+	}
+	if err := query.Order("print_single_jobs.printed_at DESC, print_single_jobs.sequence ASC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&printed).Error; err != nil {
+		logger.Error("Failed to fetch printed orders", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch printed orders",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Printed orders fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"printed":    printed,
+			"pagination": pagination(page, pageSize, total),
+			"filters":    filters,
+		},
+	})
+}
+
+// CancelBatch soft deletes an order batch that has no print jobs, so its
+// orders can be batched again
+func (pc *PrintController) CancelBatch(c *fiber.Ctx) error {
+	operator, errResp := pc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid batch ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var batch order.OrderBatch
+	err = pc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_deleted = ?", id, false).First(&batch).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fiber.NewError(fiber.StatusNotFound, "Order batch not found")
+			}
+			return err
+		}
+
+		var printJobs int64
+		if err := tx.Model(&print.PrintBatchJob{}).
+			Where("order_batch_id = ? AND is_deleted = ? AND status <> ?", batch.ID, false, print.PrintJobCancelled).
+			Count(&printJobs).Error; err != nil {
+			return err
+		}
+		if printJobs > 0 {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Batch %s has %d print job(s) and cannot be cancelled", batch.BatchNumber, printJobs))
+		}
+
+		now := time.Now()
+		deleted := map[string]interface{}{"deleted_at": now, "is_deleted": true}
+		if err := tx.Model(&order.OrderBatchItem{}).
+			Where("order_batch_id = ? AND is_deleted = ?", batch.ID, false).
+			Updates(deleted).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&batch).Updates(deleted).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     operator.ID,
+			AdminUUID:   operator.Uuid,
+			Action:      "CANCEL_ORDER_BATCH",
+			EntityType:  "ORDER_BATCH",
+			EntityID:    batch.ID,
+			Description: fmt.Sprintf("Cancelled batch %s of %d orders (sequences %d to %d)", batch.BatchNumber, batch.TotalOrders, batch.StartSequence, batch.EndSequence),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err != nil {
+		return pc.txError(c, "Failed to cancel order batch", err)
+	}
+
+	logger.Success(fmt.Sprintf("Batch %s cancelled by %s", batch.BatchNumber, operator.Username))
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Order batch cancelled successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"batch": batch,
+		},
+	})
+}
+
+// SplitBatch splits an unprinted order batch at a sequence or into batches of
+// a given size. The new batches take the next numbers of the batch's prefix.
+func (pc *PrintController) SplitBatch(c *fiber.Ctx) error {
+	operator, errResp := pc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid batch ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	var req types.BatchSplitRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse batch split request", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var batches []order.OrderBatch
+	err = pc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		batches, err = services.NewBatchingService(tx).SplitBatch(uint(id), req.AtSequence, req.Size, operator.ID)
+		if err != nil {
+			return batchOpError(err)
+		}
+
+		numbers := make([]string, 0, len(batches)-1)
+		for _, batch := range batches[1:] {
+			numbers = append(numbers, batch.BatchNumber)
+		}
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     operator.ID,
+			AdminUUID:   operator.Uuid,
+			Action:      "SPLIT_ORDER_BATCH",
+			EntityType:  "ORDER_BATCH",
+			EntityID:    batches[0].ID,
+			Description: fmt.Sprintf("Split batch %s into %s and %s", batches[0].BatchNumber, batches[0].BatchNumber, strings.Join(numbers, ", ")),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err != nil {
+		return pc.txError(c, "Failed to split order batch", err)
+	}
+
+	logger.Success(fmt.Sprintf("Batch %s split into %d batches by %s", batches[0].BatchNumber, len(batches), operator.Username))
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Order batch split successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"batches":       batches,
+			"total_batches": len(batches),
+		},
+	})
+}
+
+// MergeBatches moves the orders of unprinted batches into the first batch
+// given and cancels the batches left empty
+func (pc *PrintController) MergeBatches(c *fiber.Ctx) error {
+	operator, errResp := pc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+	var req types.BatchMergeRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse batch merge request", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var merged *order.OrderBatch
+	err := pc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		merged, err = services.NewBatchingService(tx).MergeBatches(req.BatchIDs, operator.ID)
+		if err != nil {
+			return batchOpError(err)
+		}
+
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     operator.ID,
+			AdminUUID:   operator.Uuid,
+			Action:      "MERGE_ORDER_BATCH",
+			EntityType:  "ORDER_BATCH",
+			EntityID:    merged.ID,
+			Description: fmt.Sprintf("Merged batches %v into %s, now %d orders (sequences %d to %d)", req.BatchIDs, merged.BatchNumber, merged.TotalOrders, merged.StartSequence, merged.EndSequence),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err != nil {
+		return pc.txError(c, "Failed to merge order batches", err)
+	}
+
+	logger.Success(fmt.Sprintf("Merged %d batches into %s by %s", len(req.BatchIDs), merged.BatchNumber, operator.Username))
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Order batches merged successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"batch": merged,
+		},
+	})
+}
+
+// batchOpError turns the batching service's split and merge errors into
+// request errors
+func batchOpError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrBatchNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "Order batch not found")
+	case errors.Is(err, services.ErrBatchHasPrints):
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Only unprinted batches can be changed: %v", err))
+	case errors.Is(err, services.ErrInvalidBatchOp):
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return err
+}
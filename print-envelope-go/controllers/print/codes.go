@@ -0,0 +1,126 @@
+package print
+
+import (
+	"fmt"
+
+	"printenvelope/layout"
+	"printenvelope/textlayout"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"github.com/signintech/gopdf"
+)
+
+// qrLevels maps template error correction names to encoder levels
+var qrLevels = map[string]qr.ErrorCorrectionLevel{
+	"L": qr.L,
+	"M": qr.M,
+	"Q": qr.Q,
+	"H": qr.H,
+}
+
+// drawQRCode draws value as a QR code filling the box, quiet zone included.
+// Modules are drawn as vector rectangles so they stay sharp at any DPI.
+func drawQRCode(pdf *gopdf.GoPdf, box layout.QRBox, value string) error {
+	code, err := qr.Encode(value, qrLevels[box.ErrorCorrection], qr.Auto)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	modules := code.Bounds().Dx()
+	module := box.Size / float64(modules+2*box.QuietZone)
+	if module < box.MinModule {
+		return fmt.Errorf("QR module of %.2fpt for %d modules is below the %.2fpt minimum", module, modules, box.MinModule)
+	}
+
+	clearArea(pdf, box.X, box.Y, box.Size, box.Size)
+
+	originX := box.X + float64(box.QuietZone)*module
+	originY := box.Y + float64(box.QuietZone)*module
+	pdf.SetFillColor(0, 0, 0)
+	for row := 0; row < modules; row++ {
+		// Merge horizontal runs of dark modules into a single rectangle
+		for col := 0; col < modules; {
+			if !isDark(code, col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < modules && isDark(code, col, row) {
+				col++
+			}
+			pdf.RectFromUpperLeftWithStyle(originX+float64(start)*module, originY+float64(row)*module,
+				float64(col-start)*module, module, "F")
+		}
+	}
+
+	return nil
+}
+
+// drawBarcode draws value as a Code128 barcode filling the box width, with
+// the quiet zone on both sides and an optional caption under the bars
+func drawBarcode(pdf *gopdf.GoPdf, text *textlayout.Engine, box layout.BarcodeBox, value string) error {
+	code, err := code128.Encode(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode barcode: %w", err)
+	}
+
+	modules := code.Bounds().Dx()
+	module := box.Width / float64(modules+2*box.QuietZone)
+	if module < box.MinModule {
+		return fmt.Errorf("barcode module of %.2fpt for %d modules is below the %.2fpt minimum", module, modules, box.MinModule)
+	}
+
+	barHeight := box.Height
+	if box.ShowText {
+		barHeight -= box.FontSize * 1.2
+	}
+	if barHeight <= 0 {
+		return fmt.Errorf("barcode box is too short for its caption")
+	}
+
+	clearArea(pdf, box.X, box.Y, box.Width, box.Height)
+
+	originX := box.X + float64(box.QuietZone)*module
+	pdf.SetFillColor(0, 0, 0)
+	for col := 0; col < modules; {
+		if !isDark(code, col, 0) {
+			col++
+			continue
+		}
+		start := col
+		for col < modules && isDark(code, col, 0) {
+			col++
+		}
+		pdf.RectFromUpperLeftWithStyle(originX+float64(start)*module, box.Y, float64(col-start)*module, barHeight, "F")
+	}
+
+	if box.ShowText {
+		style := textlayout.Style{Font: box.Font, Size: box.FontSize}
+		lines, err := text.Wrap(value, style, box.Width)
+		if err != nil {
+			return err
+		}
+		if len(lines) > 0 {
+			x := box.X + (box.Width-lines[0].Width)/2
+			if err := text.DrawLine(lines[0], x, box.Y+barHeight); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// clearArea paints the box white so background artwork cannot intrude on
+// the quiet zone
+func clearArea(pdf *gopdf.GoPdf, x, y, width, height float64) {
+	pdf.SetFillColor(255, 255, 255)
+	pdf.RectFromUpperLeftWithStyle(x, y, width, height, "F")
+}
+
+func isDark(code barcode.Barcode, x, y int) bool {
+	r, _, _, _ := code.At(code.Bounds().Min.X+x, code.Bounds().Min.Y+y).RGBA()
+	return r == 0
+}
@@ -0,0 +1,589 @@
+package print
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"printenvelope/layout"
+	"printenvelope/logger"
+	"printenvelope/models/order"
+	"printenvelope/models/print"
+	"printenvelope/textlayout"
+	"printenvelope/types"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/signintech/gopdf"
+	"gorm.io/gorm"
+)
+
+// Fonts used for dispatch paperwork. Recipient names may be in Bangla, so
+// the complex font shapes those runs.
+const (
+	dispatchFont        = "fonts/ArialMT.ttf"
+	dispatchBoldFont    = "fonts/ArialMT-Bold.ttf"
+	dispatchComplexFont = "fonts/kalpurush.ttf"
+)
+
+// Page sizes in points: manifests are A4, bag tags 4x6 inch labels
+var (
+	manifestPage = gopdf.Rect{W: 595.28, H: 841.89}
+	bagTagPage   = gopdf.Rect{W: 288, H: 432}
+)
+
+// dispatchRow is a printed order of a batch as it appears on the manifest
+type dispatchRow struct {
+	OrderID                uint
+	Sequence               int
+	RecipientForeName      string
+	RecipientOtherName     string
+	ZipCode                string
+	City                   string
+	QrID                   string
+	DistrictHeadPostOffice string
+	ReturningZipCode       string
+	District               string
+}
+
+// Recipient returns the full recipient name
+func (r dispatchRow) Recipient() string {
+	return strings.TrimSpace(r.RecipientForeName + " " + r.RecipientOtherName)
+}
+
+// postOfficeGroup holds the rows returned to one post office. Envelopes are
+// bagged per group.
+type postOfficeGroup struct {
+	DistrictHeadPostOffice string
+	ReturningZipCode       string
+	District               string
+	Rows                   []dispatchRow
+}
+
+// dispatchBatch is a batch with its printed orders grouped by returning post
+// office, plus the number of orders left out because they are not printed
+type dispatchBatch struct {
+	Batch     order.OrderBatch
+	Groups    []postOfficeGroup
+	Total     int
+	Unprinted int64
+}
+
+// loadDispatchBatch resolves the batch in the :id parameter and loads its
+// printed, non-cancelled orders ordered by returning post office and sequence
+func (pc *PrintController) loadDispatchBatch(c *fiber.Ctx) (*dispatchBatch, *types.ErrorResponse) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, &types.ErrorResponse{Message: "Invalid batch ID", Status: fiber.StatusBadRequest}
+	}
+
+	var batch order.OrderBatch
+	if err := pc.db.Where("id = ? AND is_deleted = ?", id, false).First(&batch).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &types.ErrorResponse{Message: "Order batch not found", Status: fiber.StatusNotFound}
+		}
+		logger.Error("Failed to fetch order batch", err)
+		return nil, &types.ErrorResponse{Message: "Failed to fetch order batch", Status: fiber.StatusInternalServerError}
+	}
+
+	items := func() *gorm.DB {
+		return pc.db.Table("order_batch_items").
+			Joins("JOIN orders ON orders.id = order_batch_items.order_id").
+			Joins(latestPrintJoin).
+			Where("order_batch_items.order_batch_id = ? AND order_batch_items.is_deleted = ? AND orders.is_cancelled = ?", batch.ID, false, false)
+	}
+
+	var rows []dispatchRow
+	if err := items().
+		Select(`orders.id AS order_id, orders.sequence, addresses.recipient_fore_name, addresses.recipient_other_name,
+			addresses.zip_code, addresses.city, addresses.qr_id, returning_addresses.district_head_post_office,
+			returning_addresses.zip_code AS returning_zip_code, returning_addresses.district`).
+		Joins("JOIN addresses ON addresses.id = orders.address_id").
+		Joins("JOIN returning_addresses ON returning_addresses.id = orders.returning_address_id").
+		Where("latest.status = ?", print.PrintJobCompleted).
+		Order("returning_addresses.district ASC, returning_addresses.district_head_post_office ASC, returning_addresses.zip_code ASC, orders.sequence ASC").
+		Scan(&rows).Error; err != nil {
+		logger.Error("Failed to fetch batch orders for dispatch", err)
+		return nil, &types.ErrorResponse{Message: "Failed to fetch batch orders", Status: fiber.StatusInternalServerError}
+	}
+	if len(rows) == 0 {
+		return nil, &types.ErrorResponse{
+			Message: fmt.Sprintf("Batch %s has no printed orders to dispatch", batch.BatchNumber),
+			Status:  fiber.StatusConflict,
+		}
+	}
+
+	var unprinted int64
+	if err := items().Where("latest.status IS DISTINCT FROM ?", print.PrintJobCompleted).
+		Count(&unprinted).Error; err != nil {
+		logger.Error("Failed to count unprinted batch orders", err)
+		return nil, &types.ErrorResponse{Message: "Failed to count batch orders", Status: fiber.StatusInternalServerError}
+	}
+
+	dispatch := &dispatchBatch{Batch: batch, Total: len(rows), Unprinted: unprinted}
+	for _, row := range rows {
+		n := len(dispatch.Groups)
+		if n == 0 || dispatch.Groups[n-1].District != row.District ||
+			dispatch.Groups[n-1].DistrictHeadPostOffice != row.DistrictHeadPostOffice ||
+			dispatch.Groups[n-1].ReturningZipCode != row.ReturningZipCode {
+			dispatch.Groups = append(dispatch.Groups, postOfficeGroup{
+				DistrictHeadPostOffice: row.DistrictHeadPostOffice,
+				ReturningZipCode:       row.ReturningZipCode,
+				District:               row.District,
+			})
+			n++
+		}
+		dispatch.Groups[n-1].Rows = append(dispatch.Groups[n-1].Rows, row)
+	}
+	return dispatch, nil
+}
+
+// DispatchManifest returns the dispatch manifest of an order batch: its
+// printed orders listed by returning post office with sequence, recipient,
+// zip and QR ID, and the envelope totals per post office. format=csv returns
+// the same data as CSV; the default is a PDF.
+func (pc *PrintController) DispatchManifest(c *fiber.Ctx) error {
+	dispatch, errResp := pc.loadDispatchBatch(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	switch strings.ToLower(c.Query("format", "pdf")) {
+	case "csv":
+		data, err := renderManifestCSV(dispatch)
+		if err != nil {
+			logger.Error("Failed to render dispatch manifest CSV", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+				Message: "Failed to generate manifest",
+				Status:  fiber.StatusInternalServerError,
+			})
+		}
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-manifest.csv", dispatch.Batch.BatchNumber))
+		return c.Send(data)
+	case "pdf":
+		data, err := renderManifestPDF(dispatch)
+		if err != nil {
+			logger.Error("Failed to render dispatch manifest PDF", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+				Message: "Failed to generate manifest",
+				Status:  fiber.StatusInternalServerError,
+			})
+		}
+		c.Set("Content-Type", "application/pdf")
+		c.Set("Content-Disposition", fmt.Sprintf("inline; filename=%s-manifest.pdf", dispatch.Batch.BatchNumber))
+		return c.Send(data)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Format must be pdf or csv",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+}
+
+// BagTags returns printable bag tags for an order batch, one per returning
+// post office. bag_size splits a post office holding more envelopes into
+// several bags. Every tag carries a Code128 barcode of its bag code.
+func (pc *PrintController) BagTags(c *fiber.Ctx) error {
+	bagSize := c.QueryInt("bag_size", 0)
+	if bagSize < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Bag size must not be negative",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	dispatch, errResp := pc.loadDispatchBatch(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	data, err := renderBagTags(dispatch, bagSize)
+	if err != nil {
+		logger.Error("Failed to render bag tags", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to generate bag tags",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=%s-bag-tags.pdf", dispatch.Batch.BatchNumber))
+	return c.Send(data)
+}
+
+// renderManifestCSV writes one line per order followed, after an empty line,
+// by the totals per returning post office
+func renderManifestCSV(dispatch *dispatchBatch) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	records := [][]string{{"batch_number", "sequence", "recipient", "city", "zip_code", "qr_id",
+		"district", "district_head_post_office", "returning_zip_code"}}
+	for _, group := range dispatch.Groups {
+		for _, row := range group.Rows {
+			records = append(records, []string{dispatch.Batch.BatchNumber, strconv.Itoa(row.Sequence), row.Recipient(),
+				row.City, row.ZipCode, row.QrID, row.District, row.DistrictHeadPostOffice, row.ReturningZipCode})
+		}
+	}
+
+	records = append(records, nil, []string{"district", "district_head_post_office", "returning_zip_code", "total_envelopes"})
+	for _, group := range dispatch.Groups {
+		records = append(records, []string{group.District, group.DistrictHeadPostOffice, group.ReturningZipCode, strconv.Itoa(len(group.Rows))})
+	}
+	records = append(records, []string{"", "", "TOTAL", strconv.Itoa(dispatch.Total)})
+
+	if err := w.WriteAll(records); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// dispatchDoc draws dispatch paperwork with the shared text engine
+type dispatchDoc struct {
+	pdf  *gopdf.GoPdf
+	text *textlayout.Engine
+}
+
+func newDispatchDoc(page gopdf.Rect) (*dispatchDoc, error) {
+	pdf := gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: page})
+	d := &dispatchDoc{pdf: &pdf, text: textlayout.New(&pdf)}
+	for _, font := range [][2]string{
+		{"regular", dispatchFont},
+		{"bold", dispatchBoldFont},
+		{"bangla", dispatchComplexFont},
+	} {
+		if err := d.text.AddFont(font[0], font[1]); err != nil {
+			return nil, fmt.Errorf("failed to load font %s: %w", font[1], err)
+		}
+	}
+	return d, nil
+}
+
+func (d *dispatchDoc) style(bold bool, size float64) textlayout.Style {
+	font := "regular"
+	if bold {
+		font = "bold"
+	}
+	return textlayout.Style{Font: font, ComplexFont: "bangla", Size: size}
+}
+
+// cell draws value on one line at x, y, cut to fit width. align is "left",
+// "center" or "right".
+func (d *dispatchDoc) cell(value string, style textlayout.Style, x, y, width float64, align string) error {
+	if value == "" {
+		return nil
+	}
+	lines, err := d.text.Wrap(value, style, width)
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+	switch align {
+	case "center":
+		x += (width - lines[0].Width) / 2
+	case "right":
+		x += width - lines[0].Width
+	}
+	return d.text.DrawLine(lines[0], x, y)
+}
+
+func (d *dispatchDoc) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.pdf.Write(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// manifestColumn is a column of the manifest order table
+type manifestColumn struct {
+	title string
+	width float64
+	align string
+	value func(row dispatchRow) string
+}
+
+var manifestColumns = []manifestColumn{
+	{"Sequence", 60, "right", func(r dispatchRow) string { return strconv.Itoa(r.Sequence) }},
+	{"Recipient", 200, "left", dispatchRow.Recipient},
+	{"City", 110, "left", func(r dispatchRow) string { return r.City }},
+	{"Zip", 50, "left", func(r dispatchRow) string { return r.ZipCode }},
+	{"QR ID", 103, "left", func(r dispatchRow) string { return r.QrID }},
+}
+
+const (
+	manifestMargin    = 36.0
+	manifestRowHeight = 14.0
+	manifestCellPad   = 4.0
+)
+
+// manifestWriter lays out manifest rows over as many pages as needed,
+// repeating the page heading and column titles on every page
+type manifestWriter struct {
+	*dispatchDoc
+	dispatch *dispatchBatch
+	y        float64
+	page     int
+}
+
+// renderManifestPDF lists each returning post office with its orders, then
+// the totals per post office
+func renderManifestPDF(dispatch *dispatchBatch) ([]byte, error) {
+	doc, err := newDispatchDoc(manifestPage)
+	if err != nil {
+		return nil, err
+	}
+	w := &manifestWriter{dispatchDoc: doc, dispatch: dispatch}
+	if err := w.newPage(); err != nil {
+		return nil, err
+	}
+
+	for _, group := range dispatch.Groups {
+		// Keep a post office heading together with its first rows
+		if err := w.ensure(3 * manifestRowHeight); err != nil {
+			return nil, err
+		}
+		if err := w.groupHeading(group); err != nil {
+			return nil, err
+		}
+		if err := w.columnTitles(); err != nil {
+			return nil, err
+		}
+		for _, row := range group.Rows {
+			if w.y+manifestRowHeight > manifestPage.H-manifestMargin {
+				if err := w.newPage(); err != nil {
+					return nil, err
+				}
+				if err := w.columnTitles(); err != nil {
+					return nil, err
+				}
+			}
+			if err := w.row(row); err != nil {
+				return nil, err
+			}
+		}
+		w.y += manifestRowHeight / 2
+	}
+
+	if err := w.totals(); err != nil {
+		return nil, err
+	}
+	return w.bytes()
+}
+
+// ensure starts a new page when height does not fit on the current one
+func (w *manifestWriter) ensure(height float64) error {
+	if w.y+height <= manifestPage.H-manifestMargin {
+		return nil
+	}
+	return w.newPage()
+}
+
+func (w *manifestWriter) newPage() error {
+	w.pdf.AddPage()
+	w.page++
+	w.y = manifestMargin
+	width := manifestPage.W - 2*manifestMargin
+	batch := w.dispatch.Batch
+
+	if err := w.cell("DISPATCH MANIFEST", w.style(true, 16), manifestMargin, w.y, width, "left"); err != nil {
+		return err
+	}
+	if err := w.cell(fmt.Sprintf("Page %d", w.page), w.style(false, 9), manifestMargin, w.y, width, "right"); err != nil {
+		return err
+	}
+	w.y += 22
+
+	summary := fmt.Sprintf("Batch %s   Sequences %d to %d   Envelopes %d   Post offices %d   Generated %s",
+		batch.BatchNumber, batch.StartSequence, batch.EndSequence, w.dispatch.Total, len(w.dispatch.Groups),
+		time.Now().Format("2006-01-02 15:04"))
+	if err := w.cell(summary, w.style(false, 9), manifestMargin, w.y, width, "left"); err != nil {
+		return err
+	}
+	w.y += manifestRowHeight
+	if w.dispatch.Unprinted > 0 {
+		note := fmt.Sprintf("%d order(s) of this batch are not printed and are not listed", w.dispatch.Unprinted)
+		if err := w.cell(note, w.style(true, 9), manifestMargin, w.y, width, "left"); err != nil {
+			return err
+		}
+		w.y += manifestRowHeight
+	}
+	w.rule(1)
+	w.y += manifestRowHeight / 2
+	return nil
+}
+
+func (w *manifestWriter) groupHeading(group postOfficeGroup) error {
+	heading := fmt.Sprintf("%s, %s %s  (%d envelopes)", group.District, group.DistrictHeadPostOffice, group.ReturningZipCode, len(group.Rows))
+	if err := w.cell(heading, w.style(true, 11), manifestMargin, w.y, manifestPage.W-2*manifestMargin, "left"); err != nil {
+		return err
+	}
+	w.y += manifestRowHeight + 2
+	return nil
+}
+
+func (w *manifestWriter) columnTitles() error {
+	x := manifestMargin
+	for _, col := range manifestColumns {
+		if err := w.cell(col.title, w.style(true, 9), x+manifestCellPad, w.y, col.width-2*manifestCellPad, col.align); err != nil {
+			return err
+		}
+		x += col.width
+	}
+	w.y += manifestRowHeight
+	w.rule(0.5)
+	w.y += 2
+	return nil
+}
+
+func (w *manifestWriter) row(row dispatchRow) error {
+	x := manifestMargin
+	for _, col := range manifestColumns {
+		if err := w.cell(col.value(row), w.style(false, 9), x+manifestCellPad, w.y, col.width-2*manifestCellPad, col.align); err != nil {
+			return err
+		}
+		x += col.width
+	}
+	w.y += manifestRowHeight
+	return nil
+}
+
+// totals writes the envelope count per returning post office and the batch
+// total
+func (w *manifestWriter) totals() error {
+	// Keep the heading together with its first rows; a long table runs on
+	// to further pages
+	if err := w.ensure(4 * manifestRowHeight); err != nil {
+		return err
+	}
+	width := manifestPage.W - 2*manifestMargin
+	if err := w.cell("TOTALS PER RETURNING POST OFFICE", w.style(true, 11), manifestMargin, w.y, width, "left"); err != nil {
+		return err
+	}
+	w.y += manifestRowHeight + 2
+	w.rule(0.5)
+	w.y += 2
+
+	line := func(label string, count int, bold bool) error {
+		if w.y+manifestRowHeight > manifestPage.H-manifestMargin {
+			if err := w.newPage(); err != nil {
+				return err
+			}
+		}
+		if err := w.cell(label, w.style(bold, 9), manifestMargin+manifestCellPad, w.y, width-100, "left"); err != nil {
+			return err
+		}
+		if err := w.cell(strconv.Itoa(count), w.style(bold, 9), manifestPage.W-manifestMargin-100, w.y, 100-manifestCellPad, "right"); err != nil {
+			return err
+		}
+		w.y += manifestRowHeight
+		return nil
+	}
+	for _, group := range w.dispatch.Groups {
+		if err := line(fmt.Sprintf("%s, %s %s", group.District, group.DistrictHeadPostOffice, group.ReturningZipCode), len(group.Rows), false); err != nil {
+			return err
+		}
+	}
+	w.rule(0.5)
+	w.y += 2
+	return line("Total envelopes", w.dispatch.Total, true)
+}
+
+// rule draws a horizontal line across the page at the current position
+func (w *manifestWriter) rule(width float64) {
+	w.pdf.SetLineWidth(width)
+	w.pdf.Line(manifestMargin, w.y, manifestPage.W-manifestMargin, w.y)
+}
+
+// bagTag is one bag of envelopes returned to a post office
+type bagTag struct {
+	Code   string
+	Number int
+	Group  postOfficeGroup
+	Rows   []dispatchRow
+}
+
+// dispatchBags cuts every post office group into bags of at most bagSize
+// envelopes, or one bag per group when bagSize is zero. Bags are numbered
+// through the batch and coded <batch number>-B<number>.
+func dispatchBags(dispatch *dispatchBatch, bagSize int) []bagTag {
+	var bags []bagTag
+	for _, group := range dispatch.Groups {
+		size := bagSize
+		if size == 0 {
+			size = len(group.Rows)
+		}
+		for start := 0; start < len(group.Rows); start += size {
+			end := start + size
+			if end > len(group.Rows) {
+				end = len(group.Rows)
+			}
+			number := len(bags) + 1
+			bags = append(bags, bagTag{
+				Code:   fmt.Sprintf("%s-B%02d", dispatch.Batch.BatchNumber, number),
+				Number: number,
+				Group:  group,
+				Rows:   group.Rows[start:end],
+			})
+		}
+	}
+	return bags
+}
+
+// renderBagTags draws one 4x6 inch tag per bag with the destination post
+// office, envelope count, sequence range and a barcode of the bag code
+func renderBagTags(dispatch *dispatchBatch, bagSize int) ([]byte, error) {
+	doc, err := newDispatchDoc(bagTagPage)
+	if err != nil {
+		return nil, err
+	}
+
+	const margin = 20.0
+	width := bagTagPage.W - 2*margin
+	bags := dispatchBags(dispatch, bagSize)
+	for _, bag := range bags {
+		doc.pdf.AddPage()
+		y := margin
+
+		lines := []struct {
+			value string
+			bold  bool
+			size  float64
+			gap   float64
+		}{
+			{"POSTAL BALLOT DISPATCH", true, 14, 28},
+			{"TO", false, 9, 13},
+			{bag.Group.DistrictHeadPostOffice, true, 18, 24},
+			{fmt.Sprintf("%s %s", bag.Group.District, bag.Group.ReturningZipCode), true, 14, 30},
+			{fmt.Sprintf("Batch: %s", dispatch.Batch.BatchNumber), false, 11, 17},
+			{fmt.Sprintf("Envelopes: %d", len(bag.Rows)), true, 14, 20},
+			{fmt.Sprintf("Sequences: %d to %d", bag.Rows[0].Sequence, bag.Rows[len(bag.Rows)-1].Sequence), false, 11, 17},
+			{fmt.Sprintf("Bag %d of %d", bag.Number, len(bags)), true, 14, 30},
+		}
+		for _, line := range lines {
+			if err := doc.cell(line.value, doc.style(line.bold, line.size), margin, y, width, "left"); err != nil {
+				return nil, err
+			}
+			y += line.gap
+		}
+
+		box := layout.BarcodeBox{
+			Name:      "bag_code",
+			X:         margin,
+			Y:         bagTagPage.H - margin - 90,
+			Width:     width,
+			Height:    90,
+			QuietZone: layout.Code128MinQuietZone,
+			ShowText:  true,
+			Font:      "regular",
+			FontSize:  10,
+		}
+		if err := drawBarcode(doc.pdf, doc.text, box, bag.Code); err != nil {
+			return nil, fmt.Errorf("bag %s: %w", bag.Code, err)
+		}
+	}
+	return doc.bytes()
+}
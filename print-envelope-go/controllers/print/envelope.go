@@ -0,0 +1,260 @@
+package print
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+
+	"printenvelope/layout"
+	"printenvelope/models/print"
+	"printenvelope/textlayout"
+	"printprotocol"
+
+	"github.com/signintech/gopdf"
+)
+
+// envelopeRenderer draws template pages into a single PDF. Templates may
+// share font names, so fonts are registered per template and deduplicated by
+// file so each font is embedded once.
+type envelopeRenderer struct {
+	pdf         *gopdf.GoPdf
+	text        *textlayout.Engine
+	families    map[string]string // template + font name -> PDF family
+	byPath      map[string]string // font file -> PDF family
+	backgrounds map[string]gopdf.ImageHolder
+}
+
+// orderDrawError reports the order whose data could not be drawn, such as a
+// QR or barcode value too long for its box, so it can be fixed or taken out
+// of the batch
+type orderDrawError struct {
+	Page     string
+	Sequence int
+	Err      error
+}
+
+func (e *orderDrawError) Error() string {
+	return fmt.Sprintf("failed to draw %s page for order %d: %s", e.Page, e.Sequence, e.Err.Error())
+}
+
+func (e *orderDrawError) Unwrap() error {
+	return e.Err
+}
+
+// renderEnvelopePDF draws the template's pages for every PrintJobData row and
+// returns the resulting multi-page PDF. Kits produce one page per component
+// per row, so a voter's documents stay together. When specimen is set every
+// page is stamped so it cannot be mistaken for a live envelope.
+func renderEnvelopePDF(tpl *layout.Template, rows []print.PrintJobData, specimen bool) ([]byte, error) {
+	pdf := gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: gopdf.Rect{W: tpl.Page.Width, H: tpl.Page.Height}})
+
+	r := &envelopeRenderer{
+		pdf:         &pdf,
+		text:        textlayout.New(&pdf),
+		families:    make(map[string]string),
+		byPath:      make(map[string]string),
+		backgrounds: make(map[string]gopdf.ImageHolder),
+	}
+	for _, page := range tpl.Pages() {
+		if err := r.addTemplate(page); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range rows {
+		fields := layout.Fields(row)
+		for _, page := range tpl.Pages() {
+			if err := r.drawPage(page, fields, specimen); err != nil {
+				return nil, &orderDrawError{Page: page.Name, Sequence: row.Sequence, Err: err}
+			}
+		}
+	}
+
+	var pdfBuf bytes.Buffer
+	if err := pdf.Write(&pdfBuf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return pdfBuf.Bytes(), nil
+}
+
+// jobPageSizes lists the paper size of each page of a kit whose pages
+// differ in size, so the print client can change paper between them. It is
+// nil when every page has the template's size.
+func jobPageSizes(tpl *layout.Template) []printprotocol.PageSize {
+	var sizes []printprotocol.PageSize
+	mixed := false
+	for _, page := range tpl.Pages() {
+		sizes = append(sizes, printprotocol.PageSize{Width: page.WidthInch(), Height: page.HeightInch()})
+		mixed = mixed || page.Page != tpl.Page
+	}
+	if !mixed {
+		return nil
+	}
+	return sizes
+}
+
+// addTemplate registers the fonts and background image of a page template
+func (r *envelopeRenderer) addTemplate(tpl *layout.Template) error {
+	names := make([]string, 0, len(tpl.Fonts))
+	for name := range tpl.Fonts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := tpl.Fonts[name]
+		family, ok := r.byPath[path]
+		if !ok {
+			family = fmt.Sprintf("f%d", len(r.byPath))
+			if err := r.text.AddFont(family, path); err != nil {
+				return fmt.Errorf("failed to load font %s: %w", name, err)
+			}
+			r.byPath[path] = family
+		}
+		r.families[tpl.Name+"/"+name] = family
+	}
+
+	// Background holders are shared so each image is embedded only once
+	if tpl.Background != "" {
+		holder, err := gopdf.ImageHolderByPath(tpl.Background)
+		if err != nil {
+			log.Println("Failed to load background image:", err)
+		} else {
+			r.backgrounds[tpl.Name] = holder
+		}
+	}
+
+	return nil
+}
+
+// family returns the PDF font family for a template font name
+func (r *envelopeRenderer) family(tpl *layout.Template, name string) string {
+	if name == "" {
+		return ""
+	}
+	return r.families[tpl.Name+"/"+name]
+}
+
+// drawPage adds one page sized for tpl and fills it with the row's fields
+func (r *envelopeRenderer) drawPage(tpl *layout.Template, fields map[string]string, specimen bool) error {
+	pageSize := gopdf.Rect{W: tpl.Page.Width, H: tpl.Page.Height}
+	r.pdf.AddPageWithOption(gopdf.PageOption{PageSize: &pageSize})
+
+	if background, ok := r.backgrounds[tpl.Name]; ok {
+		if err := r.pdf.ImageByHolder(background, 0, 0, &pageSize); err != nil {
+			log.Println("Failed to draw background image:", err)
+		}
+	}
+
+	if err := r.drawTemplateFields(tpl, fields); err != nil {
+		return err
+	}
+
+	if specimen {
+		r.drawSpecimenStamp(tpl)
+	}
+	return nil
+}
+
+// drawTemplateFields writes every QR code, barcode and text box of the
+// template onto the current page. Codes go first because they clear their
+// quiet zone, which must not hide text placed next to them.
+func (r *envelopeRenderer) drawTemplateFields(tpl *layout.Template, fields map[string]string) error {
+	for _, box := range tpl.QRCodes {
+		if value := fields[box.Field]; value != "" {
+			if err := drawQRCode(r.pdf, box, value); err != nil {
+				return fmt.Errorf("qr code %s: %w", box.Name, err)
+			}
+		}
+	}
+
+	for _, box := range tpl.Barcodes {
+		if value := fields[box.Field]; value != "" {
+			box.Font = r.family(tpl, box.Font)
+			if err := drawBarcode(r.pdf, r.text, box, value); err != nil {
+				return fmt.Errorf("barcode %s: %w", box.Name, err)
+			}
+		}
+	}
+
+	for _, box := range tpl.Text {
+		style := textlayout.Style{
+			Font:        r.family(tpl, box.Font),
+			ComplexFont: r.family(tpl, box.ComplexFont),
+			Size:        box.FontSize,
+		}
+		if err := drawTextBox(r.text, box, style, fields); err != nil {
+			return fmt.Errorf("text box %s: %w", box.Name, err)
+		}
+	}
+	return nil
+}
+
+// drawTextBox renders the lines of a text box, wrapping each to the box width
+// and stopping once the box height (when set) is exhausted
+func drawTextBox(text *textlayout.Engine, box layout.TextBox, style textlayout.Style, fields map[string]string) error {
+	y := box.Y
+	bottom := box.Y + box.Height
+	for _, line := range box.Lines {
+		value, ok := layout.Expand(line, fields)
+		if !ok || value == "" {
+			continue
+		}
+
+		wrapped, err := text.Wrap(value, style, box.Width)
+		if err != nil {
+			return err
+		}
+		for _, l := range wrapped {
+			if box.Height > 0 && y+box.LineHeight > bottom {
+				return nil
+			}
+			x := box.X
+			switch box.Align {
+			case "center":
+				x += (box.Width - l.Width) / 2
+			case "right":
+				x += box.Width - l.Width
+			}
+			if err := text.DrawLine(l, x, y); err != nil {
+				return err
+			}
+			y += box.LineHeight
+		}
+	}
+	return nil
+}
+
+// stampFont picks the font used for specimen stamps: "english" when the
+// template defines it, otherwise the first font by name
+func stampFont(tpl *layout.Template) string {
+	if _, ok := tpl.Fonts["english"]; ok {
+		return "english"
+	}
+	names := make([]string, 0, len(tpl.Fonts))
+	for name := range tpl.Fonts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// drawSpecimenStamp marks the current page as a specimen
+func (r *envelopeRenderer) drawSpecimenStamp(tpl *layout.Template) {
+	text := "SPECIMEN - NOT FOR POSTING"
+	if err := r.pdf.SetFont(r.family(tpl, stampFont(tpl)), "", 28); err != nil {
+		log.Println("Failed to set font for specimen stamp:", err)
+		return
+	}
+	width, _ := r.pdf.MeasureTextWidth(text)
+	r.pdf.SetTextColor(200, 0, 0)
+	r.pdf.SetX((tpl.Page.Width - width) / 2)
+	r.pdf.SetY(tpl.Page.Height / 2)
+	if err := r.pdf.Cell(nil, text); err != nil {
+		log.Println("Failed to draw specimen stamp:", err)
+	}
+	r.pdf.SetTextColor(0, 0, 0)
+}
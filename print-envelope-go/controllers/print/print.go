@@ -1,21 +1,21 @@
 package print
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 
 	printclient "printenvelope/controllers/print-client"
+	"printenvelope/layout"
 	"printenvelope/logger"
 	"printenvelope/models/order"
 	"printenvelope/models/print"
 	"printenvelope/types"
+	"printprotocol"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/signintech/gopdf"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -30,6 +30,22 @@ func NewPrintController(db *gorm.DB, async_logger *logger.AsyncLogger) *PrintCon
 	return &PrintController{db: db, loggerInstance: async_logger}
 }
 
+// checkPrinter makes sure print jobs only go to printers that are registered
+// and enabled. Request errors come back as *fiber.Error.
+func checkPrinter(db *gorm.DB, printerID string) error {
+	var printer print.Printer
+	if err := db.Where("printer_id = ? AND is_deleted = ?", printerID, false).First(&printer).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Printer '%s' is not registered", printerID))
+		}
+		return err
+	}
+	if !printer.Enabled {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Printer '%s' is disabled", printerID))
+	}
+	return nil
+}
+
 // PrintBatch creates a print batch job from a batch number
 func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 	// Parse request body
@@ -62,8 +78,23 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate UUID for job
+	// Resolve the page layout up front so the client receives the right paper size
+	tpl, err := layout.ForJobType(req.JobType)
+	if err != nil {
+		logger.Error("Failed to resolve envelope template", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: fmt.Sprintf("No envelope template available for job type '%s'", req.JobType),
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	if err := checkPrinter(pc.db, req.PrinterID); err != nil {
+		return pc.txError(c, "Failed to look up printer", err)
+	}
+
+	// Generate UUID for job and the token the print client presents when downloading the PDF
 	jobUuid := uuid.New().String()
+	jobToken := strings.ReplaceAll(uuid.New().String(), "-", "")
 
 	// Get user UUID from context
 	userUUIDInterface := c.Locals("user_id")
@@ -105,7 +136,7 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 
 	// Find the order batch
 	var orderBatch order.OrderBatch
-	if err := tx.Where("batch_number = ?", req.BatchNumber).First(&orderBatch).Error; err != nil {
+	if err := tx.Where("batch_number = ? AND is_deleted = ?", req.BatchNumber, false).First(&orderBatch).Error; err != nil {
 		tx.Rollback()
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
@@ -120,9 +151,23 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if print batch job already exists for this batch
-	var existingPrintBatch print.PrintBatchJob
-	if err := tx.Where("order_batch_id = ?", orderBatch.ID).First(&existingPrintBatch).Error; err == nil {
+	// A batch may be printed once per document: outbound, inbound and ballot
+	// jobs can run separately, but nothing may print the same page twice
+	var existingPrintBatches []print.PrintBatchJob
+	if err := tx.Where("order_batch_id = ? AND is_deleted = ?", orderBatch.ID, false).
+		Find(&existingPrintBatches).Error; err != nil {
+		tx.Rollback()
+		logger.Error("Failed to fetch existing print batch jobs", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch existing print jobs",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+	for _, existingPrintBatch := range existingPrintBatches {
+		existingTpl, err := layout.ForJobType(existingPrintBatch.JobType)
+		if err != nil || !existingTpl.Overlaps(tpl) {
+			continue
+		}
 		tx.Rollback()
 		return c.Status(fiber.StatusConflict).JSON(types.ErrorResponse{
 			Message: fmt.Sprintf("Print batch job already exists for batch '%s'", req.BatchNumber),
@@ -130,6 +175,7 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 			Data: fiber.Map{
 				"print_batch_job_id": existingPrintBatch.ID,
 				"status":             existingPrintBatch.Status,
+				"job_type":           existingPrintBatch.JobType,
 			},
 		})
 	}
@@ -137,7 +183,7 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 	// Get all orders in the batch with their full details
 	var batchItems []order.OrderBatchItem
 	if err := tx.Preload("Order.Address").Preload("Order.ReturningAddress").
-		Where("order_batch_id = ?", orderBatch.ID).
+		Where("order_batch_id = ? AND is_deleted = ?", orderBatch.ID, false).
 		Find(&batchItems).Error; err != nil {
 		tx.Rollback()
 		logger.Error("Failed to fetch batch items", err)
@@ -147,6 +193,15 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 		})
 	}
 
+	// Orders cancelled upstream after batching are not printed
+	printableItems := make([]order.OrderBatchItem, 0, len(batchItems))
+	for _, item := range batchItems {
+		if !item.Order.IsCancelled {
+			printableItems = append(printableItems, item)
+		}
+	}
+	batchItems = printableItems
+
 	if len(batchItems) == 0 {
 		tx.Rollback()
 		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
@@ -165,6 +220,7 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 		PrinterID:    req.PrinterID,
 		Command:      req.Command,
 		JobType:      req.JobType,
+		JobToken:     jobToken,
 		JobUuid:      jobUuid,
 	}
 
@@ -191,6 +247,7 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 			PrinterID:       req.PrinterID,
 			Command:         req.Command,
 			JobType:         req.JobType,
+			JobToken:        jobToken,
 			JobUuid:         jobUuid,
 		}
 
@@ -206,22 +263,7 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 		printSingleJobs = append(printSingleJobs, printSingleJob)
 
 		// Create PrintJobData with flattened order data
-		printJobData := print.PrintJobData{
-			PrintSingleJobID:       printSingleJob.ID,
-			OrderID:                item.Order.ID,
-			Sequence:               item.Order.Sequence,
-			RecipientForeName:      item.Order.Address.RecipientForeName,
-			RecipientOtherName:     item.Order.Address.RecipientOtherName,
-			PostalAddress:          item.Order.Address.PostalAddress,
-			ZipCode:                item.Order.Address.ZipCode,
-			City:                   item.Order.Address.City,
-			PhoneNo:                item.Order.Address.PhoneNo,
-			QrID:                   item.Order.Address.QrID,
-			CountryCode:            item.Order.Address.CountryCode,
-			DistrictHeadPostOffice: item.Order.ReturningAddress.DistrictHeadPostOffice,
-			ReturningZipCode:       item.Order.ReturningAddress.ZipCode,
-			District:               item.Order.ReturningAddress.District,
-		}
+		printJobData := printJobDataFor(printSingleJob.ID, item.Order)
 
 		if err := tx.Create(&printJobData).Error; err != nil {
 			tx.Rollback()
@@ -276,7 +318,7 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 	logger.Success(fmt.Sprintf("Created print batch job for batch %s with %d orders", req.BatchNumber, len(batchItems)))
 
 	// Send print job to printer client
-	printData := types.PrintJob{
+	printData := printprotocol.Job{
 		JobID:     printBatchJob.JobUuid,
 		PrinterID: printBatchJob.PrinterID,
 		Command:   printBatchJob.Command,
@@ -284,18 +326,21 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 		Barcode:   "",
 		Mashul:    "",
 		Weight:    "",
-		Width:     8.5,
-		Height:    7.75,
+		Width:     tpl.WidthInch(),
+		Height:    tpl.HeightInch(),
+		PageSizes: jobPageSizes(tpl),
 		Unit:      "inch",
 	}
 
-	jobID, err := printclient.SendPrintJobDirect(printData)
+	delivery, err := printclient.SendPrintJobDirect(printData)
+	jobID := ""
 
 	if err != nil {
 		logger.Error("Failed to send print job to printer client", err)
 		// Continue anyway - job is created in DB
 	} else {
-		logger.Success(fmt.Sprintf("Sent print job to printer client with job ID: %s", jobID))
+		jobID = delivery.JobID
+		logger.Success(fmt.Sprintf("Sent print job to printer client with job ID: %s, delivery: %s", delivery.JobID, delivery.Status))
 	}
 
 	// Return success response
@@ -312,238 +357,237 @@ func (pc *PrintController) PrintBatch(c *fiber.Ctx) error {
 			},
 			"total_print_jobs": len(printSingleJobs),
 			"printer_job_id":   jobID,
+			"delivery":         delivery,
 		},
 	})
 }
 
-func (pc *PrintController) PrintEnvelope(c *fiber.Ctx) error {
-	var internalJob types.InternalJob
-	if err := c.BodyParser(&internalJob); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input data"})
+// printJobDataFor flattens an order and its addresses for a single job
+func printJobDataFor(printSingleJobID uint, o order.Order) print.PrintJobData {
+	return print.PrintJobData{
+		PrintSingleJobID:       printSingleJobID,
+		OrderID:                o.ID,
+		Sequence:               o.Sequence,
+		RecipientForeName:      o.Address.RecipientForeName,
+		RecipientOtherName:     o.Address.RecipientOtherName,
+		PostalAddress:          o.Address.PostalAddress,
+		ZipCode:                o.Address.ZipCode,
+		City:                   o.Address.City,
+		PhoneNo:                o.Address.PhoneNo,
+		QrID:                   o.Address.QrID,
+		CountryCode:            o.Address.CountryCode,
+		DistrictHeadPostOffice: o.ReturningAddress.DistrictHeadPostOffice,
+		ReturningZipCode:       o.ReturningAddress.ZipCode,
+		District:               o.ReturningAddress.District,
 	}
+}
 
-	// var (
-	// 	pageWidth  = internalJob.InternalJobData.PrintWidthInch * 72.0  // Convert inches to points (1 inch = 72 points)
-	// 	pageHeight = internalJob.InternalJobData.PrintHeightInch * 72.0 // Convert inches to points (1 inch = 72 points)
-	// )
+// EnvelopePDFGenerator renders the full batch PDF requested by the print client
+func (pc *PrintController) EnvelopePDFGenerator(c *fiber.Ctx) error {
+	return pc.generateEnvelopePDF(c, false)
+}
 
-	pageWidth := 8.5 * 72.0
-	pageHeight := 7.75 * 72.0
+// EnvelopePDFSpecimenGenerator renders a stamped specimen of the first envelope in a job
+func (pc *PrintController) EnvelopePDFSpecimenGenerator(c *fiber.Ctx) error {
+	return pc.generateEnvelopePDF(c, true)
+}
 
-	pdf := gopdf.GoPdf{}
-	pdf.Start(gopdf.Config{PageSize: gopdf.Rect{W: pageWidth, H: pageHeight}})
-	pdf.AddPage()
+// generateEnvelopePDF resolves a PrintBatchJob by job UUID and token and streams
+// one envelope page per order, in sequence order
+func (pc *PrintController) generateEnvelopePDF(c *fiber.Ctx, specimen bool) error {
+	var req types.EnvelopePDFRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse envelope PDF request", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
 
-	// Load font
-	if err := pdf.AddTTFFont("english", "fonts/roboto_mono.ttf"); err != nil {
-		log.Println("Failed to load english font:", err)
+	if req.JobID == "" || req.JobToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Job ID and job token are required",
+			Status:  fiber.StatusBadRequest,
+		})
 	}
-	if err := pdf.SetFont("english", "", 26); err != nil {
-		log.Println("Failed to set font:", err)
+
+	// Find the print batch job
+	var printBatchJob print.PrintBatchJob
+	if err := pc.db.Where("job_uuid = ? AND job_token = ? AND is_deleted = ?", req.JobID, req.JobToken, false).
+		First(&printBatchJob).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
+				Message: "Print job not found",
+				Status:  fiber.StatusNotFound,
+			})
+		}
+		logger.Error("Failed to fetch print batch job", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch print job",
+			Status:  fiber.StatusInternalServerError,
+		})
 	}
 
-	// Load background image
-	imgHolder, err := gopdf.ImageHolderByPath("assets/Outbound-v-4.png")
-	if err != nil {
-		log.Println("Failed to load background image:", err)
-	}
-
-	// Draw background image
-	imgX := 0.0
-	imgY := 0.0
-	imgW := 612.0
-	imgH := 558.0
-	if err == nil {
-		pdf.ImageByHolder(imgHolder, imgX, imgY, &gopdf.Rect{W: imgW, H: imgH})
-	}
-
-	// Heading
-	// heading := "BANGLADESH POST OFFICE"
-	// // if err := pdf.SetFont("english-bold", "", 24); err != nil {
-	// // 	log.Println("Failed to set bold font:", err)
-	// // }
-	// headingWidth, _ := pdf.MeasureTextWidth(heading)
-	// headingX := (pageWidth - headingWidth) / 2
-	// pdf.SetX(headingX)
-	// pdf.SetY(30)
-	// if err := pdf.CellWithOption(&gopdf.Rect{W: headingWidth, H: 30}, heading, gopdf.CellOption{Align: gopdf.Left}); err != nil {
-	// 	log.Println("Failed to draw text:", err)
-	// }
-
-	// Barcode logic
-	// var textY float64
-	// if internalJob.InternalJobData.Barcode != "" {
-	// 	bar, err := code128.Encode(internalJob.InternalJobData.Barcode)
-	// 	if err != nil {
-	// 		log.Println("Barcode encoding failed:", err)
-	// 		return c.Status(500).JSON(fiber.Map{"error": "Failed to encode barcode"})
-	// 	}
-	// 	scaledBar, err := barcode.Scale(bar, 500, 50)
-	// 	if err != nil {
-	// 		log.Println("Barcode scaling failed:", err)
-	// 		return c.Status(500).JSON(fiber.Map{"error": "Failed to scale barcode"})
-	// 	}
-
-	// 	rgba := image.NewRGBA(scaledBar.Bounds())
-	// 	for y := scaledBar.Bounds().Min.Y; y < scaledBar.Bounds().Max.Y; y++ {
-	// 		for x := scaledBar.Bounds().Min.X; x < scaledBar.Bounds().Max.X; x++ {
-	// 			rgba.Set(x, y, scaledBar.At(x, y))
-	// 		}
-	// 	}
-
-	// 	var imgBuf bytes.Buffer
-	// 	if err := png.Encode(&imgBuf, rgba); err != nil {
-	// 		log.Println("Failed to encode PNG:", err)
-	// 		return c.Status(500).JSON(fiber.Map{"error": "Failed to encode barcode image"})
-	// 	}
-
-	// 	holder, err := gopdf.ImageHolderByBytes(imgBuf.Bytes())
-	// 	if err != nil {
-	// 		log.Println("Failed to create image holder:", err)
-	// 		return c.Status(500).JSON(fiber.Map{"error": "Invalid barcode image"})
-	// 	}
-
-	// 	imgW := 550.0
-	// 	imgH := 70.0
-	// 	imgX := (pageWidth - imgW) / 2
-	// 	imgY := 90.0
-
-	// 	if err := pdf.ImageByHolder(holder, imgX, imgY, &gopdf.Rect{W: imgW, H: imgH}); err != nil {
-	// 		log.Println("Image draw failed:", err)
-	// 	}
-
-	// 	if err := pdf.SetFont("english", "", 36); err != nil {
-	// 		log.Println("Failed to set font for barcode text:", err)
-	// 	}
-
-	// 	text := internalJob.InternalJobData.Barcode
-	// 	textWidth, _ := pdf.MeasureTextWidth(text)
-	// 	textX := (pageWidth - textWidth) / 2
-	// 	textY = imgY + imgH
-
-	// 	pdf.SetX(textX)
-	// 	pdf.SetY(textY)
-	// 	pdf.Cell(nil, text)
-	// }
-
-	// Layout vars
-	// y := textY + 50
-	// x := 35.0
-	// lineHeight := 30.0
-	// fontSize := 24.0
-	// maxTextWidth := pageWidth - x*2
-
-	// // pdf.SetFont("english", "", fontSize)
-
-	// // Draw content
-	// // Set font size for recipient
-	// if err := pdf.SetFont("english", "", fontSize); err != nil {
-	// 	log.Println("Failed to set font:", err)
-	// }
-	// recipient := fmt.Sprintf("Recipient: %s (%s), %s, %s",
-	// 	internalJob.InternalJobData.RecipientName,
-	// 	internalJob.InternalJobData.RecipientPhone,
-	// 	internalJob.InternalJobData.RecipientAddress,
-	// 	internalJob.InternalJobData.RecipientDistrict,
-	// )
-	// y = drawPrintInternalWrappedText(&pdf, recipient, x, y, maxTextWidth, lineHeight, "english", fontSize)
-	// y += 20 // Add extra space after recipient
-
-	// // Set font size for sender
-	// if err := pdf.SetFont("english", "", fontSize); err != nil {
-	// 	log.Println("Failed to set font:", err)
-	// }
-	// sender := fmt.Sprintf("Sender: %s (%s), %s, %s",
-	// 	internalJob.InternalJobData.SenderName,
-	// 	internalJob.InternalJobData.SenderPhone,
-	// 	internalJob.InternalJobData.SenderAddress,
-	// 	internalJob.InternalJobData.SenderDistrict,
-	// )
-	// y = drawPrintInternalWrappedText(&pdf, sender, x, y, maxTextWidth, lineHeight, "english", fontSize)
-	// y += 10 // Add extra space after sender
-
-	// weight, _ := strconv.ParseFloat(internalJob.InternalJobData.Weight, 64)
-	// mashul, _ := strconv.ParseFloat(internalJob.InternalJobData.Mashul, 64)
-
-	// formatedAdditionalItems := FormatAdditionalItems(
-	// 	internalJob.InternalJobData.AdditionalServiceText,
-	// 	weight,
-	// 	mashul,
-	// )
-
-	// for _, line := range formatedAdditionalItems {
-	// 	y = drawPrintInternalWrappedText(&pdf, line, x, y, maxTextWidth, lineHeight, "english", 18.0)
-	// }
-
-	// registryText := strings.ToUpper(internalJob.InternalJobData.AdditionalServiceText)
-	// _ = drawPrintInternalWrappedText(&pdf, registryText, x, y, maxTextWidth, lineHeight, "english", fontSize)
-
-	// Output PDF
-	var pdfBuf bytes.Buffer
-	if err := pdf.Write(&pdfBuf); err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Failed to generate PDF")
+	if printBatchJob.Status == print.PrintJobCancelled {
+		return c.Status(fiber.StatusConflict).JSON(types.ErrorResponse{
+			Message: "Print job has been cancelled",
+			Status:  fiber.StatusConflict,
+		})
 	}
 
-	// tempFile := "simple_output.pdf"
-	// err = os.WriteFile(tempFile, pdfBuf.Bytes(), 0644)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to save PDF file: %w", err)
-	// }
+	// Load the flattened order data in sequence order
+	var printJobDataList []print.PrintJobData
+	query := pc.db.Model(&print.PrintJobData{}).
+		Select("print_job_data.*").
+		Joins("JOIN print_single_jobs ON print_single_jobs.id = print_job_data.print_single_job_id").
+		Where("print_single_jobs.print_batch_job_id = ?", printBatchJob.ID).
+		Where("print_single_jobs.is_deleted = ? AND print_job_data.is_deleted = ?", false, false).
+		Order("print_single_jobs.sequence ASC")
+	if specimen {
+		query = query.Limit(1)
+	}
+	if err := query.Find(&printJobDataList).Error; err != nil {
+		logger.Error("Failed to fetch print job data", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch print job data",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	if len(printJobDataList) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(types.ErrorResponse{
+			Message: "No orders found for this print job",
+			Status:  fiber.StatusNotFound,
+		})
+	}
+
+	tpl, err := layout.ForJobType(printBatchJob.JobType)
+	if err != nil {
+		logger.Error("Failed to resolve envelope template", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to resolve envelope template",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
 
-	// absPath, _ := filepath.Abs(tempFile)
+	pdfBytes, err := renderEnvelopePDF(tpl, printJobDataList, specimen)
+	if err != nil {
+		logger.Error("Failed to render envelope PDF", err)
+		var drawErr *orderDrawError
+		if errors.As(err, &drawErr) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(types.ErrorResponse{
+				Message: fmt.Sprintf("Failed to generate PDF: order %d cannot be drawn on the %s page: %s", drawErr.Sequence, drawErr.Page, drawErr.Err.Error()),
+				Status:  fiber.StatusUnprocessableEntity,
+				Data: fiber.Map{
+					"sequence": drawErr.Sequence,
+					"page":     drawErr.Page,
+				},
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to generate PDF",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
 
-	// // 3. Print using PowerShell
-	// cmd := exec.Command("powershell", "-Command", fmt.Sprintf(`
-	// 	$shell = New-Object -ComObject Shell.Application
-	// 	$shell.ShellExecute("%s", "", "", "printto", "%s")
-	// `, absPath, "TSC TX300"))
+	// The client has the document now; the batch is being processed. The
+	// pages per order are kept so printed pages can be mapped back to orders.
+	if !specimen {
+		updates := map[string]interface{}{"pages_per_order": len(tpl.Pages())}
+		if printBatchJob.Status == print.PrintJobPending {
+			updates["status"] = print.PrintJobProcessing
+		}
+		if err := pc.db.Model(&printBatchJob).Updates(updates).Error; err != nil {
+			logger.Error("Failed to update print batch job status", err)
+		}
+	}
 
-	// err = cmd.Run()
-	// if err != nil {
-	// 	return fmt.Errorf("failed to print file: %w", err)
-	// }
+	logger.Success(fmt.Sprintf("Generated envelope PDF for job %s with %d pages", printBatchJob.JobUuid, len(printJobDataList)))
 
 	c.Set("Content-Type", "application/pdf")
-	c.Set("Content-Disposition", "inline; filename=label.pdf")
-	return c.Send(pdfBuf.Bytes())
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=%s.pdf", printBatchJob.JobUuid))
+	return c.Send(pdfBytes)
 }
 
-func drawPrintInternalWrappedText(pdf *gopdf.GoPdf, text string, x, y, maxWidth, lineHeight float64, font string, size float64) float64 {
-
-	if err := pdf.SetFont(font, "", size); err != nil {
-		log.Println("Failed to set font in wrapped text:", err)
+// JobTypes lists the printable job types and the pages each one produces
+func (pc *PrintController) JobTypes(c *fiber.Ctx) error {
+	registry, err := layout.Templates()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Envelope templates are not available",
+			Status:  fiber.StatusInternalServerError,
+		})
 	}
-	words := bytes.Fields([]byte(text)) // ensures clean whitespace
-	line := ""
 
-	for _, word := range words {
-		testLine := line
-		if testLine != "" {
-			testLine += " "
-		}
-		testLine += string(word)
-
-		width, _ := pdf.MeasureTextWidth(testLine)
-		if width > maxWidth {
-			// Draw current line
-			pdf.SetX(x)
-			pdf.SetY(y)
-			pdf.Cell(nil, line)
-			y += lineHeight
-			line = string(word)
-		} else {
-			line = testLine
+	var jobTypes []fiber.Map
+	for _, tpl := range registry.All() {
+		var pages []string
+		for _, page := range tpl.Pages() {
+			pages = append(pages, page.Name)
 		}
+		jobTypes = append(jobTypes, fiber.Map{
+			"template":    tpl.Name,
+			"job_types":   tpl.JobTypes,
+			"default":     tpl.Default,
+			"pages":       pages,
+			"width_inch":  tpl.WidthInch(),
+			"height_inch": tpl.HeightInch(),
+		})
 	}
 
-	if line != "" {
-		pdf.SetX(x)
-		pdf.SetY(y)
-		pdf.Cell(nil, line)
-		y += lineHeight
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Job types fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"job_types": jobTypes,
+		},
+	})
+}
+
+// PrintEnvelope renders a single envelope from ad-hoc job data using the
+// template registered for the request's job type. Useful for previewing a
+// template without creating a batch.
+func (pc *PrintController) PrintEnvelope(c *fiber.Ctx) error {
+	var internalJob types.InternalJob
+	if err := c.BodyParser(&internalJob); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input data"})
 	}
 
-	return y
+	tpl, err := layout.ForJobType(internalJob.JobType)
+	if err != nil {
+		logger.Error("Failed to resolve envelope template", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to resolve envelope template")
+	}
+
+	jobData := internalJob.InternalJobData
+	row := print.PrintJobData{
+		RecipientForeName:      jobData.RecipientName,
+		PostalAddress:          jobData.RecipientAddress,
+		ZipCode:                jobData.RecipientPostcode,
+		City:                   jobData.RecipientDistrict,
+		PhoneNo:                jobData.RecipientPhone,
+		QrID:                   jobData.Barcode,
+		DistrictHeadPostOffice: jobData.SenderPostoffice,
+		ReturningZipCode:       jobData.SenderPostcode,
+		District:               jobData.SenderDistrict,
+	}
+	if sequence, err := strconv.Atoi(jobData.OrderId); err == nil {
+		row.Sequence = sequence
+	}
+
+	pdfBytes, err := renderEnvelopePDF(tpl, []print.PrintJobData{row}, false)
+	if err != nil {
+		logger.Error("Failed to render envelope PDF", err)
+		var drawErr *orderDrawError
+		if errors.As(err, &drawErr) {
+			return c.Status(fiber.StatusUnprocessableEntity).SendString(fmt.Sprintf("Failed to generate PDF: %s", drawErr.Error()))
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to generate PDF")
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", "inline; filename=label.pdf")
+	return c.Send(pdfBytes)
 }
 
 func FormatAdditionalItems(text string, jobWeight float64, jobMashul float64) []string {
@@ -0,0 +1,634 @@
+package print
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	printclient "printenvelope/controllers/print-client"
+	"printenvelope/layout"
+	"printenvelope/logger"
+	"printenvelope/models/order"
+	"printenvelope/models/print"
+	"printenvelope/models/user"
+	"printenvelope/types"
+	"printprotocol"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultReprintLimit is the number of approved reprints allowed per order
+// when REPRINT_LIMIT is not set
+const defaultReprintLimit = 2
+
+// reprintLimit returns the maximum number of approved reprints per order
+func reprintLimit() int {
+	if limit, err := strconv.Atoi(os.Getenv("REPRINT_LIMIT")); err == nil && limit >= 0 {
+		return limit
+	}
+	return defaultReprintLimit
+}
+
+var reprintReasons = map[string]print.ReprintReason{
+	"spoiled":  print.ReprintSpoiled,
+	"misprint": print.ReprintMisprint,
+	"lost":     print.ReprintLost,
+}
+
+// CreateReprintRequest raises a reprint of printed sequences. The request
+// waits for approval by an admin other than the requester.
+func (pc *PrintController) CreateReprintRequest(c *fiber.Ctx) error {
+	requester, errResp := pc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+
+	var req types.ReprintRequestCreate
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse reprint request", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	reason, ok := reprintReasons[strings.ToLower(strings.TrimSpace(req.Reason))]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Reason is required and must be one of spoiled, misprint or lost",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	if len(req.Sequences) == 0 || req.JobType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Sequences and job type are required",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	if _, err := layout.ForJobType(req.JobType); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: fmt.Sprintf("No envelope template available for job type '%s'", req.JobType),
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var reprint print.ReprintRequest
+	err := pc.db.Transaction(func(tx *gorm.DB) error {
+		if req.PrinterID != "" {
+			if err := checkPrinter(tx, req.PrinterID); err != nil {
+				return err
+			}
+		}
+
+		orders, err := reprintableOrders(tx, req.Sequences, req.JobType, 0)
+		if err != nil {
+			return err
+		}
+
+		reprint = print.ReprintRequest{
+			Reason:        reason,
+			Note:          req.Note,
+			Status:        print.ReprintPending,
+			JobType:       req.JobType,
+			PrinterID:     req.PrinterID,
+			RequestedByID: requester.ID,
+		}
+		for _, o := range orders {
+			reprint.Items = append(reprint.Items, print.ReprintRequestItem{OrderID: o.ID, Sequence: o.Sequence})
+		}
+		return tx.Create(&reprint).Error
+	})
+	if err != nil {
+		return pc.txError(c, "Failed to create reprint request", err)
+	}
+
+	logger.Success(fmt.Sprintf("Reprint request %d raised by %s for %d orders", reprint.ID, requester.Username, len(reprint.Items)))
+
+	return c.Status(fiber.StatusCreated).JSON(types.ApiResponse{
+		Message: "Reprint request created, waiting for approval",
+		Status:  fiber.StatusCreated,
+		Data: fiber.Map{
+			"reprint_request": reprint,
+		},
+	})
+}
+
+// ApproveReprintRequest approves a pending reprint request, creates its print
+// job and sends it to the printer. The approver must not be the requester.
+func (pc *PrintController) ApproveReprintRequest(c *fiber.Ctx) error {
+	approver, errResp := pc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid reprint request ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	var req types.ReprintReviewRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+				Message: "Invalid request payload",
+				Status:  fiber.StatusBadRequest,
+			})
+		}
+	}
+
+	var reprint print.ReprintRequest
+	var printBatchJob print.PrintBatchJob
+	var tpl *layout.Template
+	err = pc.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingReprint(tx, uint(id), approver.ID, &reprint); err != nil {
+			return err
+		}
+
+		printerID := reprint.PrinterID
+		if req.PrinterID != "" {
+			printerID = req.PrinterID
+		}
+		if printerID == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Printer ID is required")
+		}
+		if err := checkPrinter(tx, printerID); err != nil {
+			return err
+		}
+
+		var err error
+		if tpl, err = layout.ForJobType(reprint.JobType); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("No envelope template available for job type '%s'", reprint.JobType))
+		}
+
+		// Check again: orders may have been cancelled or reprinted meanwhile
+		sequences := make([]int, 0, len(reprint.Items))
+		for _, item := range reprint.Items {
+			sequences = append(sequences, item.Sequence)
+		}
+		orders, err := reprintableOrders(tx, sequences, reprint.JobType, reprint.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		printBatchJob = print.PrintBatchJob{
+			BatchNumber:      fmt.Sprintf("REPRINT-%d", reprint.ID),
+			Status:           print.PrintJobPending,
+			TotalJobs:        len(orders),
+			CreatedByID:      approver.ID,
+			PrinterID:        printerID,
+			Command:          "live-print",
+			JobType:          reprint.JobType,
+			JobToken:         strings.ReplaceAll(uuid.New().String(), "-", ""),
+			JobUuid:          uuid.New().String(),
+			ReprintRequestID: &reprint.ID,
+			StartedAt:        &now,
+		}
+		if err := tx.Create(&printBatchJob).Error; err != nil {
+			return err
+		}
+
+		metadata, err := json.Marshal(map[string]interface{}{
+			"print_batch_job_id": printBatchJob.ID,
+			"reprint_request_id": reprint.ID,
+			"reason":             reprint.Reason,
+			"requested_by_id":    reprint.RequestedByID,
+			"approved_by_id":     approver.ID,
+		})
+		if err != nil {
+			return err
+		}
+		metadataStr := string(metadata)
+
+		if err := queueOrders(tx, &printBatchJob, orders, order.OrderPrintStarted, func(o order.Order) string {
+			return fmt.Sprintf("Order %d queued for reprint (%s) by request %d", o.Sequence, strings.ToLower(string(reprint.Reason)), reprint.ID)
+		}, &metadataStr); err != nil {
+			return err
+		}
+
+		orderIDs := make([]uint, 0, len(orders))
+		for _, o := range orders {
+			orderIDs = append(orderIDs, o.ID)
+		}
+		if err := tx.Model(&order.Order{}).Where("id IN ?", orderIDs).
+			Update("reprint_count", gorm.Expr("reprint_count + 1")).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&reprint).Updates(map[string]interface{}{
+			"status":             print.ReprintApproved,
+			"reviewed_by_id":     approver.ID,
+			"reviewed_at":        now,
+			"review_note":        req.Note,
+			"printer_id":         printerID,
+			"print_batch_job_id": printBatchJob.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     approver.ID,
+			AdminUUID:   approver.Uuid,
+			Action:      "APPROVE_REPRINT_REQUEST",
+			EntityType:  "REPRINT_REQUEST",
+			EntityID:    reprint.ID,
+			Description: fmt.Sprintf("Approved %s reprint of %d orders as print job %d", reprint.Reason, len(orders), printBatchJob.ID),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err != nil {
+		return pc.txError(c, "Failed to approve reprint request", err)
+	}
+
+	logger.Success(fmt.Sprintf("Reprint request %d approved by %s as print job %d", reprint.ID, approver.Username, printBatchJob.ID))
+
+	printData := printprotocol.Job{
+		JobID:     printBatchJob.JobUuid,
+		PrinterID: printBatchJob.PrinterID,
+		Command:   printBatchJob.Command,
+		JobToken:  printBatchJob.JobToken,
+		Width:     tpl.WidthInch(),
+		Height:    tpl.HeightInch(),
+		PageSizes: jobPageSizes(tpl),
+		Unit:      "inch",
+	}
+	delivery, err := printclient.SendPrintJobDirect(printData)
+	jobID := ""
+	if err != nil {
+		logger.Error("Failed to send reprint job to printer client", err)
+		// Continue anyway - job is created in DB
+	} else {
+		jobID = delivery.JobID
+		logger.Success(fmt.Sprintf("Sent reprint job to printer client with job ID: %s, delivery: %s", delivery.JobID, delivery.Status))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(types.ApiResponse{
+		Message: "Reprint request approved successfully",
+		Status:  fiber.StatusCreated,
+		Data: fiber.Map{
+			"reprint_request_id": reprint.ID,
+			"print_batch_job": fiber.Map{
+				"id":           printBatchJob.ID,
+				"batch_number": printBatchJob.BatchNumber,
+				"status":       printBatchJob.Status,
+				"total_jobs":   printBatchJob.TotalJobs,
+				"started_at":   printBatchJob.StartedAt,
+			},
+			"printer_job_id": jobID,
+			"delivery":       delivery,
+		},
+	})
+}
+
+// RejectReprintRequest rejects a pending reprint request with a note
+func (pc *PrintController) RejectReprintRequest(c *fiber.Ctx) error {
+	reviewer, errResp := pc.currentUser(c)
+	if errResp != nil {
+		return c.Status(errResp.Status).JSON(errResp)
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid reprint request ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	var req types.ReprintReviewRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Note) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "A note explaining the rejection is required",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var reprint print.ReprintRequest
+	err = pc.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingReprint(tx, uint(id), reviewer.ID, &reprint); err != nil {
+			return err
+		}
+		if err := tx.Model(&reprint).Updates(map[string]interface{}{
+			"status":         print.ReprintRejected,
+			"reviewed_by_id": reviewer.ID,
+			"reviewed_at":    time.Now(),
+			"review_note":    req.Note,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&user.AdminUpdateLog{
+			AdminID:     reviewer.ID,
+			AdminUUID:   reviewer.Uuid,
+			Action:      "REJECT_REPRINT_REQUEST",
+			EntityType:  "REPRINT_REQUEST",
+			EntityID:    reprint.ID,
+			Description: fmt.Sprintf("Rejected %s reprint of %d orders: %s", reprint.Reason, len(reprint.Items), req.Note),
+			IPAddress:   c.IP(),
+			UserAgent:   c.Get(fiber.HeaderUserAgent),
+		}).Error
+	})
+	if err != nil {
+		return pc.txError(c, "Failed to reject reprint request", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Reprint request rejected",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"reprint_request": reprint,
+		},
+	})
+}
+
+// ReprintRequestList lists reprint requests, newest first
+func (pc *PrintController) ReprintRequestList(c *fiber.Ctx) error {
+	page, pageSize := paging(c)
+
+	query := pc.db.Model(&print.ReprintRequest{}).Where("is_deleted = ?", false)
+	filters := make(map[string]interface{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", strings.ToUpper(status))
+		filters["status"] = status
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", strings.ToUpper(reason))
+		filters["reason"] = reason
+	}
+	if sequence := c.Query("sequence"); sequence != "" {
+		if seq, err := strconv.Atoi(sequence); err == nil {
+			query = query.Where("id IN (?)", pc.db.Model(&print.ReprintRequestItem{}).Select("reprint_request_id").Where("sequence = ?", seq))
+			filters["sequence"] = seq
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Error("Failed to count reprint requests", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to count reprint requests",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	var requests []print.ReprintRequest
+	if err := query.Preload("Items").
+		Order("created_at DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&requests).Error; err != nil {
+		logger.Error("Failed to fetch reprint requests", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch reprint requests",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Reprint requests fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"reprint_requests": requests,
+			"pagination":       pagination(page, pageSize, total),
+			"filters":          filters,
+		},
+	})
+}
+
+// ReprintCountList reports orders that have been reprinted, most reprinted
+// first, with the per-order limit
+func (pc *PrintController) ReprintCountList(c *fiber.Ctx) error {
+	page, pageSize := paging(c)
+	limit := reprintLimit()
+
+	query := pc.db.Model(&order.Order{}).Where("reprint_count > 0 AND is_deleted = ?", false)
+	if c.QueryBool("at_limit") {
+		query = query.Where("reprint_count >= ?", limit)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Error("Failed to count reprinted orders", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to count reprinted orders",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	var orders []struct {
+		OrderID      uint `json:"order_id"`
+		Sequence     int  `json:"sequence"`
+		ReprintCount int  `json:"reprint_count"`
+	}
+	if err := query.Select("id AS order_id, sequence, reprint_count").
+		Order("reprint_count DESC, sequence ASC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&orders).Error; err != nil {
+		logger.Error("Failed to fetch reprinted orders", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+			Message: "Failed to fetch reprinted orders",
+			Status:  fiber.StatusInternalServerError,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(types.ApiResponse{
+		Message: "Reprint counts fetched successfully",
+		Status:  fiber.StatusOK,
+		Data: fiber.Map{
+			"orders":        orders,
+			"reprint_limit": limit,
+			"pagination":    pagination(page, pageSize, total),
+		},
+	})
+}
+
+// reprintableOrders loads the orders for sequences and checks every one can
+// be reprinted: it exists, is not cancelled, has been printed with jobType,
+// is under the reprint limit and is not part of another pending request.
+// pendingID is the request being approved, which is skipped in that check.
+func reprintableOrders(tx *gorm.DB, sequences []int, jobType string, pendingID uint) ([]order.Order, error) {
+	unique := make(map[int]bool, len(sequences))
+	var wanted []int
+	for _, seq := range sequences {
+		if !unique[seq] {
+			unique[seq] = true
+			wanted = append(wanted, seq)
+		}
+	}
+	sort.Ints(wanted)
+
+	var orders []order.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Address").Preload("ReturningAddress").
+		Where("sequence IN ? AND is_deleted = ?", wanted, false).
+		Order("sequence ASC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[int]bool, len(orders))
+	for _, o := range orders {
+		found[o.Sequence] = true
+	}
+	var missing []int
+	for _, seq := range wanted {
+		if !found[seq] {
+			missing = append(missing, seq)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Orders not found for sequences %v", missing))
+	}
+
+	orderIDs := make([]uint, 0, len(orders))
+	for _, o := range orders {
+		orderIDs = append(orderIDs, o.ID)
+	}
+
+	var printed []uint
+	if err := tx.Model(&print.PrintSingleJob{}).Distinct("order_id").
+		Where("order_id IN ? AND job_type = ? AND status = ? AND is_deleted = ?", orderIDs, jobType, print.PrintJobCompleted, false).
+		Pluck("order_id", &printed).Error; err != nil {
+		return nil, err
+	}
+	isPrinted := make(map[uint]bool, len(printed))
+	for _, id := range printed {
+		isPrinted[id] = true
+	}
+
+	var pending []uint
+	if err := tx.Model(&print.ReprintRequestItem{}).
+		Joins("JOIN reprint_requests ON reprint_requests.id = reprint_request_items.reprint_request_id").
+		Where("reprint_request_items.order_id IN ? AND reprint_requests.status = ? AND reprint_requests.is_deleted = ? AND reprint_requests.id <> ?",
+			orderIDs, print.ReprintPending, false, pendingID).
+		Pluck("reprint_request_items.order_id", &pending).Error; err != nil {
+		return nil, err
+	}
+	isPending := make(map[uint]bool, len(pending))
+	for _, id := range pending {
+		isPending[id] = true
+	}
+
+	limit := reprintLimit()
+	var cancelled, notPrinted, atLimit, inRequest []int
+	for _, o := range orders {
+		switch {
+		case o.IsCancelled:
+			cancelled = append(cancelled, o.Sequence)
+		case !isPrinted[o.ID]:
+			notPrinted = append(notPrinted, o.Sequence)
+		case o.ReprintCount >= limit:
+			atLimit = append(atLimit, o.Sequence)
+		case isPending[o.ID]:
+			inRequest = append(inRequest, o.Sequence)
+		}
+	}
+
+	var problems []string
+	if len(cancelled) > 0 {
+		problems = append(problems, fmt.Sprintf("cancelled: %v", cancelled))
+	}
+	if len(notPrinted) > 0 {
+		problems = append(problems, fmt.Sprintf("not printed as %s: %v", jobType, notPrinted))
+	}
+	if len(atLimit) > 0 {
+		problems = append(problems, fmt.Sprintf("reprint limit of %d reached: %v", limit, atLimit))
+	}
+	if len(inRequest) > 0 {
+		problems = append(problems, fmt.Sprintf("already in a pending reprint request: %v", inRequest))
+	}
+	if len(problems) > 0 {
+		return nil, fiber.NewError(fiber.StatusConflict, "Orders cannot be reprinted - "+strings.Join(problems, "; "))
+	}
+	return orders, nil
+}
+
+// lockPendingReprint loads a pending reprint request for review by reviewerID
+func lockPendingReprint(tx *gorm.DB, id, reviewerID uint, reprint *print.ReprintRequest) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND is_deleted = ?", id, false).First(reprint).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fiber.NewError(fiber.StatusNotFound, "Reprint request not found")
+		}
+		return err
+	}
+	if reprint.Status != print.ReprintPending {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Reprint request is already %s", strings.ToLower(string(reprint.Status))))
+	}
+	if reprint.RequestedByID == reviewerID {
+		return fiber.NewError(fiber.StatusForbidden, "A reprint request must be reviewed by someone other than the requester")
+	}
+	return tx.Where("reprint_request_id = ?", reprint.ID).Order("sequence ASC").Find(&reprint.Items).Error
+}
+
+// txError answers with the status of a *fiber.Error raised inside a
+// transaction, or logs err and answers 500 with message
+func (pc *PrintController) txError(c *fiber.Ctx, message string, err error) error {
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		return c.Status(fiberErr.Code).JSON(types.ErrorResponse{
+			Message: fiberErr.Message,
+			Status:  fiberErr.Code,
+		})
+	}
+	logger.Error(message, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(types.ErrorResponse{
+		Message: message,
+		Status:  fiber.StatusInternalServerError,
+	})
+}
+
+// currentUser looks up the authenticated user
+func (pc *PrintController) currentUser(c *fiber.Ctx) (*user.User, *types.ErrorResponse) {
+	userUUID, ok := c.Locals("user_id").(string)
+	if !ok || userUUID == "" {
+		return nil, &types.ErrorResponse{
+			Message: "User not authenticated",
+			Status:  fiber.StatusUnauthorized,
+		}
+	}
+
+	var u user.User
+	if err := pc.db.Where("uuid = ?", userUUID).First(&u).Error; err != nil {
+		logger.Error("Failed to find user by UUID", err)
+		return nil, &types.ErrorResponse{
+			Message: "Invalid user",
+			Status:  fiber.StatusUnauthorized,
+		}
+	}
+	return &u, nil
+}
+
+// paging reads the page and page_size query parameters
+func paging(c *fiber.Ctx) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "10"))
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	if pageSize > 100 {
+		pageSize = 100 // Max limit
+	}
+	return page, pageSize
+}
+
+// pagination describes a page of results
+func pagination(page, pageSize int, total int64) fiber.Map {
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	return fiber.Map{
+		"current_page":  page,
+		"page_size":     pageSize,
+		"total_records": total,
+		"total_pages":   totalPages,
+		"has_next_page": page < totalPages,
+		"has_prev_page": page > 1,
+	}
+}
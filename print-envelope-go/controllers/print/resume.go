@@ -0,0 +1,304 @@
+package print
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	printclient "printenvelope/controllers/print-client"
+	"printenvelope/layout"
+	"printenvelope/logger"
+	"printenvelope/models/order"
+	"printenvelope/models/print"
+	"printenvelope/types"
+	"printprotocol"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultStaleJobTimeout is how long a processing job may go without news
+// from its print client before it is considered stalled, when
+// PRINT_JOB_STALE_TIMEOUT is not set
+const defaultStaleJobTimeout = 30 * time.Minute
+
+// staleJobTimeout returns how long a processing job may go without news
+// from its print client before it can be resumed
+func staleJobTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(os.Getenv("PRINT_JOB_STALE_TIMEOUT")); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultStaleJobTimeout
+}
+
+// lastJobActivity returns when the job last changed or its print client
+// last reported on it
+func lastJobActivity(tx *gorm.DB, batchJob *print.PrintBatchJob) (time.Time, error) {
+	last := batchJob.UpdatedAt
+	var latest []time.Time
+	if err := tx.Model(&print.PrintClientEvent{}).Where("print_batch_job_id = ?", batchJob.ID).
+		Order("created_at DESC").Limit(1).Pluck("created_at", &latest).Error; err != nil {
+		return last, err
+	}
+	if len(latest) > 0 && latest[0].After(last) {
+		last = latest[0]
+	}
+	return last, nil
+}
+
+// ResumePrintBatch continues a failed print batch job as a new job holding
+// only the orders that were not printed. The new job keeps the batch, job
+// type and command of the failed one, links back to it and is sent to the
+// chosen printer. A processing job whose print client has been silent for
+// longer than staleJobTimeout is failed first and resumed the same way.
+func (pc *PrintController) ResumePrintBatch(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid print batch job ID",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	var req struct {
+		PrinterID string `json:"printer_id" validate:"required"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse resume print batch request", err)
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Invalid request payload",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+	if req.PrinterID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(types.ErrorResponse{
+			Message: "Printer ID is required",
+			Status:  fiber.StatusBadRequest,
+		})
+	}
+
+	userUUID, ok := c.Locals("user_id").(string)
+	if !ok || userUUID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(types.ErrorResponse{
+			Message: "User not authenticated",
+			Status:  fiber.StatusUnauthorized,
+		})
+	}
+	var user struct {
+		ID uint
+	}
+	if err := pc.db.Table("users").Select("id").Where("uuid = ?", userUUID).First(&user).Error; err != nil {
+		logger.Error("Failed to find user by UUID", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(types.ErrorResponse{
+			Message: "Invalid user",
+			Status:  fiber.StatusUnauthorized,
+		})
+	}
+
+	var resumed print.PrintBatchJob
+	var failedJob print.PrintBatchJob
+	var tpl *layout.Template
+
+	// Request errors are returned from the transaction as *fiber.Error
+	err = pc.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the failed job so two operators cannot resume it at once
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_deleted = ?", id, false).First(&failedJob).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fiber.NewError(fiber.StatusNotFound, "Print batch job not found")
+			}
+			return err
+		}
+		switch failedJob.Status {
+		case print.PrintJobFailed:
+		case print.PrintJobProcessing:
+			last, err := lastJobActivity(tx, &failedJob)
+			if err != nil {
+				return err
+			}
+			timeout := staleJobTimeout()
+			if time.Since(last) < timeout {
+				return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Print job is still processing; it can be resumed once the printer has been silent for %s (last activity %s)",
+					timeout, last.Format(time.RFC3339)))
+			}
+			reason := fmt.Sprintf("Printer %s stopped reporting on the job after %s", failedJob.PrinterID, last.Format(time.RFC3339))
+			if err := printclient.FailStalledJob(tx, &failedJob, reason); err != nil {
+				return err
+			}
+			failedJob.Status = print.PrintJobFailed
+		default:
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Only failed or stalled print jobs can be resumed, job is %s", failedJob.Status))
+		}
+
+		var existing print.PrintBatchJob
+		err := tx.Where("resumed_from_id = ? AND is_deleted = ?", failedJob.ID, false).First(&existing).Error
+		if err == nil {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Print batch job has already been resumed as job %d", existing.ID))
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		if err := checkPrinter(tx, req.PrinterID); err != nil {
+			return err
+		}
+
+		var tplErr error
+		tpl, tplErr = layout.ForJobType(failedJob.JobType)
+		if tplErr != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("No envelope template available for job type '%s'", failedJob.JobType))
+		}
+
+		// Orders not yet printed, in print order; orders cancelled since the
+		// failure are left out
+		var remaining []print.PrintSingleJob
+		if err := tx.Where("print_batch_job_id = ? AND status <> ? AND is_deleted = ?", failedJob.ID, print.PrintJobCompleted, false).
+			Order("sequence ASC").Find(&remaining).Error; err != nil {
+			return err
+		}
+		orderIDs := make([]uint, 0, len(remaining))
+		for _, singleJob := range remaining {
+			orderIDs = append(orderIDs, singleJob.OrderID)
+		}
+		var orders []order.Order
+		if len(orderIDs) > 0 {
+			if err := tx.Preload("Address").Preload("ReturningAddress").
+				Where("id IN ? AND is_cancelled = ?", orderIDs, false).
+				Order("sequence ASC").Find(&orders).Error; err != nil {
+				return err
+			}
+		}
+		if len(orders) == 0 {
+			return fiber.NewError(fiber.StatusConflict, "Every order in this print job has already been printed")
+		}
+
+		rootJobID := failedJob.ID
+		if failedJob.RootJobID != nil {
+			rootJobID = *failedJob.RootJobID
+		}
+		now := time.Now()
+		jobUuid := uuid.New().String()
+		jobToken := strings.ReplaceAll(uuid.New().String(), "-", "")
+		resumed = print.PrintBatchJob{
+			BatchNumber:      failedJob.BatchNumber,
+			OrderBatchID:     failedJob.OrderBatchID,
+			Status:           print.PrintJobPending,
+			TotalJobs:        len(orders),
+			CreatedByID:      user.ID,
+			PrinterID:        req.PrinterID,
+			Command:          failedJob.Command,
+			JobType:          failedJob.JobType,
+			JobToken:         jobToken,
+			JobUuid:          jobUuid,
+			ReprintRequestID: failedJob.ReprintRequestID,
+			ResumedFromID:    &failedJob.ID,
+			RootJobID:        &rootJobID,
+			StartedAt:        &now,
+		}
+		if err := tx.Create(&resumed).Error; err != nil {
+			return err
+		}
+
+		metadata, err := json.Marshal(map[string]interface{}{
+			"print_batch_job_id": resumed.ID,
+			"resumed_from_id":    failedJob.ID,
+			"root_job_id":        rootJobID,
+			"job_uuid":           jobUuid,
+			"printer_id":         req.PrinterID,
+			"resumed_by_id":      user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		metadataStr := string(metadata)
+
+		return queueOrders(tx, &resumed, orders, order.OrderPrintResumed, func(o order.Order) string {
+			return fmt.Sprintf("Order %d queued for printing again in batch %s, resuming failed job %d", o.Sequence, resumed.BatchNumber, failedJob.ID)
+		}, &metadataStr)
+	})
+	if err != nil {
+		return pc.txError(c, "Failed to resume print batch job", err)
+	}
+
+	logger.Success(fmt.Sprintf("Resumed print batch job %d as job %d with %d orders", failedJob.ID, resumed.ID, resumed.TotalJobs))
+
+	printData := printprotocol.Job{
+		JobID:     resumed.JobUuid,
+		PrinterID: resumed.PrinterID,
+		Command:   resumed.Command,
+		JobToken:  resumed.JobToken,
+		Width:     tpl.WidthInch(),
+		Height:    tpl.HeightInch(),
+		PageSizes: jobPageSizes(tpl),
+		Unit:      "inch",
+	}
+	delivery, err := printclient.SendPrintJobDirect(printData)
+	jobID := ""
+	if err != nil {
+		logger.Error("Failed to send resumed print job to printer client", err)
+		// Continue anyway - job is created in DB
+	} else {
+		jobID = delivery.JobID
+		logger.Success(fmt.Sprintf("Sent resumed print job to printer client with job ID: %s, delivery: %s", delivery.JobID, delivery.Status))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(types.ApiResponse{
+		Message: "Print batch job resumed successfully",
+		Status:  fiber.StatusCreated,
+		Data: fiber.Map{
+			"print_batch_job": fiber.Map{
+				"id":              resumed.ID,
+				"batch_number":    resumed.BatchNumber,
+				"status":          resumed.Status,
+				"total_jobs":      resumed.TotalJobs,
+				"started_at":      resumed.StartedAt,
+				"resumed_from_id": resumed.ResumedFromID,
+				"root_job_id":     resumed.RootJobID,
+			},
+			"total_print_jobs": resumed.TotalJobs,
+			"printer_job_id":   jobID,
+			"delivery":         delivery,
+		},
+	})
+}
+
+// queueOrders creates a pending single job with flattened print data for
+// every order of batchJob and records an event of status for each order
+func queueOrders(tx *gorm.DB, batchJob *print.PrintBatchJob, orders []order.Order, status order.OrderEventStatus, message func(o order.Order) string, metadata *string) error {
+	for _, o := range orders {
+		printSingleJob := print.PrintSingleJob{
+			PrintBatchJobID: batchJob.ID,
+			OrderID:         o.ID,
+			Sequence:        o.Sequence,
+			Status:          print.PrintJobPending,
+			PrinterID:       batchJob.PrinterID,
+			Command:         batchJob.Command,
+			JobType:         batchJob.JobType,
+			JobToken:        batchJob.JobToken,
+			JobUuid:         batchJob.JobUuid,
+		}
+		if err := tx.Create(&printSingleJob).Error; err != nil {
+			return err
+		}
+
+		printJobData := printJobDataFor(printSingleJob.ID, o)
+		if err := tx.Create(&printJobData).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&order.OrderEvent{
+			OrderID:  o.ID,
+			Status:   status,
+			Message:  message(o),
+			Metadata: metadata,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -119,12 +119,21 @@ func autoMigrate() error {
 		&order.ReturningAddress{},
 		&order.OrderBatch{},
 		&order.OrderBatchItem{},
+		&order.BatchNumberSequence{},
 
 		&print.PrintBatchJob{},
 		&print.PrintSingleJob{},
 		&print.PrintJobData{},
+		&print.PrintClientEvent{},
+		&print.ReprintRequest{},
+		&print.ReprintRequestItem{},
+		&print.Printer{},
+		&print.PrintClientEnrollment{},
+		&print.PrintClientMessage{},
+		&print.PrintClientPresence{},
 
 		&log.KafkaMessageLog{},
+		&log.KafkaConsumerOffset{},
 		&log.Log{},
 	}
 
@@ -305,6 +314,10 @@ func createIndexes() error {
 	if err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_order_batch_items_updated_at ON order_batch_items(updated_at)").Error; err != nil {
 		return fmt.Errorf("failed to create order_batch_item updated_at index: %w", err)
 	}
+	// An order may sit in only one live batch
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_order_batch_items_live_order ON order_batch_items(order_id) WHERE deleted_at IS NULL").Error; err != nil {
+		return fmt.Errorf("failed to create order_batch_item live order index: %w", err)
+	}
 
 	// KafkaMessageLog indexes
 	if err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_kafka_message_logs_key ON kafka_message_logs(key)").Error; err != nil {
@@ -317,6 +330,39 @@ func createIndexes() error {
 		return fmt.Errorf("failed to create kafka_message_log updated_at index: %w", err)
 	}
 
+	// KafkaConsumerOffset indexes
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_kafka_consumer_offsets_partition ON kafka_consumer_offsets(consumer_group, topic, partition)").Error; err != nil {
+		return fmt.Errorf("failed to create kafka_consumer_offset partition index: %w", err)
+	}
+
+	// BatchNumberSequence indexes
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_batch_number_sequences_prefix ON batch_number_sequences(prefix)").Error; err != nil {
+		return fmt.Errorf("failed to create batch_number_sequence prefix index: %w", err)
+	}
+
+	// Printer indexes
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_printers_printer_id ON printers(printer_id)").Error; err != nil {
+		return fmt.Errorf("failed to create printer_id index: %w", err)
+	}
+
+	// PrintClientEnrollment indexes
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_print_client_enrollments_fingerprint ON print_client_enrollments(fingerprint)").Error; err != nil {
+		return fmt.Errorf("failed to create print_client_enrollment fingerprint index: %w", err)
+	}
+
+	// PrintClientMessage indexes, in delivery order per printer
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_print_client_messages_message_id ON print_client_messages(message_id) WHERE message_id <> ''").Error; err != nil {
+		return fmt.Errorf("failed to create print_client_message message_id index: %w", err)
+	}
+	if err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_print_client_messages_delivery ON print_client_messages(printer_id, status, id)").Error; err != nil {
+		return fmt.Errorf("failed to create print_client_message delivery index: %w", err)
+	}
+
+	// PrintClientPresence indexes, one session per printer
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_print_client_presences_printer_id ON print_client_presences(printer_id)").Error; err != nil {
+		return fmt.Errorf("failed to create print_client_presence printer_id index: %w", err)
+	}
+
 	return nil
 }
 
@@ -87,10 +87,19 @@ func getRegisteredModels() []ModelInfo {
 		&order.OrderEvent{},
 		&order.OrderBatch{},
 		&order.OrderBatchItem{},
+		&order.BatchNumberSequence{},
 		&print.PrintBatchJob{},
 		&print.PrintSingleJob{},
 		&print.PrintJobData{},
+		&print.PrintClientEvent{},
+		&print.ReprintRequest{},
+		&print.ReprintRequestItem{},
+		&print.Printer{},
+		&print.PrintClientEnrollment{},
+		&print.PrintClientMessage{},
+		&print.PrintClientPresence{},
 		&log.KafkaMessageLog{},
+		&log.KafkaConsumerOffset{},
 
 		// Log models
 		&log.Log{},
@@ -154,31 +163,39 @@ func extractModelInfo(model interface{}) ModelInfo {
 func extractForeignKeyRelationships(modelType reflect.Type, fields *[]FieldInfo, _ string) {
 	// Map to store table name mappings for different models
 	tableNameMap := map[string]string{
-		"User":                 "users",
-		"Division":             "divisions",
-		"District":             "districts",
-		"PoliceStation":        "police_stations",
-		"PostOffice":           "post_offices",
-		"PostOfficeBranch":     "post_office_branches", // Use correct custom table name
-		"Address":              "addresses",
-		"ReturningAddress":     "returning_addresses",
-		"Order":                "orders",
-		"OrderEvent":           "order_events",
-		"OrderBatch":           "order_batches",
-		"OrderBatchItem":       "order_batch_items",
-		"PrintBatchJob":        "print_batch_jobs",
-		"PrintSingleJob":       "print_single_jobs",
-		"PrintJobData":         "print_job_data",
-		"Organization":         "organizations",
-		"OrganizationInfo":     "organization_infos",
-		"Account":              "accounts",
-		"AccountOwner":         "account_owners",
-		"AccountUser":          "account_users",
-		"AccountLedger":        "account_ledgers",
-		"LedgerUpdateDocument": "ledger_update_documents",
-		"ResponseTime":         "response_times",
-		"ResponseTimeEvent":    "response_time_events",
-		"Log":                  "logs",
+		"User":                  "users",
+		"Division":              "divisions",
+		"District":              "districts",
+		"PoliceStation":         "police_stations",
+		"PostOffice":            "post_offices",
+		"PostOfficeBranch":      "post_office_branches", // Use correct custom table name
+		"Address":               "addresses",
+		"ReturningAddress":      "returning_addresses",
+		"Order":                 "orders",
+		"OrderEvent":            "order_events",
+		"OrderBatch":            "order_batches",
+		"OrderBatchItem":        "order_batch_items",
+		"BatchNumberSequence":   "batch_number_sequences",
+		"PrintBatchJob":         "print_batch_jobs",
+		"PrintSingleJob":        "print_single_jobs",
+		"PrintJobData":          "print_job_data",
+		"PrintClientEvent":      "print_client_events",
+		"ReprintRequest":        "reprint_requests",
+		"ReprintRequestItem":    "reprint_request_items",
+		"Printer":               "printers",
+		"PrintClientEnrollment": "print_client_enrollments",
+		"PrintClientMessage":    "print_client_messages",
+		"PrintClientPresence":   "print_client_presences",
+		"Organization":          "organizations",
+		"OrganizationInfo":      "organization_infos",
+		"Account":               "accounts",
+		"AccountOwner":          "account_owners",
+		"AccountUser":           "account_users",
+		"AccountLedger":         "account_ledgers",
+		"LedgerUpdateDocument":  "ledger_update_documents",
+		"ResponseTime":          "response_times",
+		"ResponseTimeEvent":     "response_time_events",
+		"Log":                   "logs",
 	}
 
 	for i := 0; i < modelType.NumField(); i++ {
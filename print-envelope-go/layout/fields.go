@@ -0,0 +1,123 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+
+	"printenvelope/models/print"
+)
+
+// fieldNames lists the values a template may reference. Names follow the
+// json tags of PrintJobData, plus a few derived conveniences.
+var fieldNames = map[string]bool{
+	"sequence":                  true,
+	"order_id":                  true,
+	"recipient_fore_name":       true,
+	"recipient_other_name":      true,
+	"recipient_name":            true,
+	"postal_address":            true,
+	"zip_code":                  true,
+	"city":                      true,
+	"phone_no":                  true,
+	"qr_id":                     true,
+	"country_code":              true,
+	"district_head_post_office": true,
+	"returning_zip_code":        true,
+	"district":                  true,
+}
+
+// fieldFilters are the transforms a placeholder may apply to its value, as
+// in {country_code|upper}
+var fieldFilters = map[string]func(string) string{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// splitPlaceholder splits a placeholder into its field name and filter
+func splitPlaceholder(placeholder string) (field, filter string) {
+	field, filter, _ = strings.Cut(placeholder, "|")
+	return strings.TrimSpace(field), strings.TrimSpace(filter)
+}
+
+// IsField reports whether name can be bound in a template
+func IsField(name string) bool {
+	return fieldNames[name]
+}
+
+// Fields flattens a PrintJobData row into the values templates bind to
+func Fields(row print.PrintJobData) map[string]string {
+	return map[string]string{
+		"sequence":                  strconv.Itoa(row.Sequence),
+		"order_id":                  strconv.FormatUint(uint64(row.OrderID), 10),
+		"recipient_fore_name":       row.RecipientForeName,
+		"recipient_other_name":      row.RecipientOtherName,
+		"recipient_name":            strings.TrimSpace(row.RecipientForeName + " " + row.RecipientOtherName),
+		"postal_address":            row.PostalAddress,
+		"zip_code":                  row.ZipCode,
+		"city":                      row.City,
+		"phone_no":                  row.PhoneNo,
+		"qr_id":                     row.QrID,
+		"country_code":              row.CountryCode,
+		"district_head_post_office": row.DistrictHeadPostOffice,
+		"returning_zip_code":        row.ReturningZipCode,
+		"district":                  row.District,
+	}
+}
+
+// Expand substitutes {field} and {field|filter} placeholders in line. ok is
+// false when the line references at least one field and every referenced
+// field is empty, which tells the renderer to skip the line entirely.
+func Expand(line string, fields map[string]string) (string, bool) {
+	var out strings.Builder
+	referenced, filled := 0, 0
+
+	for {
+		start := strings.IndexByte(line, '{')
+		if start < 0 {
+			out.WriteString(line)
+			break
+		}
+		end := strings.IndexByte(line[start:], '}')
+		if end < 0 {
+			out.WriteString(line)
+			break
+		}
+		end += start
+
+		out.WriteString(line[:start])
+		field, filter := splitPlaceholder(line[start+1 : end])
+		value := strings.TrimSpace(fields[field])
+		if transform := fieldFilters[filter]; transform != nil {
+			value = transform(value)
+		}
+		referenced++
+		if value != "" {
+			filled++
+		}
+		out.WriteString(value)
+		line = line[end+1:]
+	}
+
+	if referenced > 0 && filled == 0 {
+		return "", false
+	}
+	return strings.TrimSpace(out.String()), true
+}
+
+// placeholders returns the placeholders in line, filters included
+func placeholders(line string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(line, '{')
+		if start < 0 {
+			return names
+		}
+		end := strings.IndexByte(line[start:], '}')
+		if end < 0 {
+			return names
+		}
+		end += start
+		names = append(names, line[start+1:end])
+		line = line[end+1:]
+	}
+}
@@ -0,0 +1,490 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"printenvelope/logger"
+)
+
+// Supported units for template coordinates
+const (
+	UnitPoint = "pt"
+	UnitInch  = "inch"
+	UnitMM    = "mm"
+)
+
+// Template describes one printable page layout (envelope or ballot sheet).
+// All coordinates are expressed in Unit and converted to points on load.
+//
+// A template listing Components is a kit instead: it has no layout of its
+// own and prints one page of each component per voter, in order, so a
+// voter's outbound envelope, return envelope and ballot come out collated.
+type Template struct {
+	Name       string            `json:"name"`
+	JobTypes   []string          `json:"job_types"`
+	Default    bool              `json:"default"`
+	Components []string          `json:"components"`
+	Unit       string            `json:"unit"`
+	Page       Size              `json:"page"`
+	Background string            `json:"background"`
+	Fonts      map[string]string `json:"fonts"`
+	Text       []TextBox         `json:"text"`
+	QRCodes    []QRBox           `json:"qr_codes"`
+	Barcodes   []BarcodeBox      `json:"barcodes"`
+
+	// source is the file the template was loaded from
+	source string
+	// pages holds the resolved component templates, or the template itself
+	pages []*Template
+}
+
+// Size is a width/height pair
+type Size struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// TextBox is a named block of text. Each entry in Lines may reference
+// PrintJobData fields as {field_name}, optionally with a filter such as
+// {field_name|upper}; a line whose placeholders all resolve to empty values
+// is skipped.
+type TextBox struct {
+	Name        string   `json:"name"`
+	X           float64  `json:"x"`
+	Y           float64  `json:"y"`
+	Width       float64  `json:"width"`
+	Height      float64  `json:"height"`
+	Font        string   `json:"font"`
+	ComplexFont string   `json:"complex_font"` // shapes Bangla runs; optional
+	FontSize    float64  `json:"font_size"`
+	LineHeight  float64  `json:"line_height"`
+	Align       string   `json:"align"` // left, center or right
+	Lines       []string `json:"lines"`
+}
+
+// Minimum quiet zones, in modules, required by the symbology specs
+const (
+	QRMinQuietZone      = 4
+	Code128MinQuietZone = 10
+)
+
+// QRBox places a QR code encoding a PrintJobData field. The box is a square
+// of Size that includes the quiet zone; MinModule is the smallest module
+// edge the scanners can read, checked against the encoded data at render time.
+type QRBox struct {
+	Name            string  `json:"name"`
+	Field           string  `json:"field"`
+	X               float64 `json:"x"`
+	Y               float64 `json:"y"`
+	Size            float64 `json:"size"`
+	QuietZone       int     `json:"quiet_zone"`       // modules, default 4
+	ErrorCorrection string  `json:"error_correction"` // L, M, Q or H, default M
+	MinModule       float64 `json:"min_module"`
+}
+
+// BarcodeBox places a linear barcode encoding a PrintJobData field. The box
+// includes the quiet zone on both sides and, when ShowText is set, the
+// human-readable caption under the bars.
+type BarcodeBox struct {
+	Name      string  `json:"name"`
+	Field     string  `json:"field"`
+	Symbology string  `json:"symbology"` // currently only "code128"
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+	QuietZone int     `json:"quiet_zone"` // modules, default 10
+	MinModule float64 `json:"min_module"`
+	ShowText  bool    `json:"show_text"`
+	Font      string  `json:"font"`
+	FontSize  float64 `json:"font_size"`
+}
+
+// IsKit reports whether the template collates other templates
+func (t *Template) IsKit() bool {
+	return len(t.Components) > 0
+}
+
+// Pages returns the layouts printed for each voter, in order
+func (t *Template) Pages() []*Template {
+	return t.pages
+}
+
+// Overlaps reports whether printing both templates would print any page
+// layout twice for the same voter
+func (t *Template) Overlaps(other *Template) bool {
+	for _, a := range t.pages {
+		for _, b := range other.pages {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WidthInch returns the page width in inches, as expected by print clients.
+// For kits this is the widest component page.
+func (t *Template) WidthInch() float64 {
+	return t.Page.Width / 72.0
+}
+
+// HeightInch returns the page height in inches, as expected by print clients.
+// For kits this is the tallest component page.
+func (t *Template) HeightInch() float64 {
+	return t.Page.Height / 72.0
+}
+
+// Registry holds the loaded templates indexed by name and job type
+type Registry struct {
+	byName    map[string]*Template
+	byJobType map[string]*Template
+	fallback  *Template
+}
+
+// Load reads every *.json template in dir and builds a registry
+func Load(dir string) (*Registry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates in %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates found in %s", dir)
+	}
+	sort.Strings(files)
+
+	registry := &Registry{
+		byName:    make(map[string]*Template),
+		byJobType: make(map[string]*Template),
+	}
+
+	for _, file := range files {
+		tpl, err := LoadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, exists := registry.byName[tpl.Name]; exists {
+			return nil, fmt.Errorf("duplicate template name %q in %s", tpl.Name, file)
+		}
+		registry.byName[tpl.Name] = tpl
+
+		for _, jobType := range tpl.JobTypes {
+			if other, exists := registry.byJobType[jobType]; exists {
+				return nil, fmt.Errorf("job type %q is claimed by both %q and %q", jobType, other.Name, tpl.Name)
+			}
+			registry.byJobType[jobType] = tpl
+		}
+
+		if tpl.Default {
+			if registry.fallback != nil {
+				return nil, fmt.Errorf("templates %q and %q are both marked default", registry.fallback.Name, tpl.Name)
+			}
+			registry.fallback = tpl
+		}
+	}
+
+	for _, name := range registry.Names() {
+		if err := registry.resolve(registry.byName[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// LoadFile reads, validates and normalizes a single template file
+func LoadFile(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", path, err)
+	}
+
+	var tpl Template
+	if err := json.Unmarshal(data, &tpl); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	tpl.source = path
+
+	if err := tpl.validate(); err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", path, err)
+	}
+	tpl.normalize()
+
+	return &tpl, nil
+}
+
+// resolve links a template to the page layouts it prints. Kit pages must be
+// plain templates; the kit's page size is the largest of its components.
+func (r *Registry) resolve(tpl *Template) error {
+	if !tpl.IsKit() {
+		tpl.pages = []*Template{tpl}
+		return nil
+	}
+
+	tpl.pages = nil
+	tpl.Page = Size{}
+	for _, name := range tpl.Components {
+		part, ok := r.byName[name]
+		if !ok {
+			return fmt.Errorf("kit %q references unknown template %q", tpl.Name, name)
+		}
+		if part.IsKit() {
+			return fmt.Errorf("kit %q cannot include another kit %q", tpl.Name, name)
+		}
+		tpl.pages = append(tpl.pages, part)
+		if part.Page.Width > tpl.Page.Width {
+			tpl.Page.Width = part.Page.Width
+		}
+		if part.Page.Height > tpl.Page.Height {
+			tpl.Page.Height = part.Page.Height
+		}
+	}
+	return nil
+}
+
+// ForJobType returns the template bound to jobType. Only an empty job type
+// gets the default template; any other unregistered job type is an error so
+// the caller can refuse the job.
+func (r *Registry) ForJobType(jobType string) (*Template, error) {
+	if jobType == "" && r.fallback != nil {
+		return r.fallback, nil
+	}
+	if tpl, ok := r.byJobType[jobType]; ok {
+		return tpl, nil
+	}
+	return nil, fmt.Errorf("no template for job type %q", jobType)
+}
+
+// ByName returns the template with the given name
+func (r *Registry) ByName(name string) (*Template, bool) {
+	tpl, ok := r.byName[name]
+	return tpl, ok
+}
+
+// All returns every loaded template sorted by name
+func (r *Registry) All() []*Template {
+	templates := make([]*Template, 0, len(r.byName))
+	for _, name := range r.Names() {
+		templates = append(templates, r.byName[name])
+	}
+	return templates
+}
+
+// Names returns the sorted names of all loaded templates
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	defaultRegistry    *Registry
+	defaultRegistryErr error
+	defaultRegistryMu  sync.Once
+)
+
+// Templates returns the process-wide registry loaded from ENVELOPE_TEMPLATE_DIR
+// (default "templates"). The directory is read once on first use.
+func Templates() (*Registry, error) {
+	defaultRegistryMu.Do(func() {
+		dir := os.Getenv("ENVELOPE_TEMPLATE_DIR")
+		if dir == "" {
+			dir = "templates"
+		}
+		defaultRegistry, defaultRegistryErr = Load(dir)
+		if defaultRegistryErr != nil {
+			logger.Error("Failed to load envelope templates", defaultRegistryErr)
+			return
+		}
+		logger.Success(fmt.Sprintf("Loaded envelope templates: %s", strings.Join(defaultRegistry.Names(), ", ")))
+	})
+	return defaultRegistry, defaultRegistryErr
+}
+
+// ForJobType resolves a template from the process-wide registry
+func ForJobType(jobType string) (*Template, error) {
+	registry, err := Templates()
+	if err != nil {
+		return nil, err
+	}
+	return registry.ForJobType(jobType)
+}
+
+// validate checks the template for missing or inconsistent values
+func (t *Template) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch t.Unit {
+	case "":
+		t.Unit = UnitPoint
+	case UnitPoint, UnitInch, UnitMM:
+	default:
+		return fmt.Errorf("unsupported unit %q", t.Unit)
+	}
+	if t.IsKit() {
+		if len(t.Text) > 0 || len(t.QRCodes) > 0 || len(t.Barcodes) > 0 || t.Background != "" {
+			return fmt.Errorf("kit templates only list components")
+		}
+		return nil
+	}
+	if t.Page.Width <= 0 || t.Page.Height <= 0 {
+		return fmt.Errorf("page width and height must be positive")
+	}
+	if len(t.Fonts) == 0 {
+		return fmt.Errorf("at least one font is required")
+	}
+
+	for _, box := range t.Text {
+		if box.Name == "" {
+			return fmt.Errorf("text box without a name")
+		}
+		if _, ok := t.Fonts[box.Font]; !ok {
+			return fmt.Errorf("text box %q uses unknown font %q", box.Name, box.Font)
+		}
+		if _, ok := t.Fonts[box.ComplexFont]; box.ComplexFont != "" && !ok {
+			return fmt.Errorf("text box %q uses unknown complex font %q", box.Name, box.ComplexFont)
+		}
+		if box.FontSize <= 0 {
+			return fmt.Errorf("text box %q needs a positive font_size", box.Name)
+		}
+		if box.Width <= 0 {
+			return fmt.Errorf("text box %q needs a positive width", box.Name)
+		}
+		switch box.Align {
+		case "", "left", "center", "right":
+		default:
+			return fmt.Errorf("text box %q has unsupported align %q", box.Name, box.Align)
+		}
+		for _, line := range box.Lines {
+			for _, placeholder := range placeholders(line) {
+				field, filter := splitPlaceholder(placeholder)
+				if !IsField(field) {
+					return fmt.Errorf("text box %q references unknown field %q", box.Name, field)
+				}
+				if filter != "" && fieldFilters[filter] == nil {
+					return fmt.Errorf("text box %q uses unknown filter %q on field %q", box.Name, filter, field)
+				}
+			}
+		}
+	}
+
+	for _, box := range t.QRCodes {
+		if !IsField(box.Field) {
+			return fmt.Errorf("qr code %q references unknown field %q", box.Name, box.Field)
+		}
+		if box.Size <= 0 {
+			return fmt.Errorf("qr code %q needs a positive size", box.Name)
+		}
+		if box.QuietZone != 0 && box.QuietZone < QRMinQuietZone {
+			return fmt.Errorf("qr code %q quiet zone must be at least %d modules", box.Name, QRMinQuietZone)
+		}
+		switch box.ErrorCorrection {
+		case "", "L", "M", "Q", "H":
+		default:
+			return fmt.Errorf("qr code %q has unsupported error correction %q", box.Name, box.ErrorCorrection)
+		}
+		if box.MinModule < 0 {
+			return fmt.Errorf("qr code %q has a negative min_module", box.Name)
+		}
+	}
+
+	for _, box := range t.Barcodes {
+		if !IsField(box.Field) {
+			return fmt.Errorf("barcode %q references unknown field %q", box.Name, box.Field)
+		}
+		if box.Symbology != "" && box.Symbology != "code128" {
+			return fmt.Errorf("barcode %q has unsupported symbology %q", box.Name, box.Symbology)
+		}
+		if box.Width <= 0 || box.Height <= 0 {
+			return fmt.Errorf("barcode %q needs a positive width and height", box.Name)
+		}
+		if box.QuietZone != 0 && box.QuietZone < Code128MinQuietZone {
+			return fmt.Errorf("barcode %q quiet zone must be at least %d modules", box.Name, Code128MinQuietZone)
+		}
+		if box.MinModule < 0 {
+			return fmt.Errorf("barcode %q has a negative min_module", box.Name)
+		}
+		if box.ShowText {
+			if _, ok := t.Fonts[box.Font]; !ok {
+				return fmt.Errorf("barcode %q uses unknown font %q", box.Name, box.Font)
+			}
+			if box.FontSize <= 0 {
+				return fmt.Errorf("barcode %q needs a positive font_size for its caption", box.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalize converts every coordinate to points and fills in defaults
+func (t *Template) normalize() {
+	scale := 1.0
+	switch t.Unit {
+	case UnitInch:
+		scale = 72.0
+	case UnitMM:
+		scale = 72.0 / 25.4
+	}
+
+	t.Page.Width *= scale
+	t.Page.Height *= scale
+
+	for i := range t.Text {
+		box := &t.Text[i]
+		box.X *= scale
+		box.Y *= scale
+		box.Width *= scale
+		box.Height *= scale
+		if box.LineHeight <= 0 {
+			box.LineHeight = box.FontSize * 1.2
+		} else {
+			box.LineHeight *= scale
+		}
+		if box.Align == "" {
+			box.Align = "left"
+		}
+	}
+
+	for i := range t.QRCodes {
+		box := &t.QRCodes[i]
+		box.X *= scale
+		box.Y *= scale
+		box.Size *= scale
+		box.MinModule *= scale
+		if box.QuietZone == 0 {
+			box.QuietZone = QRMinQuietZone
+		}
+		if box.ErrorCorrection == "" {
+			box.ErrorCorrection = "M"
+		}
+	}
+
+	for i := range t.Barcodes {
+		box := &t.Barcodes[i]
+		box.X *= scale
+		box.Y *= scale
+		box.Width *= scale
+		box.Height *= scale
+		box.MinModule *= scale
+		if box.QuietZone == 0 {
+			box.QuietZone = Code128MinQuietZone
+		}
+		if box.Symbology == "" {
+			box.Symbology = "code128"
+		}
+	}
+
+	t.Unit = UnitPoint
+}
@@ -3,16 +3,21 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	printclient "printenvelope/controllers/print-client"
 	"printenvelope/database"
 	"printenvelope/logger"
 	"printenvelope/middleware"
 	"printenvelope/routes"
 	"printenvelope/services"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -53,35 +58,39 @@ func main() {
 	routes.SetupRoutes(app, db)
 
 	// Initialize Print Client Service (WebSocket for cloud print clients)
-	printClientService := printclient.InitPrintClientService()
+	printClientService := printclient.InitPrintClientService(db)
 	printClientService.Start()
 	logger.Success("Print Client Service started successfully")
 
-	// Initialize Kafka consumer service
-	kafkaHost := os.Getenv("KAFKA_HOST")
-	if kafkaHost == "" {
-		kafkaHost = "localhost:9092" // default fallback
+	// Initialize order sources. ORDER_SOURCES lists the enabled ones
+	// (kafka, directory); the HTTP bulk import is always available.
+	orderSources := os.Getenv("ORDER_SOURCES")
+	if orderSources == "" {
+		orderSources = services.SourceKafka // default fallback
 	}
-	kafkaBrokers := []string{kafkaHost}
 
-	kafkaTopic := os.Getenv("KAFKA_TOPIC")
-	if kafkaTopic == "" {
-		kafkaTopic = "ballot_orders" // default fallback
-	}
-
-	kafkaUser := os.Getenv("KAFKA_USER")
-	kafkaPass := os.Getenv("KAFKA_PASS")
-	kafkaGroup := os.Getenv("KAFKA_GROUP")
-	if kafkaGroup == "" {
-		kafkaGroup = "default-consumer-group" // default fallback
+	var sources []services.OrderSource
+	for _, name := range strings.Split(orderSources, ",") {
+		switch strings.TrimSpace(name) {
+		case services.SourceKafka:
+			sources = append(sources, newKafkaSource(db))
+		case services.SourceDirectory:
+			sources = append(sources, newDirectorySource(db))
+		case "":
+		default:
+			logger.Warning("Unknown order source " + name)
+		}
 	}
 
-	consumerService := services.NewConsumerService(db, kafkaBrokers, kafkaTopic, kafkaUser, kafkaPass, kafkaGroup)
-	if err := consumerService.Start(); err != nil {
-		logger.Error("Failed to start consumer service", err)
-		fmt.Printf("Failed to start consumer service: %s\n", err.Error())
-	} else {
-		logger.Success("Kafka consumer service started successfully")
+	var started []services.OrderSource
+	for _, source := range sources {
+		if err := source.Start(); err != nil {
+			logger.Error("Failed to start "+source.Name()+" order source", err)
+			fmt.Printf("Failed to start %s order source: %s\n", source.Name(), err.Error())
+			continue
+		}
+		logger.Success(source.Name() + " order source started successfully")
+		started = append(started, source)
 	}
 
 	// Start Fiber server in a goroutine
@@ -99,12 +108,17 @@ func main() {
 		}
 	}()
 
-	// Wait for consumer service to complete (blocks until shutdown signal)
-	consumerService.Wait()
+	// Block until the process is asked to terminate
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	fmt.Println("Termination signal received, shutting down...")
 
 	// Graceful shutdown
-	if err := consumerService.Shutdown(); err != nil {
-		logger.Error("Error during consumer shutdown", err)
+	for _, source := range started {
+		if err := source.Shutdown(); err != nil {
+			logger.Error("Error during "+source.Name()+" order source shutdown", err)
+		}
 	}
 	if printClientService != nil {
 		printClientService.Stop()
@@ -116,3 +130,45 @@ func main() {
 
 	// Additional application code can follow...
 }
+
+// newKafkaSource builds the Kafka consumer from the KAFKA_* environment
+func newKafkaSource(db *gorm.DB) services.OrderSource {
+	kafkaHost := os.Getenv("KAFKA_HOST")
+	if kafkaHost == "" {
+		kafkaHost = "localhost:9092" // default fallback
+	}
+	kafkaBrokers := []string{kafkaHost}
+
+	kafkaTopic := os.Getenv("KAFKA_TOPIC")
+	if kafkaTopic == "" {
+		kafkaTopic = "ballot_orders" // default fallback
+	}
+
+	kafkaUser := os.Getenv("KAFKA_USER")
+	kafkaPass := os.Getenv("KAFKA_PASS")
+	kafkaGroup := os.Getenv("KAFKA_GROUP")
+	if kafkaGroup == "" {
+		kafkaGroup = "default-consumer-group" // default fallback
+	}
+
+	// Optional topic that receives messages rejected during ingestion
+	kafkaDLQTopic := os.Getenv("KAFKA_DLQ_TOPIC")
+
+	return services.NewConsumerService(db, kafkaBrokers, kafkaTopic, kafkaUser, kafkaPass, kafkaGroup, kafkaDLQTopic)
+}
+
+// newDirectorySource builds the drop directory source from the ORDER_DROP_*
+// environment
+func newDirectorySource(db *gorm.DB) services.OrderSource {
+	dropDir := os.Getenv("ORDER_DROP_DIR")
+	if dropDir == "" {
+		dropDir = "order-drop" // default fallback
+	}
+
+	interval := 10 * time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("ORDER_DROP_INTERVAL")); err == nil && seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	return services.NewDirectorySource(db, dropDir, interval)
+}
@@ -28,9 +28,52 @@ const (
 	ProcessingStatusCancelled ProcessingStatus = "cancelled"
 )
 
-// KafkaMessageLog represents a raw Kafka message log entry
+// KafkaMessageLog statuses
+const (
+	KafkaStatusReceived              = "received"
+	KafkaStatusProcessed             = "processed"
+	KafkaStatusParseFailed           = "parse_failed"
+	KafkaStatusInvalidStructure      = "invalid_structure"
+	KafkaStatusInvalidSequenceFormat = "invalid_sequence_format"
+	KafkaStatusDuplicateSequence     = "duplicate_sequence"
+	KafkaStatusProcessingFailed      = "processing_failed"
+	KafkaStatusUnsupportedVersion    = "unsupported_version"
+	KafkaStatusUnsupportedOp         = "unsupported_op"
+	KafkaStatusOrderNotFound         = "order_not_found"
+	KafkaStatusOrderCancelled        = "order_cancelled"
+	KafkaStatusOrderLocked           = "order_locked"
+)
+
+// KafkaRejectedStatuses are the statuses of messages refused because of
+// their content, as opposed to failures on our side
+var KafkaRejectedStatuses = []string{
+	KafkaStatusParseFailed,
+	KafkaStatusInvalidStructure,
+	KafkaStatusInvalidSequenceFormat,
+	KafkaStatusDuplicateSequence,
+	KafkaStatusUnsupportedVersion,
+	KafkaStatusUnsupportedOp,
+	KafkaStatusOrderNotFound,
+	KafkaStatusOrderCancelled,
+	KafkaStatusOrderLocked,
+}
+
+// IsRejectedKafkaStatus reports whether status is one of KafkaRejectedStatuses
+func IsRejectedKafkaStatus(status string) bool {
+	for _, s := range KafkaRejectedStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// KafkaMessageLog represents a raw Kafka message log entry. Messages loaded
+// from other order sources are logged here too so they can be reviewed and
+// reprocessed the same way.
 type KafkaMessageLog struct {
 	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Source    string    `gorm:"type:varchar(50);not null;default:'kafka';index" json:"source"` // kafka, directory or http; Topic names the file or import for non-Kafka sources
 	Topic     string    `gorm:"type:varchar(255);not null;index" json:"topic"`
 	Partition int32     `gorm:"type:int;not null;index" json:"partition"`
 	Offset    int64     `gorm:"type:bigint;not null;index" json:"offset"`
@@ -41,8 +84,28 @@ type KafkaMessageLog struct {
 	Status    string    `gorm:"type:varchar(50);index" json:"status"` // e.g., "received", "processed", "failed"
 	Error     string    `gorm:"type:text" json:"error,omitempty"`
 
+	// Reprocessing by admins. OriginalValue keeps the payload as received
+	// once Value has been edited.
+	OriginalValue  *string    `gorm:"type:text" json:"original_value,omitempty"`
+	ReprocessCount int        `gorm:"not null;default:0" json:"reprocess_count"`
+	ReprocessedAt  *time.Time `json:"reprocessed_at,omitempty"`
+
 	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
 	IsDeleted bool       `gorm:"not null;default:false" json:"is_deleted"`
 }
+
+// KafkaConsumerOffset records the last offset of a topic partition whose
+// message has been fully applied. It is written in the same transaction as
+// the message's outcome, so the consumer resumes exactly after it.
+type KafkaConsumerOffset struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConsumerGroup string `gorm:"type:varchar(255);not null" json:"consumer_group"`
+	Topic         string `gorm:"type:varchar(255);not null" json:"topic"`
+	Partition     int32  `gorm:"type:int;not null" json:"partition"`
+	Offset        int64  `gorm:"type:bigint;not null" json:"offset"` // Last applied offset
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -42,6 +42,14 @@ type Order struct {
 	Address            Address          `gorm:"foreignKey:AddressID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"address"`
 	ReturningAddress   ReturningAddress `gorm:"foreignKey:ReturningAddressID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"returning_address"`
 
+	// Set when upstream withdraws the voter; cancelled orders are never printed
+	IsCancelled  bool       `gorm:"not null;default:false;index" json:"is_cancelled"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CancelReason string     `gorm:"type:text" json:"cancel_reason,omitempty"`
+
+	// Approved reprints of this order, limited per order
+	ReprintCount int `gorm:"not null;default:0" json:"reprint_count"`
+
 	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
@@ -63,6 +71,9 @@ const (
 	OrderReturnBooked OrderEventStatus = "ORDER_RETURN_BOOKED"
 	OrderReturned     OrderEventStatus = "ORDER_RETURNED"
 	OrderReprinted    OrderEventStatus = "ORDER_REPRINTED"
+	OrderUpdated      OrderEventStatus = "ORDER_UPDATED"
+	OrderCancelled    OrderEventStatus = "ORDER_CANCELLED"
+	OrderPrintResumed OrderEventStatus = "ORDER_PRINT_RESUMED"
 
 	// Failure statuses
 	OrderReceiveFailed  OrderEventStatus = "ORDER_RECEIVE_FAILED"
@@ -73,6 +84,8 @@ const (
 	OrderDeliveryFailed OrderEventStatus = "ORDER_DELIVERY_FAILED"
 	OrderReturnFailed   OrderEventStatus = "ORDER_RETURN_FAILED"
 	OrderReprintFailed  OrderEventStatus = "ORDER_REPRINT_FAILED"
+	OrderUpdateRejected OrderEventStatus = "ORDER_UPDATE_REJECTED"
+	OrderCancelRejected OrderEventStatus = "ORDER_CANCEL_REJECTED"
 )
 
 // OrderEvent represents an event in the order lifecycle
@@ -99,6 +112,9 @@ type OrderBatch struct {
 	TotalOrders   int    `gorm:"not null;default:0" json:"total_orders"`
 	CreatedByID   uint   `gorm:"index" json:"created_by_id"`
 
+	// Set on batches made by the batching rules, e.g. "district=DHAKA"
+	GroupKey string `gorm:"type:varchar(255);index" json:"group_key,omitempty"`
+
 	CreatedAt time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
 	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
@@ -110,6 +126,17 @@ func (OrderBatch) TableName() string {
 	return "order_batches"
 }
 
+// BatchNumberSequence holds the last running number used for a batch number
+// prefix, so batch numbers are allocated without gaps or collisions
+type BatchNumberSequence struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Prefix     string `gorm:"type:varchar(50);not null" json:"prefix"`
+	LastNumber int    `gorm:"not null;default:0" json:"last_number"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
 // OrderBatchItem represents the many-to-many relationship between orders and batches
 type OrderBatchItem struct {
 	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -24,6 +24,11 @@ type PrintBatchJob struct {
 	FailedJobs    int            `gorm:"not null;default:0" json:"failed_jobs"`
 	CreatedByID   uint           `gorm:"index" json:"created_by_id"`
 
+	// Page progress reported by the print client. PagesPerOrder is fixed
+	// when the live PDF is generated so pages map back to sequences.
+	PagesPerOrder int `gorm:"not null;default:0" json:"pages_per_order"`
+	PagesPrinted  int `gorm:"not null;default:0" json:"pages_printed"`
+
 	ErrorMessage string `gorm:"type:text" json:"error_message,omitempty"`
 	PrinterID    string `gorm:"type:varchar(255);index" json:"printer_id,omitempty"`
 	Command      string `gorm:"type:varchar(255);index" json:"command,omitempty"`
@@ -31,6 +36,14 @@ type PrintBatchJob struct {
 	JobToken     string `gorm:"type:varchar(255);index" json:"job_token,omitempty"`
 	JobUuid      string `gorm:"type:varchar(255);index" json:"job_uuid,omitempty"`
 
+	// Lineage of resumed jobs: ResumedFromID is the failed job this one
+	// continues and RootJobID the first job of the chain
+	ResumedFromID *uint `gorm:"index" json:"resumed_from_id,omitempty"`
+	RootJobID     *uint `gorm:"index" json:"root_job_id,omitempty"`
+
+	// Set on jobs printing an approved reprint request
+	ReprintRequestID *uint `gorm:"index" json:"reprint_request_id,omitempty"`
+
 	CreatedAt   time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
 	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 	StartedAt   *time.Time `gorm:"index" json:"started_at,omitempty"`
@@ -88,3 +101,192 @@ type PrintJobData struct {
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
 	IsDeleted bool       `gorm:"not null;default:false" json:"is_deleted"`
 }
+
+// PrintClientEvent is an event reported by a cloud print client over its
+// WebSocket, kept as received. Job events are linked to their batch job.
+type PrintClientEvent struct {
+	ID              uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	PrinterID       string `gorm:"type:varchar(255);not null;index" json:"printer_id"`
+	Type            string `gorm:"type:varchar(50);not null" json:"type"`
+	Event           string `gorm:"type:varchar(100);not null;index" json:"event"`
+	JobUuid         string `gorm:"type:varchar(255);index" json:"job_uuid,omitempty"`
+	PrintBatchJobID *uint  `gorm:"index" json:"print_batch_job_id,omitempty"`
+	Message         string `gorm:"type:text" json:"message"`
+	ClientVersion   string `gorm:"type:varchar(50)" json:"client_version,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// Printer is a print client known to the server. It is registered the first
+// time the client authenticates, keyed by the token derived from its
+// hardware, and admins label it, place it at a print center and assign it to
+// an operator. Only enabled printers are given print jobs.
+type Printer struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	PrinterID     string `gorm:"type:varchar(255);not null" json:"printer_id"`
+	Name          string `gorm:"type:varchar(255)" json:"name"`
+	PrintCenter   string `gorm:"type:varchar(255);index" json:"print_center"`
+	OperatorID    *uint  `gorm:"index" json:"operator_id,omitempty"`
+	Enabled       bool   `gorm:"not null;default:true;index" json:"enabled"`
+	Platform      string `gorm:"type:varchar(255)" json:"platform"`
+	Processor     string `gorm:"type:varchar(255)" json:"processor"`
+	ClientVersion string `gorm:"type:varchar(50)" json:"client_version"`
+
+	FirstSeenAt        time.Time  `json:"first_seen_at"`
+	LastSeenAt         time.Time  `gorm:"index" json:"last_seen_at"`
+	LastConnectedAt    *time.Time `json:"last_connected_at,omitempty"`
+	LastDisconnectedAt *time.Time `json:"last_disconnected_at,omitempty"`
+
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	IsDeleted bool       `gorm:"not null;default:false" json:"is_deleted"`
+}
+
+// EnrollmentStatus is the review state of a print client's key
+type EnrollmentStatus string
+
+const (
+	EnrollmentPending  EnrollmentStatus = "PENDING"
+	EnrollmentApproved EnrollmentStatus = "APPROVED"
+	EnrollmentRejected EnrollmentStatus = "REJECTED"
+	EnrollmentRevoked  EnrollmentStatus = "REVOKED"
+)
+
+// PrintClientEnrollment is the Ed25519 public key a print client presents
+// for a printer. A key must be approved by an admin before the client may
+// authenticate with it, and it can be revoked later. Fingerprint is the hex
+// SHA-256 of the raw key.
+type PrintClientEnrollment struct {
+	ID            uint             `gorm:"primaryKey;autoIncrement" json:"id"`
+	PrinterID     string           `gorm:"type:varchar(255);not null;index" json:"printer_id"`
+	PublicKey     string           `gorm:"type:text;not null" json:"public_key"`
+	Fingerprint   string           `gorm:"type:varchar(64);not null" json:"fingerprint"`
+	Status        EnrollmentStatus `gorm:"type:varchar(20);not null;default:'PENDING';index" json:"status"`
+	Platform      string           `gorm:"type:varchar(255)" json:"platform"`
+	Processor     string           `gorm:"type:varchar(255)" json:"processor"`
+	HardwareID    string           `gorm:"type:varchar(255)" json:"hardware_id"`
+	ClientVersion string           `gorm:"type:varchar(50)" json:"client_version"`
+
+	ReviewedByID *uint      `gorm:"index" json:"reviewed_by_id,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote   string     `gorm:"type:text" json:"review_note,omitempty"`
+	RevokedByID  *uint      `gorm:"index" json:"revoked_by_id,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason string     `gorm:"type:text" json:"revoke_reason,omitempty"`
+
+	LastAttemptAt time.Time  `json:"last_attempt_at"`
+	LastAuthAt    *time.Time `json:"last_auth_at,omitempty"`
+
+	CreatedAt time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	IsDeleted bool       `gorm:"not null;default:false" json:"is_deleted"`
+}
+
+// MessageStatus is the delivery state of a message queued for a print client
+type MessageStatus string
+
+const (
+	MessageQueued  MessageStatus = "QUEUED"
+	MessageSent    MessageStatus = "SENT"
+	MessageAcked   MessageStatus = "ACKED"
+	MessageNacked  MessageStatus = "NACKED"
+	MessageExpired MessageStatus = "EXPIRED"
+)
+
+// PrintClientMessage is a message for a print client, kept until the client
+// acknowledges it or it expires. A printer's messages are delivered in ID
+// order while it is connected and wait in the table while it is not.
+// MessageID is sent with the message and echoed in the client's ack or nack;
+// messages sent to clients speaking protocol 1 or later are sent again at
+// NextAttemptAt until acknowledged.
+type PrintClientMessage struct {
+	ID              uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID       string        `gorm:"type:varchar(64);not null;default:''" json:"message_id"`
+	PrinterID       string        `gorm:"type:varchar(255);not null;index" json:"printer_id"`
+	JobUuid         string        `gorm:"type:varchar(255);index" json:"job_uuid,omitempty"`
+	PrintBatchJobID *uint         `gorm:"index" json:"print_batch_job_id,omitempty"`
+	Command         string        `gorm:"type:varchar(255)" json:"command"`
+	Payload         string        `gorm:"type:text;not null" json:"payload"`
+	Status          MessageStatus `gorm:"type:varchar(20);not null;default:'QUEUED';index" json:"status"`
+	Attempts        int           `gorm:"not null;default:0" json:"attempts"`
+	ProtocolVersion int           `gorm:"not null;default:0" json:"protocol_version"`
+	LastError       string        `gorm:"type:text" json:"last_error,omitempty"`
+
+	ExpiresAt     time.Time  `gorm:"not null;index" json:"expires_at"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	AckedAt       *time.Time `json:"acked_at,omitempty"`
+	NackedAt      *time.Time `json:"nacked_at,omitempty"`
+	ExpiredAt     *time.Time `json:"expired_at,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// PrintClientPresence records which server instance holds a printer's
+// session, so any instance can route messages to it. Each instance renews
+// HeartbeatAt on its rows; rows of an instance that stopped renewing them
+// are ignored and swept.
+type PrintClientPresence struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	PrinterID       string    `gorm:"type:varchar(255);not null" json:"printer_id"`
+	NodeID          string    `gorm:"type:varchar(255);not null;index" json:"node_id"`
+	ProtocolVersion int       `gorm:"not null;default:0" json:"protocol_version"`
+	ConnectedAt     time.Time `json:"connected_at"`
+	HeartbeatAt     time.Time `gorm:"index" json:"heartbeat_at"`
+}
+
+// ReprintReason is why printed envelopes have to be printed again
+type ReprintReason string
+
+const (
+	ReprintSpoiled  ReprintReason = "SPOILED"
+	ReprintMisprint ReprintReason = "MISPRINT"
+	ReprintLost     ReprintReason = "LOST"
+)
+
+// ReprintStatus tracks the approval of a reprint request
+type ReprintStatus string
+
+const (
+	ReprintPending  ReprintStatus = "PENDING"
+	ReprintApproved ReprintStatus = "APPROVED"
+	ReprintRejected ReprintStatus = "REJECTED"
+)
+
+// ReprintRequest asks for already printed orders to be printed again. It is
+// raised by one user and must be approved by a different admin before a print
+// job is created for it.
+type ReprintRequest struct {
+	ID            uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	Reason        ReprintReason `gorm:"type:varchar(20);not null;index" json:"reason"`
+	Note          string        `gorm:"type:text" json:"note,omitempty"`
+	Status        ReprintStatus `gorm:"type:varchar(20);not null;default:'PENDING';index" json:"status"`
+	JobType       string        `gorm:"type:varchar(255);not null" json:"job_type"`
+	PrinterID     string        `gorm:"type:varchar(255)" json:"printer_id,omitempty"`
+	RequestedByID uint          `gorm:"not null;index" json:"requested_by_id"`
+
+	ReviewedByID    *uint      `gorm:"index" json:"reviewed_by_id,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote      string     `gorm:"type:text" json:"review_note,omitempty"`
+	PrintBatchJobID *uint      `gorm:"index" json:"print_batch_job_id,omitempty"`
+
+	Items []ReprintRequestItem `gorm:"foreignKey:ReprintRequestID" json:"items,omitempty"`
+
+	CreatedAt time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	IsDeleted bool       `gorm:"not null;default:false" json:"is_deleted"`
+}
+
+// ReprintRequestItem is an order included in a reprint request
+type ReprintRequestItem struct {
+	ID               uint `gorm:"primaryKey;autoIncrement" json:"id"`
+	ReprintRequestID uint `gorm:"index;not null" json:"reprint_request_id"`
+	OrderID          uint `gorm:"index;not null" json:"order_id"`
+	Sequence         int  `gorm:"index;not null" json:"sequence"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
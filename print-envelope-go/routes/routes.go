@@ -4,6 +4,7 @@ import (
 	// "printenvelope/constants"
 	"printenvelope/constants"
 	"printenvelope/controllers/auth"
+	"printenvelope/controllers/kafka"
 	"printenvelope/controllers/order"
 	"printenvelope/controllers/print"
 	printclient "printenvelope/controllers/print-client"
@@ -24,7 +25,7 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	orderController := order.NewOrderController(db, asyncLogger)
 	printController := print.NewPrintController(db, asyncLogger)
 	printClientController := printclient.NewPrintClientController(printclient.GetService())
-	// kafkaController := product.NewKafkaController(db, asyncLogger)
+	kafkaController := kafka.NewKafkaController(db, asyncLogger)
 	// cloudPrintController := product.NewCloudPrintController(db, asyncLogger)
 	// userController := user.NewUserController(db, asyncLogger)
 	go asyncLogger.ProcessLog()
@@ -45,6 +46,10 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	api := app.Group("/api")
 	api.Post("/login", authController.Login)
 
+	// PDF downloads for print clients (authorized by job UUID + job token)
+	api.Post("/print/envelope-pdf-generator", printController.EnvelopePDFGenerator)
+	api.Post("/print/envelope-pdf-specimen-generator", printController.EnvelopePDFSpecimenGenerator)
+
 	/*=============================================================================
 	| Protected Routes
 	===============================================================================*/
@@ -69,15 +74,134 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 		constants.PermOperatorFull,
 	), orderController.BatchOrderCreate)
 
+	order.Post("/auto-batch", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), orderController.AutoBatch)
+
+	order.Post("/import", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), orderController.ImportOrders)
+
 	printGroup := api.Group("/print")
 	printGroup.Post("/print-batch", middleware.RequirePermissions(
 		constants.PermOperatorFull,
 	), printController.PrintBatch)
 
+	printGroup.Post("/print-batch/:id/resume", middleware.RequirePermissions(
+		constants.PermOperatorFull,
+	), printController.ResumePrintBatch)
+
+	// Reprints are raised by anyone printing and approved by a second admin
+	printGroup.Post("/reprint-request", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.CreateReprintRequest)
+
+	printGroup.Get("/reprint-request-list", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.ReprintRequestList)
+
+	printGroup.Post("/reprint-request/:id/approve", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printController.ApproveReprintRequest)
+
+	printGroup.Post("/reprint-request/:id/reject", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printController.RejectReprintRequest)
+
+	printGroup.Get("/reprint-count-list", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.ReprintCountList)
+
+	// Order batches and their print progress
+	printGroup.Get("/batch_list", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.BatchList)
+
+	printGroup.Get("/batch/:id", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.BatchDetail)
+
+	printGroup.Delete("/batch/:id", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.CancelBatch)
+
+	printGroup.Post("/batch/:id/split", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.SplitBatch)
+
+	printGroup.Post("/batch-merge", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.MergeBatches)
+
+	// Dispatch paperwork for printed batches
+	printGroup.Get("/batch/:id/manifest", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.DispatchManifest)
+
+	printGroup.Get("/batch/:id/bag-tags", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.BagTags)
+
+	printGroup.Get("/printed_list", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.PrintedList)
+
 	printGroup.Post("/print-envelope", middleware.RequirePermissions(
 		constants.PermOperatorFull,
 	), printController.PrintEnvelope)
 
+	printGroup.Get("/job-types", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printController.JobTypes)
+
+	// Kafka message routes (inspecting and reprocessing rejected messages)
+	kafkaGroup := api.Group("/kafka")
+	kafkaGroup.Get("/message-list", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), kafkaController.MessageList)
+	kafkaGroup.Get("/message/:id", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), kafkaController.MessageDetail)
+	kafkaGroup.Put("/message/:id", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), kafkaController.UpdateMessage)
+	kafkaGroup.Post("/message/:id/reprocess", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), kafkaController.ReprocessMessage)
+
 	// Print Client routes (for managing connected printers)
 	printClientGroup := api.Group("/print-client")
 	printClientGroup.Get("/metrics", printClientController.GetMetrics)
@@ -88,6 +212,51 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 		constants.PermAdminFull,
 		constants.PermOperatorFull,
 	), printClientController.GetConnectedPrinters)
+
+	// Registered printers
+	printClientGroup.Get("/printers", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printClientController.ListPrinters)
+	printClientGroup.Get("/printers/:id", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printClientController.PrinterDetail)
+	printClientGroup.Put("/printers/:id", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printClientController.UpdatePrinter)
+
+	// Print client enrollments
+	printClientGroup.Get("/enrollments", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printClientController.ListEnrollments)
+	printClientGroup.Post("/enrollments/:id/approve", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printClientController.ApproveEnrollment)
+	printClientGroup.Post("/enrollments/:id/reject", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printClientController.RejectEnrollment)
+	printClientGroup.Post("/enrollments/:id/revoke", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printClientController.RevokeEnrollment)
+
+	// Outbound message queue
+	printClientGroup.Get("/messages", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+	), printClientController.ListMessages)
+	printClientGroup.Get("/jobs/:job_uuid/delivery", middleware.RequirePermissions(
+		constants.PermSuperAdminFull,
+		constants.PermAdminFull,
+		constants.PermOperatorFull,
+	), printClientController.JobDeliveryState)
 	// printClientGroup.Delete("/disconnect/:printer_id", middleware.RequirePermissions(
 	// 	constants.PermAdminFull,
 	// ), printClientController.DisconnectPrinter)
@@ -0,0 +1,645 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strings"
+	"time"
+
+	"printenvelope/models/order"
+	"printenvelope/models/print"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Batch grouping keys and the column each one groups on
+var batchGroupColumns = map[string]string{
+	"district":                  "returning_addresses.district",
+	"district_head_post_office": "returning_addresses.district_head_post_office",
+	"returning_zip_code":        "returning_addresses.zip_code",
+	"city":                      "addresses.city",
+}
+
+const (
+	// DefaultMaxBatchSize is used when a rule does not set a maximum size
+	DefaultMaxBatchSize = 500
+	// MaxBatchSizeLimit caps the orders a single batch may hold
+	MaxBatchSizeLimit = 5000
+
+	// RangeBatchPrefix names batches created from a sequence range
+	RangeBatchPrefix = "BATCH"
+
+	// batchingLockKey is the advisory lock held while orders are batched
+	batchingLockKey = 7_310_016
+)
+
+// BatchRule describes how unbatched orders are grouped into batches. Orders
+// sharing the values of every GroupBy key go together, in sequence order,
+// and a group larger than MaxBatchSize is split into several batches. The
+// optional sequence range limits the orders considered.
+type BatchRule struct {
+	GroupBy       []string
+	MaxBatchSize  int
+	StartSequence int
+	EndSequence   int
+}
+
+// Validate checks the rule and fills in defaults
+func (r *BatchRule) Validate() error {
+	if len(r.GroupBy) == 0 {
+		r.GroupBy = []string{"district"}
+	}
+	seen := make(map[string]bool, len(r.GroupBy))
+	for i, key := range r.GroupBy {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if _, ok := batchGroupColumns[key]; !ok {
+			return fmt.Errorf("unknown group key %q, expected district, district_head_post_office, returning_zip_code or city", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("group key %q is repeated", key)
+		}
+		seen[key] = true
+		r.GroupBy[i] = key
+	}
+
+	if r.MaxBatchSize == 0 {
+		r.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if r.MaxBatchSize < 1 || r.MaxBatchSize > MaxBatchSizeLimit {
+		return fmt.Errorf("max batch size must be between 1 and %d", MaxBatchSizeLimit)
+	}
+	if r.StartSequence < 0 || r.EndSequence < 0 || (r.EndSequence > 0 && r.StartSequence > r.EndSequence) {
+		return fmt.Errorf("invalid sequence range %d to %d", r.StartSequence, r.EndSequence)
+	}
+	return nil
+}
+
+// PlannedBatch is a batch produced by a rule. ID is set once it is created.
+type PlannedBatch struct {
+	ID            uint              `json:"id,omitempty"`
+	BatchNumber   string            `json:"batch_number"`
+	GroupKey      string            `json:"group_key"`
+	Group         map[string]string `json:"group"`
+	StartSequence int               `json:"start_sequence"`
+	EndSequence   int               `json:"end_sequence"`
+	TotalOrders   int               `json:"total_orders"`
+
+	orders []batchCandidate
+}
+
+type batchCandidate struct {
+	ID       uint
+	Sequence int
+	Values   []string
+}
+
+// BatchingService groups unbatched orders into order batches
+type BatchingService struct {
+	db *gorm.DB
+}
+
+// NewBatchingService creates a batching service
+func NewBatchingService(db *gorm.DB) *BatchingService {
+	return &BatchingService{db: db}
+}
+
+// AutoBatch creates the batches for rule in one transaction and returns
+// them. With dryRun the batches are planned and numbered but not created;
+// the numbers shown are the ones a real run would use at that moment.
+func (bs *BatchingService) AutoBatch(rule BatchRule, createdByID uint, dryRun bool) ([]PlannedBatch, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	var planned []PlannedBatch
+	err := bs.db.Transaction(func(tx *gorm.DB) error {
+		if err := LockBatching(tx); err != nil {
+			return err
+		}
+		candidates, err := unbatchedOrders(tx, rule)
+		if err != nil {
+			return err
+		}
+		planned = planBatches(rule, candidates)
+
+		if dryRun {
+			return previewBatchNumbers(tx, planned)
+		}
+		for i := range planned {
+			if err := createPlannedBatch(tx, &planned[i], createdByID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return planned, nil
+}
+
+// LockBatching serialises the transactions that put orders into new
+// batches. The lock is held until tx ends, so a second run only looks for
+// unbatched orders once the first has committed its batches. The unique
+// index on live order_batch_items(order_id) backs this up.
+func LockBatching(tx *gorm.DB) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", batchingLockKey).Error; err != nil {
+		return fmt.Errorf("failed to lock batching: %w", err)
+	}
+	return nil
+}
+
+// unbatchedOrders loads the orders not cancelled and not in any live batch,
+// ordered by the normalised group values and then by sequence. Callers hold
+// LockBatching so a concurrent run cannot batch them too.
+func unbatchedOrders(tx *gorm.DB, rule BatchRule) ([]batchCandidate, error) {
+	selects := []string{"orders.id", "orders.sequence"}
+	var orderBy []string
+	for i, key := range rule.GroupBy {
+		expr := fmt.Sprintf("UPPER(TRIM(COALESCE(%s, '')))", batchGroupColumns[key])
+		selects = append(selects, fmt.Sprintf("%s AS g%d", expr, i))
+		orderBy = append(orderBy, fmt.Sprintf("g%d", i))
+	}
+	orderBy = append(orderBy, "orders.sequence ASC")
+
+	query := tx.Table("orders").
+		Select(strings.Join(selects, ", ")).
+		Joins("JOIN addresses ON addresses.id = orders.address_id").
+		Joins("JOIN returning_addresses ON returning_addresses.id = orders.returning_address_id").
+		Where("orders.is_cancelled = ? AND orders.is_deleted = ?", false, false).
+		Where(`NOT EXISTS (SELECT 1 FROM order_batch_items
+			JOIN order_batches ON order_batches.id = order_batch_items.order_batch_id
+			WHERE order_batch_items.order_id = orders.id
+				AND order_batch_items.deleted_at IS NULL AND order_batches.deleted_at IS NULL)`)
+	if rule.StartSequence > 0 {
+		query = query.Where("orders.sequence >= ?", rule.StartSequence)
+	}
+	if rule.EndSequence > 0 {
+		query = query.Where("orders.sequence <= ?", rule.EndSequence)
+	}
+
+	rows, err := query.Order(strings.Join(orderBy, ", ")).
+		Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "orders"}}).
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unbatched orders: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []batchCandidate
+	for rows.Next() {
+		c := batchCandidate{Values: make([]string, len(rule.GroupBy))}
+		dest := []interface{}{&c.ID, &c.Sequence}
+		for i := range c.Values {
+			dest = append(dest, &c.Values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read unbatched orders: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// planBatches splits the ordered candidates into groups and each group into
+// batches of at most MaxBatchSize orders
+func planBatches(rule BatchRule, candidates []batchCandidate) []PlannedBatch {
+	var planned []PlannedBatch
+	var current *PlannedBatch
+	for _, c := range candidates {
+		groupKey := groupKeyOf(rule.GroupBy, c.Values)
+		if current == nil || current.GroupKey != groupKey || len(current.orders) >= rule.MaxBatchSize {
+			group := make(map[string]string, len(rule.GroupBy))
+			for i, key := range rule.GroupBy {
+				group[key] = c.Values[i]
+			}
+			planned = append(planned, PlannedBatch{
+				GroupKey:      groupKey,
+				Group:         group,
+				StartSequence: c.Sequence,
+			})
+			current = &planned[len(planned)-1]
+		}
+		current.orders = append(current.orders, c)
+		current.EndSequence = c.Sequence
+		current.TotalOrders++
+	}
+	return planned
+}
+
+func groupKeyOf(keys, values []string) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		value := values[i]
+		if value == "" {
+			value = "UNKNOWN"
+		}
+		parts[i] = key + "=" + value
+	}
+	return strings.Join(parts, "|")
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// batchPrefix derives the batch number prefix from the group values, e.g.
+// DHAKA or DHAKA-1000. Bengali names are transliterated, so ঢাকা also gives
+// DHAKA; a name with nothing left to spell falls back to a checksum of it,
+// keeping different districts apart. The prefix leaves room for the running
+// number.
+func batchPrefix(group []string) string {
+	var parts []string
+	for _, value := range group {
+		slug := nonAlphanumeric.ReplaceAllString(strings.ToUpper(transliterateBangla(value)), "")
+		if slug == "" && strings.TrimSpace(value) != "" {
+			slug = fmt.Sprintf("X%08X", crc32.ChecksumIEEE([]byte(value)))
+		}
+		if slug == "" {
+			slug = "UNKNOWN"
+		}
+		if len(slug) > 12 {
+			slug = slug[:12]
+		}
+		parts = append(parts, slug)
+	}
+	prefix := strings.Join(parts, "-")
+	if len(prefix) > 40 {
+		prefix = prefix[:40]
+	}
+	return prefix
+}
+
+// NextBatchNumber allocates the next running number for prefix and returns
+// the batch number, e.g. DHAKA-0003. The counter row is locked until tx ends,
+// so concurrent batching never hands out the same number.
+func NextBatchNumber(tx *gorm.DB, prefix string) (string, error) {
+	var next int
+	err := tx.Raw(`INSERT INTO batch_number_sequences (prefix, last_number, created_at, updated_at)
+		VALUES (?, 1, NOW(), NOW())
+		ON CONFLICT (prefix) DO UPDATE SET last_number = batch_number_sequences.last_number + 1, updated_at = NOW()
+		RETURNING last_number`, prefix).Scan(&next).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate batch number for %s: %w", prefix, err)
+	}
+	return formatBatchNumber(prefix, next), nil
+}
+
+// formatBatchNumber joins a batch prefix and its running number
+func formatBatchNumber(prefix string, number int) string {
+	return fmt.Sprintf("%s-%04d", prefix, number)
+}
+
+// previewBatchNumbers fills in the numbers the planned batches would get
+// without allocating them
+func previewBatchNumbers(tx *gorm.DB, planned []PlannedBatch) error {
+	used := make(map[string]int)
+	for i := range planned {
+		prefix := batchPrefix(planned[i].orders[0].Values)
+		if _, ok := used[prefix]; !ok {
+			var last []int
+			if err := tx.Model(&order.BatchNumberSequence{}).Where("prefix = ?", prefix).
+				Pluck("last_number", &last).Error; err != nil {
+				return err
+			}
+			if len(last) > 0 {
+				used[prefix] = last[0]
+			}
+		}
+		used[prefix]++
+		planned[i].BatchNumber = formatBatchNumber(prefix, used[prefix])
+	}
+	return nil
+}
+
+// createPlannedBatch creates the order batch, its items and an OrderBatched
+// event for each order
+func createPlannedBatch(tx *gorm.DB, planned *PlannedBatch, createdByID uint) error {
+	batchNumber, err := NextBatchNumber(tx, batchPrefix(planned.orders[0].Values))
+	if err != nil {
+		return err
+	}
+
+	batch := order.OrderBatch{
+		BatchNumber:   batchNumber,
+		StartSequence: planned.StartSequence,
+		EndSequence:   planned.EndSequence,
+		TotalOrders:   planned.TotalOrders,
+		CreatedByID:   createdByID,
+		GroupKey:      planned.GroupKey,
+	}
+	if len(batch.GroupKey) > 255 {
+		batch.GroupKey = batch.GroupKey[:255]
+	}
+	if err := tx.Create(&batch).Error; err != nil {
+		return fmt.Errorf("failed to create batch %s: %w", batchNumber, err)
+	}
+	planned.ID = batch.ID
+	planned.BatchNumber = batch.BatchNumber
+
+	items := make([]order.OrderBatchItem, 0, len(planned.orders))
+	events := make([]order.OrderEvent, 0, len(planned.orders))
+	for _, c := range planned.orders {
+		items = append(items, order.OrderBatchItem{OrderID: c.ID, OrderBatchID: batch.ID})
+
+		metadata, err := json.Marshal(map[string]interface{}{
+			"batch_id":       batch.ID,
+			"batch_number":   batch.BatchNumber,
+			"order_sequence": c.Sequence,
+			"group_key":      planned.GroupKey,
+		})
+		if err != nil {
+			return err
+		}
+		metadataStr := string(metadata)
+		events = append(events, order.OrderEvent{
+			OrderID:  c.ID,
+			Status:   order.OrderBatched,
+			Message:  fmt.Sprintf("Order %d has been batched into %s", c.Sequence, batch.BatchNumber),
+			Metadata: &metadataStr,
+		})
+	}
+	if err := tx.CreateInBatches(&items, 500).Error; err != nil {
+		return fmt.Errorf("failed to add orders to batch %s: %w", batchNumber, err)
+	}
+	if err := tx.CreateInBatches(&events, 500).Error; err != nil {
+		return fmt.Errorf("failed to record batched events for %s: %w", batchNumber, err)
+	}
+	return nil
+}
+
+// Errors returned by the batch split and merge operations
+var (
+	ErrBatchNotFound  = errors.New("order batch not found")
+	ErrBatchHasPrints = errors.New("order batch has print jobs")
+	ErrInvalidBatchOp = errors.New("invalid batch operation")
+)
+
+// batchNumberSuffix matches the running number at the end of a batch number
+var batchNumberSuffix = regexp.MustCompile(`-\d+$`)
+
+// SplitBatch moves part of an unprinted batch into new batches. With
+// atSequence the orders from that sequence on move to one new batch; with
+// size the batch is cut into batches of size orders, the first staying in
+// the original. New batches continue the numbering of the original's prefix.
+func (bs *BatchingService) SplitBatch(batchID uint, atSequence, size int, userID uint) ([]order.OrderBatch, error) {
+	if (atSequence > 0) == (size > 0) {
+		return nil, fmt.Errorf("%w: give either a sequence to split at or a batch size", ErrInvalidBatchOp)
+	}
+
+	var result []order.OrderBatch
+	err := bs.db.Transaction(func(tx *gorm.DB) error {
+		batches, err := lockUnprintedBatches(tx, []uint{batchID})
+		if err != nil {
+			return err
+		}
+		original := batches[0]
+
+		items, err := batchItems(tx, original.ID)
+		if err != nil {
+			return err
+		}
+
+		var parts [][]batchItem
+		if atSequence > 0 {
+			cut := len(items)
+			for i, item := range items {
+				if item.Sequence >= atSequence {
+					cut = i
+					break
+				}
+			}
+			if cut == 0 || cut == len(items) {
+				return fmt.Errorf("%w: sequence %d does not fall inside batch %s", ErrInvalidBatchOp, atSequence, original.BatchNumber)
+			}
+			parts = [][]batchItem{items[:cut], items[cut:]}
+		} else {
+			if size >= len(items) {
+				return fmt.Errorf("%w: batch %s has %d orders, nothing to split at size %d", ErrInvalidBatchOp, original.BatchNumber, len(items), size)
+			}
+			for start := 0; start < len(items); start += size {
+				end := start + size
+				if end > len(items) {
+					end = len(items)
+				}
+				parts = append(parts, items[start:end])
+			}
+		}
+
+		result = append(result, original)
+
+		prefix := batchNumberPrefix(original.BatchNumber)
+		for _, part := range parts[1:] {
+			batchNumber, err := NextBatchNumber(tx, prefix)
+			if err != nil {
+				return err
+			}
+			split := order.OrderBatch{
+				BatchNumber: batchNumber,
+				CreatedByID: userID,
+				GroupKey:    original.GroupKey,
+			}
+			if err := tx.Create(&split).Error; err != nil {
+				return fmt.Errorf("failed to create batch %s: %w", batchNumber, err)
+			}
+			if err := moveBatchItems(tx, part, &original, &split, "split", userID); err != nil {
+				return err
+			}
+			if err := refreshBatch(tx, &split); err != nil {
+				return err
+			}
+			result = append(result, split)
+		}
+		return refreshBatch(tx, &result[0])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MergeBatches moves the orders of the other unprinted batches into the first
+// one and cancels the emptied batches
+func (bs *BatchingService) MergeBatches(batchIDs []uint, userID uint) (*order.OrderBatch, error) {
+	unique := make(map[uint]bool, len(batchIDs))
+	var ids []uint
+	for _, id := range batchIDs {
+		if !unique[id] {
+			unique[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("%w: at least two different batches are needed to merge", ErrInvalidBatchOp)
+	}
+
+	var target order.OrderBatch
+	err := bs.db.Transaction(func(tx *gorm.DB) error {
+		batches, err := lockUnprintedBatches(tx, ids)
+		if err != nil {
+			return err
+		}
+		byID := make(map[uint]order.OrderBatch, len(batches))
+		for _, batch := range batches {
+			byID[batch.ID] = batch
+		}
+		target = byID[ids[0]]
+
+		now := time.Now()
+		for _, id := range ids[1:] {
+			source := byID[id]
+			items, err := batchItems(tx, source.ID)
+			if err != nil {
+				return err
+			}
+			if err := moveBatchItems(tx, items, &source, &target, "merge", userID); err != nil {
+				return err
+			}
+			if source.GroupKey != target.GroupKey {
+				target.GroupKey = ""
+			}
+			if err := tx.Model(&source).Updates(map[string]interface{}{
+				"deleted_at":   now,
+				"is_deleted":   true,
+				"total_orders": 0,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&target).Update("group_key", target.GroupKey).Error; err != nil {
+			return err
+		}
+		return refreshBatch(tx, &target)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+type batchItem struct {
+	ID       uint
+	OrderID  uint
+	Sequence int
+}
+
+// lockUnprintedBatches locks the live batches with ids, failing when one is
+// missing or has a print job that was not cancelled
+func lockUnprintedBatches(tx *gorm.DB, ids []uint) ([]order.OrderBatch, error) {
+	var batches []order.OrderBatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ? AND is_deleted = ?", ids, false).
+		Order("id ASC").Find(&batches).Error; err != nil {
+		return nil, err
+	}
+	if len(batches) != len(ids) {
+		return nil, ErrBatchNotFound
+	}
+
+	var printed []string
+	if err := tx.Table("print_batch_jobs").Distinct("batch_number").
+		Where("order_batch_id IN ? AND is_deleted = ? AND status <> ?", ids, false, print.PrintJobCancelled).
+		Pluck("batch_number", &printed).Error; err != nil {
+		return nil, err
+	}
+	if len(printed) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrBatchHasPrints, strings.Join(printed, ", "))
+	}
+	return batches, nil
+}
+
+// batchItems returns the live items of a batch in sequence order
+func batchItems(tx *gorm.DB, batchID uint) ([]batchItem, error) {
+	var items []batchItem
+	err := tx.Table("order_batch_items").
+		Select("order_batch_items.id, order_batch_items.order_id, orders.sequence").
+		Joins("JOIN orders ON orders.id = order_batch_items.order_id").
+		Where("order_batch_items.order_batch_id = ? AND order_batch_items.is_deleted = ?", batchID, false).
+		Order("orders.sequence ASC").
+		Scan(&items).Error
+	return items, err
+}
+
+// moveBatchItems reassigns items from one batch to another and records an
+// OrderBatched event with both batch numbers for each order
+func moveBatchItems(tx *gorm.DB, items []batchItem, from, to *order.OrderBatch, operation string, userID uint) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	if err := tx.Model(&order.OrderBatchItem{}).Where("id IN ?", ids).
+		Update("order_batch_id", to.ID).Error; err != nil {
+		return fmt.Errorf("failed to move orders to batch %s: %w", to.BatchNumber, err)
+	}
+
+	events := make([]order.OrderEvent, 0, len(items))
+	for _, item := range items {
+		metadata, err := json.Marshal(map[string]interface{}{
+			"batch_id":              to.ID,
+			"batch_number":          to.BatchNumber,
+			"previous_batch_id":     from.ID,
+			"previous_batch_number": from.BatchNumber,
+			"order_sequence":        item.Sequence,
+			"operation":             operation,
+			"changed_by_id":         userID,
+		})
+		if err != nil {
+			return err
+		}
+		metadataStr := string(metadata)
+		events = append(events, order.OrderEvent{
+			OrderID:  item.OrderID,
+			Status:   order.OrderBatched,
+			Message:  fmt.Sprintf("Order %d moved from %s to %s (%s)", item.Sequence, from.BatchNumber, to.BatchNumber, operation),
+			Metadata: &metadataStr,
+		})
+	}
+	if err := tx.CreateInBatches(&events, 500).Error; err != nil {
+		return fmt.Errorf("failed to record batched events for %s: %w", to.BatchNumber, err)
+	}
+	return nil
+}
+
+// refreshBatch recomputes the sequence range and order count of a batch from
+// its live items
+func refreshBatch(tx *gorm.DB, batch *order.OrderBatch) error {
+	var stats struct {
+		StartSequence int
+		EndSequence   int
+		TotalOrders   int
+	}
+	if err := tx.Table("order_batch_items").
+		Select("COALESCE(MIN(orders.sequence), 0) AS start_sequence, COALESCE(MAX(orders.sequence), 0) AS end_sequence, COUNT(*) AS total_orders").
+		Joins("JOIN orders ON orders.id = order_batch_items.order_id").
+		Where("order_batch_items.order_batch_id = ? AND order_batch_items.is_deleted = ?", batch.ID, false).
+		Scan(&stats).Error; err != nil {
+		return err
+	}
+	batch.StartSequence = stats.StartSequence
+	batch.EndSequence = stats.EndSequence
+	batch.TotalOrders = stats.TotalOrders
+	return tx.Model(batch).Updates(map[string]interface{}{
+		"start_sequence": stats.StartSequence,
+		"end_sequence":   stats.EndSequence,
+		"total_orders":   stats.TotalOrders,
+	}).Error
+}
+
+// batchNumberPrefix returns the prefix of a batch number, dropping its
+// running number, so split batches continue the same numbering
+func batchNumberPrefix(batchNumber string) string {
+	prefix := batchNumberSuffix.ReplaceAllString(batchNumber, "")
+	if prefix == "" {
+		prefix = RangeBatchPrefix
+	}
+	if len(prefix) > 40 {
+		prefix = prefix[:40]
+	}
+	return prefix
+}
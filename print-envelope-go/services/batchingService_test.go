@@ -0,0 +1,53 @@
+package services
+
+import "testing"
+
+func TestBatchPrefix(t *testing.T) {
+	tests := []struct {
+		group []string
+		want  string
+	}{
+		{[]string{"ঢাকা"}, "DHAKA"},
+		{[]string{"ঢাকা", "সিলেট"}, "DHAKA-SILET"},
+		{[]string{"Dhaka Sadar"}, "DHAKASADAR"},
+		{[]string{"১২৩"}, "123"},
+		// Values with no Latin spelling get a stable checksum instead
+		{[]string{"ગુજરાત"}, "XE320F3B7"},
+		{[]string{""}, "UNKNOWN"},
+		{[]string{"  "}, "UNKNOWN"},
+		// Each value is cut to 12 characters and the prefix to 40
+		{[]string{"Chattogram Metropolitan"}, "CHATTOGRAMME"},
+		{
+			[]string{"ABCDEFGHIJKLMN", "ABCDEFGHIJKLMN", "ABCDEFGHIJKLMN", "ABCDEFGHIJKLMN"},
+			"ABCDEFGHIJKL-ABCDEFGHIJKL-ABCDEFGHIJKL-A",
+		},
+	}
+	for _, tt := range tests {
+		if got := batchPrefix(tt.group); got != tt.want {
+			t.Errorf("batchPrefix(%q) = %q, want %q", tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBatchNumber(t *testing.T) {
+	tests := []struct {
+		prefix string
+		number int
+		want   string
+	}{
+		{"DHAKA", 1, "DHAKA-0001"},
+		{"DHAKA-SILET", 42, "DHAKA-SILET-0042"},
+		{"UNKNOWN", 9999, "UNKNOWN-9999"},
+		{"DHAKA", 12345, "DHAKA-12345"},
+	}
+	for _, tt := range tests {
+		got := formatBatchNumber(tt.prefix, tt.number)
+		if got != tt.want {
+			t.Errorf("formatBatchNumber(%q, %d) = %q, want %q", tt.prefix, tt.number, got, tt.want)
+		}
+		// Split and merge find the running number with batchNumberSuffix
+		if !batchNumberSuffix.MatchString(got) {
+			t.Errorf("batch number %q has no running number suffix", got)
+		}
+	}
+}
@@ -1,38 +1,54 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	logModel "printenvelope/models/log"
-	"printenvelope/models/order"
 
 	"github.com/IBM/sarama"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A message that cannot be processed because the database or another
+// dependency is failing is retried in place, waiting consumeRetryBaseDelay
+// at first and doubling up to consumeRetryMaxDelay, so later messages of the
+// partition are not applied ahead of it. After consumeRetryMaxAttempts it is
+// recorded as processing_failed and skipped, to be reprocessed by an admin.
+const (
+	consumeRetryBaseDelay   = time.Second
+	consumeRetryMaxDelay    = time.Minute
+	consumeRetryMaxAttempts = 10
 )
 
 type ConsumerService struct {
-	db                *gorm.DB
-	brokers           []string
-	topic             string
-	username          string
-	password          string
-	group             string
-	consumer          sarama.Consumer
-	partitionConsumer sarama.PartitionConsumer
-	orderCount        int
-	sigChan           chan os.Signal
-	doneChan          chan struct{}
+	db       *gorm.DB
+	brokers  []string
+	topic    string
+	username string
+	password string
+	group    string
+	dlqTopic string
+	ingest   *IngestService
+	client   sarama.ConsumerGroup
+	producer sarama.SyncProducer
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+	// Partitions are consumed concurrently, so the count is atomic
+	orderCount atomic.Int64
 }
 
-// NewConsumerService creates a new consumer service instance
-func NewConsumerService(db *gorm.DB, brokers []string, topic, username, password, group string) *ConsumerService {
+// NewConsumerService creates a new consumer service instance. Rejected
+// messages, and those given up on after repeated failures, are published to
+// dlqTopic unless it is empty.
+func NewConsumerService(db *gorm.DB, brokers []string, topic, username, password, group, dlqTopic string) *ConsumerService {
 	return &ConsumerService{
 		db:       db,
 		brokers:  brokers,
@@ -40,16 +56,28 @@ func NewConsumerService(db *gorm.DB, brokers []string, topic, username, password
 		username: username,
 		password: password,
 		group:    group,
-		sigChan:  make(chan os.Signal, 1),
-		doneChan: make(chan struct{}),
+		dlqTopic: dlqTopic,
+		ingest:   NewIngestService(db),
+		stopped:  make(chan struct{}),
 	}
 }
 
-// ConnectConsumer establishes a connection to Kafka
+// Name identifies the source in logs
+func (cs *ConsumerService) Name() string {
+	return SourceKafka
+}
+
+// ConnectConsumer establishes a connection to Kafka and joins the consumer group
 func (cs *ConsumerService) ConnectConsumer() error {
 	config := sarama.NewConfig()
 	config.Consumer.Return.Errors = true
 
+	// Start from the beginning of partitions the group has never committed on.
+	// Offsets are committed explicitly once an order has been stored.
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+
 	// Increase timeouts for OCI Streams
 	config.Net.DialTimeout = 30 * time.Second
 	config.Net.ReadTimeout = 30 * time.Second
@@ -79,11 +107,21 @@ func (cs *ConsumerService) ConnectConsumer() error {
 	// Enable verbose logging for debugging
 	sarama.Logger = log.New(os.Stdout, "[Sarama] ", log.LstdFlags)
 
-	consumer, err := sarama.NewConsumer(cs.brokers, config)
+	client, err := sarama.NewConsumerGroup(cs.brokers, cs.group, config)
 	if err != nil {
-		return fmt.Errorf("failed to connect to consumer: %w", err)
+		return fmt.Errorf("failed to connect to consumer group: %w", err)
+	}
+	cs.client = client
+
+	if cs.dlqTopic != "" {
+		config.Producer.Return.Successes = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		producer, err := sarama.NewSyncProducer(cs.brokers, config)
+		if err != nil {
+			return fmt.Errorf("failed to connect dead-letter producer: %w", err)
+		}
+		cs.producer = producer
 	}
-	cs.consumer = consumer
 	return nil
 }
 
@@ -94,20 +132,13 @@ func (cs *ConsumerService) Start() error {
 		return err
 	}
 
-	// Start partition consumer
-	partitionConsumer, err := cs.consumer.ConsumePartition(cs.topic, 0, sarama.OffsetOldest)
-	if err != nil {
-		return fmt.Errorf("failed to start partition consumer: %w", err)
-	}
-	cs.partitionConsumer = partitionConsumer
-
-	fmt.Printf("Consumer started for topic '%s', waiting for messages...\n", cs.topic)
+	ctx, cancel := context.WithCancel(context.Background())
+	cs.cancel = cancel
 
-	// Setup signal handling
-	signal.Notify(cs.sigChan, syscall.SIGINT, syscall.SIGTERM)
+	fmt.Printf("Consumer group '%s' started for topic '%s', waiting for messages...\n", cs.group, cs.topic)
 
 	// Start consuming in a goroutine
-	go cs.consumeMessages()
+	go cs.consumeMessages(ctx)
 
 	return nil
 }
@@ -203,215 +234,287 @@ func cleanJSONMessage(data []byte) []byte {
 	return []byte(cleaned)
 }
 
-// consumeMessages handles the message consumption loop
-func (cs *ConsumerService) consumeMessages() {
-	for {
-		select {
-		case err := <-cs.partitionConsumer.Errors():
+// consumeMessages joins the group session loop. Consume returns whenever the
+// group rebalances, so it is called again until the service is shut down.
+func (cs *ConsumerService) consumeMessages(ctx context.Context) {
+	defer close(cs.stopped)
+
+	go func() {
+		for err := range cs.client.Errors() {
 			log.Printf("Error consuming messages: %s\n", err.Error())
-		case msg := <-cs.partitionConsumer.Messages():
-			cs.processMessage(msg)
-		case <-cs.sigChan:
-			fmt.Println("Termination signal received, shutting down consumer...")
-			cs.doneChan <- struct{}{}
+		}
+	}()
+
+	handler := &groupHandler{cs: cs}
+	for {
+		if err := cs.client.Consume(ctx, []string{cs.topic}, handler); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			log.Printf("Error in consumer group session: %s\n", err.Error())
+			// Avoid spinning while brokers are unreachable
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		if ctx.Err() != nil {
 			return
 		}
 	}
 }
 
-// OrderMessage represents the incoming message structure
-type OrderMessage struct {
-	Sequence         string                 `json:"sequence"`
-	Address          order.Address          `json:"address"`
-	ReturningAddress order.ReturningAddress `json:"returning_address"`
+// groupHandler implements sarama.ConsumerGroupHandler. A session owns a
+// set of claimed partitions; each claim is consumed in its own goroutine.
+type groupHandler struct {
+	cs *ConsumerService
 }
 
-// processMessage processes individual Kafka messages
-func (cs *ConsumerService) processMessage(msg *sarama.ConsumerMessage) {
-	fmt.Printf("Received message: %s\n", string(msg.Value))
-	cs.orderCount++
-
-	// Save raw message immediately to database
-	kafkaLog := logModel.KafkaMessageLog{
-		Topic:     msg.Topic,
-		Partition: msg.Partition,
-		Offset:    msg.Offset,
-		Key:       string(msg.Key),
-		Value:     string(msg.Value),
-		Timestamp: msg.Timestamp,
-		Status:    "received",
-	}
-
-	if err := cs.db.Create(&kafkaLog).Error; err != nil {
-		log.Printf("Error saving raw message to database: %s\n", err.Error())
-		// Continue processing even if log fails
-	}
-
-	// Clean the JSON message (remove literal newlines and fix trailing commas)
-	cleanedJSON := cleanJSONMessage(msg.Value)
-
-	// Parse the JSON message
-	var orderMsg OrderMessage
-	if err := json.Unmarshal(cleanedJSON, &orderMsg); err != nil {
-		log.Printf("Error unmarshaling message: %s\n", err.Error())
-		log.Printf("Cleaned JSON was: %s\n", string(cleanedJSON))
-		// Update kafka log with error
-		cs.db.Model(&kafkaLog).Updates(map[string]interface{}{
-			"status": "parse_failed",
-			"error":  err.Error(),
-		})
-		return
-	}
+// Setup is run at the beginning of a new session, after a rebalance. Claims
+// resume right after the offsets stored in the database, which are the
+// source of truth; Kafka's committed offsets may lag behind them.
+func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	log.Printf("Consumer group session started, claims: %v\n", session.Claims())
 
-	// Validate message structure: sequence must exist and not be empty
-	if orderMsg.Sequence == "" {
-		log.Printf("Invalid message structure: missing or empty sequence field\n")
-		cs.db.Model(&kafkaLog).Updates(map[string]interface{}{
-			"status": "invalid_structure",
-			"error":  "missing or empty sequence field",
-		})
-		return
+	var stored []logModel.KafkaConsumerOffset
+	if err := h.cs.db.Where("consumer_group = ? AND topic = ?", h.cs.group, h.cs.topic).Find(&stored).Error; err != nil {
+		return fmt.Errorf("failed to load stored offsets: %w", err)
 	}
-
-	// Parse sequence string to integer
-	sequenceInt, err := strconv.Atoi(orderMsg.Sequence)
-	if err != nil {
-		log.Printf("Invalid sequence format: %s (must be numeric)\n", orderMsg.Sequence)
-		cs.db.Model(&kafkaLog).Updates(map[string]interface{}{
-			"status": "invalid_sequence_format",
-			"error":  fmt.Sprintf("sequence must be numeric: %s", orderMsg.Sequence),
-		})
-		return
+	for _, o := range stored {
+		session.ResetOffset(o.Topic, o.Partition, o.Offset+1, "")
+		log.Printf("Resuming %s/%d from offset %d\n", o.Topic, o.Partition, o.Offset+1)
 	}
+	return nil
+}
 
-	// Validate PhoneNo is not empty
-	if orderMsg.Address.PhoneNo == "" {
-		log.Printf("Invalid message structure: missing or empty phone_no field\n")
-		cs.db.Model(&kafkaLog).Updates(map[string]interface{}{
-			"status": "invalid_structure",
-			"error":  "missing or empty phone_no field",
-		})
-		return
-	}
+// Cleanup is run at the end of a session, once all claims have exited
+func (h *groupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	session.Commit()
+	log.Printf("Consumer group session ended (generation %d)\n", session.GenerationID())
+	return nil
+}
 
-	// Note: Duplicate phone numbers, QR codes, and names are allowed
-	// Multiple orders can be sent to the same recipient
-
-	// Check if order with same sequence already exists
-	var existingOrder order.Order
-	if err := cs.db.Where("sequence = ?", sequenceInt).First(&existingOrder).Error; err == nil {
-		log.Printf("Order with sequence %d already exists (ID: %d), skipping\n", sequenceInt, existingOrder.ID)
-		cs.db.Model(&kafkaLog).Updates(map[string]interface{}{
-			"status":   "duplicate_sequence",
-			"error":    fmt.Sprintf("order with sequence %d already exists", sequenceInt),
-			"order_id": existingOrder.ID,
-		})
-		return
+// ConsumeClaim processes the messages of one partition in order. The offset
+// is marked and committed only once processMessage has durably recorded the
+// message's outcome, so an order whose transaction has not completed is
+// redelivered after a crash or rebalance.
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if err := h.processWithRetry(session, msg); err != nil {
+				// The session ended before the message was recorded. It is
+				// redelivered from the last stored offset by the next session.
+				log.Printf("Leaving message %s/%d@%d unprocessed: %s\n", msg.Topic, msg.Partition, msg.Offset, err.Error())
+				return nil
+			}
+			session.MarkMessage(msg, "")
+			session.Commit()
+		case <-session.Context().Done():
+			return nil
+		}
 	}
+}
 
-	var savedOrderID uint
-
-	// Save to database using a transaction
-	err = cs.db.Transaction(func(tx *gorm.DB) error {
-		// Check if returning address with same ZipCode exists, reuse if found
-		var returningAddress order.ReturningAddress
-		err := tx.Where("zip_code = ?", orderMsg.ReturningAddress.ZipCode).First(&returningAddress).Error
-		if err != nil {
-			// ReturningAddress doesn't exist, create new one
-			if err := tx.Create(&orderMsg.ReturningAddress).Error; err != nil {
-				return fmt.Errorf("failed to save returning address: %w", err)
+// processWithRetry runs processMessage until it succeeds or the session
+// ends, backing off between attempts. A message still failing after
+// consumeRetryMaxAttempts is given up on with recordFailure.
+func (h *groupHandler) processWithRetry(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error {
+	delay := consumeRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := h.cs.processMessage(msg)
+		if err == nil {
+			return nil
+		}
+		if attempt >= consumeRetryMaxAttempts {
+			failErr := h.cs.recordFailure(msg, err)
+			if failErr == nil {
+				return nil
 			}
-			returningAddress = orderMsg.ReturningAddress
-		} else {
-			// ReturningAddress exists, reuse it
-			log.Printf("Reusing existing returning address with zip_code %s (ID: %d)\n", returningAddress.ZipCode, returningAddress.ID)
+			log.Printf("Error recording failed message %s/%d@%d: %s\n", msg.Topic, msg.Partition, msg.Offset, failErr.Error())
 		}
+		log.Printf("Error processing message %s/%d@%d (attempt %d), retrying in %s: %s\n", msg.Topic, msg.Partition, msg.Offset, attempt, delay, err.Error())
 
-		// Save the address (new address for each order)
-		if err := tx.Create(&orderMsg.Address).Error; err != nil {
-			return fmt.Errorf("failed to save address: %w", err)
+		select {
+		case <-session.Context().Done():
+			return err
+		case <-time.After(delay):
 		}
-
-		// Create the order with foreign keys
-		newOrder := order.Order{
-			Sequence:           sequenceInt,
-			AddressID:          orderMsg.Address.ID,
-			ReturningAddressID: returningAddress.ID,
+		if delay *= 2; delay > consumeRetryMaxDelay {
+			delay = consumeRetryMaxDelay
 		}
+	}
+}
 
-		if err := tx.Create(&newOrder).Error; err != nil {
-			return fmt.Errorf("failed to save order: %w", err)
+// recordFailure gives up on a message that kept failing: it is logged as
+// processing_failed with the last error and its offset is stored, so the
+// partition moves on. The message can then be edited and reprocessed from
+// the message log, and is published to the dead-letter topic if configured.
+func (cs *ConsumerService) recordFailure(msg *sarama.ConsumerMessage, cause error) error {
+	result := IngestResult{
+		Status: logModel.KafkaStatusProcessingFailed,
+		Error:  cause.Error(),
+	}
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		var kafkaLog logModel.KafkaMessageLog
+		err := tx.Where("source = ? AND topic = ? AND partition = ? AND \"offset\" = ?", cs.Name(), msg.Topic, msg.Partition, msg.Offset).
+			FirstOrCreate(&kafkaLog, logModel.KafkaMessageLog{
+				Source:    cs.Name(),
+				Topic:     msg.Topic,
+				Partition: msg.Partition,
+				Offset:    msg.Offset,
+				Key:       string(msg.Key),
+				Value:     string(msg.Value),
+				Timestamp: msg.Timestamp,
+			}).Error
+		if err != nil {
+			return err
 		}
+		if err := tx.Model(&kafkaLog).Updates(map[string]interface{}{
+			"status": result.Status,
+			"error":  result.Error,
+		}).Error; err != nil {
+			return err
+		}
+		return saveOffset(tx, cs.group, msg)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Giving up on message %s/%d@%d after %d attempts: %s\n", msg.Topic, msg.Partition, msg.Offset, consumeRetryMaxAttempts, result.Error)
 
-		savedOrderID = newOrder.ID
+	cs.publishDeadLetter(msg, result)
+	return nil
+}
 
-		// Update kafka log with order ID
-		tx.Model(&kafkaLog).Update("order_id", newOrder.ID)
+// processMessage records a Kafka message and runs it through the ingestion
+// pipeline. Its offset is stored in the same transaction as the outcome. An
+// error means the outcome could not be recorded and the message must be
+// processed again.
+func (cs *ConsumerService) processMessage(msg *sarama.ConsumerMessage) error {
+	applied, err := cs.isApplied(msg)
+	if err != nil {
+		return fmt.Errorf("failed to check stored offset: %w", err)
+	}
+	if applied {
+		log.Printf("Message %s/%d@%d already applied, skipping\n", msg.Topic, msg.Partition, msg.Offset)
+		return nil
+	}
 
-		// Log OrderReceived event
-		receivedEvent := order.OrderEvent{
-			OrderID: newOrder.ID,
-			Status:  order.OrderReceived,
-			Message: fmt.Sprintf("Order received from Kafka (Sequence: %s)", orderMsg.Sequence),
-		}
-		if err := tx.Create(&receivedEvent).Error; err != nil {
-			return fmt.Errorf("failed to save OrderReceived event: %w", err)
-		}
+	fmt.Printf("Received message: %s\n", string(msg.Value))
 
-		// Log OrderSaved event
-		savedEvent := order.OrderEvent{
-			OrderID: newOrder.ID,
-			Status:  order.OrderSaved,
-			Message: fmt.Sprintf("Order saved successfully to database (Sequence: %s)", orderMsg.Sequence),
-		}
-		if err := tx.Create(&savedEvent).Error; err != nil {
-			return fmt.Errorf("failed to save OrderSaved event: %w", err)
-		}
+	// Save raw message immediately to database. A message redelivered before
+	// its offset was stored reuses the row written on the first attempt.
+	var kafkaLog logModel.KafkaMessageLog
+	err = cs.db.Where("source = ? AND topic = ? AND partition = ? AND \"offset\" = ?", cs.Name(), msg.Topic, msg.Partition, msg.Offset).
+		FirstOrCreate(&kafkaLog, logModel.KafkaMessageLog{
+			Source:    cs.Name(),
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Key:       string(msg.Key),
+			Value:     string(msg.Value),
+			Timestamp: msg.Timestamp,
+			Status:    logModel.KafkaStatusReceived,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to save raw message: %w", err)
+	}
 
-		return nil
+	result, err := cs.ingest.Ingest(&kafkaLog, msg.Value, "Kafka", func(tx *gorm.DB) error {
+		return saveOffset(tx, cs.group, msg)
 	})
-
 	if err != nil {
-		log.Printf("Error saving to database: %s\n", err.Error())
-
-		// Update kafka log with error
-		cs.db.Model(&kafkaLog).Updates(map[string]interface{}{
-			"status": "processing_failed",
-			"error":  err.Error(),
-		})
-
-		// Try to log failure event (outside transaction)
-		if savedOrderID > 0 {
-			failEvent := order.OrderEvent{
-				OrderID: savedOrderID,
-				Status:  order.OrderSaveFailed,
-				Message: fmt.Sprintf("Failed to save order: %s", err.Error()),
-			}
-			cs.db.Create(&failEvent)
-		}
+		return err
+	}
+	cs.orderCount.Add(1)
+
+	if logModel.IsRejectedKafkaStatus(result.Status) {
+		cs.publishDeadLetter(msg, result)
+	}
+	return nil
+}
+
+// publishDeadLetter forwards a rejected or failed message to the dead-letter
+// topic, when one is configured, with the reason in its headers
+func (cs *ConsumerService) publishDeadLetter(msg *sarama.ConsumerMessage, result IngestResult) {
+	if cs.producer == nil {
+		return
+	}
+
+	dlqMsg := &sarama.ProducerMessage{
+		Topic: cs.dlqTopic,
+		Value: sarama.ByteEncoder(msg.Value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("dlq_status"), Value: []byte(result.Status)},
+			{Key: []byte("dlq_error"), Value: []byte(result.Error)},
+			{Key: []byte("source_topic"), Value: []byte(msg.Topic)},
+			{Key: []byte("source_partition"), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+			{Key: []byte("source_offset"), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		},
+	}
+	if msg.Key != nil {
+		dlqMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+
+	if _, _, err := cs.producer.SendMessage(dlqMsg); err != nil {
+		log.Printf("Error publishing message %s/%d@%d to dead-letter topic: %s\n", msg.Topic, msg.Partition, msg.Offset, err.Error())
 		return
 	}
+	log.Printf("Message %s/%d@%d (%s) published to dead-letter topic %s\n", msg.Topic, msg.Partition, msg.Offset, result.Status, cs.dlqTopic)
+}
 
-	// Update kafka log status to processed
-	cs.db.Model(&kafkaLog).Update("status", "processed")
-	fmt.Printf("Order (Sequence: %s) processed and saved successfully.\n", orderMsg.Sequence)
+// isApplied reports whether msg is at or before the stored offset of its
+// partition
+func (cs *ConsumerService) isApplied(msg *sarama.ConsumerMessage) (bool, error) {
+	var stored logModel.KafkaConsumerOffset
+	err := cs.db.Where("consumer_group = ? AND topic = ? AND partition = ?", cs.group, msg.Topic, msg.Partition).
+		Limit(1).Find(&stored).Error
+	if err != nil {
+		return false, err
+	}
+	return stored.ID != 0 && msg.Offset <= stored.Offset, nil
 }
-func (cs *ConsumerService) Wait() {
-	<-cs.doneChan
-	fmt.Println("Total Ballot Orders Processed:", cs.orderCount)
+
+// saveOffset stores msg as the last applied offset of its partition
+func saveOffset(tx *gorm.DB, group string, msg *sarama.ConsumerMessage) error {
+	offset := logModel.KafkaConsumerOffset{
+		ConsumerGroup: group,
+		Topic:         msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "consumer_group"}, {Name: "topic"}, {Name: "partition"}},
+		DoUpdates: clause.AssignmentColumns([]string{"offset", "updated_at"}),
+	}).Create(&offset).Error
+	if err != nil {
+		return fmt.Errorf("failed to save consumer offset: %w", err)
+	}
+	return nil
 }
 
-// Shutdown gracefully shuts down the consumer service
+// Shutdown gracefully shuts down the consumer service, letting the current
+// message finish and committing its offset before leaving the group
 func (cs *ConsumerService) Shutdown() error {
-	if cs.partitionConsumer != nil {
-		if err := cs.partitionConsumer.Close(); err != nil {
-			log.Printf("Error closing partition consumer: %s\n", err.Error())
+	if cs.cancel != nil {
+		cs.cancel()
+		<-cs.stopped
+		fmt.Println("Total Ballot Orders Processed:", cs.orderCount.Load())
+	}
+
+	if cs.producer != nil {
+		if err := cs.producer.Close(); err != nil {
+			log.Printf("Error closing dead-letter producer: %s\n", err.Error())
 		}
 	}
 
-	if cs.consumer != nil {
-		if err := cs.consumer.Close(); err != nil {
-			return fmt.Errorf("error closing consumer: %w", err)
+	if cs.client != nil {
+		if err := cs.client.Close(); err != nil {
+			return fmt.Errorf("error closing consumer group: %w", err)
 		}
 	}
 
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DirectorySource imports JSON and CSV order files dropped into a directory.
+// The directory is polled; each file is imported once and then moved to the
+// processed/ or failed/ subdirectory next to it. A file is only picked up
+// once its size and modification time are unchanged between two polls, so
+// files still being copied in are left alone. Dot files and .tmp files are
+// ignored, letting writers copy under a temporary name and rename.
+type DirectorySource struct {
+	dir      string
+	interval time.Duration
+	ingest   *IngestService
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	// pending holds the files seen on the last poll that were not yet
+	// stable. Only the poll goroutine uses it.
+	pending map[string]fileState
+}
+
+// fileState is what a poll saw of a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewDirectorySource creates a drop directory source polling dir every interval
+func NewDirectorySource(db *gorm.DB, dir string, interval time.Duration) *DirectorySource {
+	return &DirectorySource{
+		dir:      dir,
+		interval: interval,
+		ingest:   NewIngestService(db),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		pending:  make(map[string]fileState),
+	}
+}
+
+// Name identifies the source in logs
+func (ds *DirectorySource) Name() string {
+	return SourceDirectory
+}
+
+// Start creates the directory layout and begins polling
+func (ds *DirectorySource) Start() error {
+	for _, dir := range []string{ds.dir, filepath.Join(ds.dir, "processed"), filepath.Join(ds.dir, "failed")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create drop directory %s: %w", dir, err)
+		}
+	}
+
+	fmt.Printf("Watching drop directory '%s' for order files...\n", ds.dir)
+	go ds.poll()
+	return nil
+}
+
+// Shutdown stops polling once the file in progress has been imported
+func (ds *DirectorySource) Shutdown() error {
+	close(ds.stop)
+	<-ds.stopped
+	return nil
+}
+
+func (ds *DirectorySource) poll() {
+	defer close(ds.stopped)
+
+	ticker := time.NewTicker(ds.interval)
+	defer ticker.Stop()
+	for {
+		ds.scan()
+		select {
+		case <-ds.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan imports the files in the directory that have stopped changing,
+// oldest name first
+func (ds *DirectorySource) scan() {
+	entries, err := os.ReadDir(ds.dir)
+	if err != nil {
+		log.Printf("Error reading drop directory: %s\n", err.Error())
+		return
+	}
+
+	var names []string
+	seen := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if entry.IsDir() || strings.HasPrefix(name, ".") || (ext != ".json" && ext != ".csv") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Moved or deleted since the directory was read
+			continue
+		}
+
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if previous, ok := ds.pending[name]; ok && previous.size == state.size && previous.modTime.Equal(state.modTime) {
+			names = append(names, name)
+			continue
+		}
+		seen[name] = state
+	}
+	ds.pending = seen
+	sort.Strings(names)
+
+	for _, name := range names {
+		select {
+		case <-ds.stop:
+			return
+		default:
+		}
+		ds.importFile(name)
+	}
+}
+
+func (ds *DirectorySource) importFile(name string) {
+	path := filepath.Join(ds.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading order file %s: %s\n", name, err.Error())
+		return
+	}
+
+	target := "processed"
+	summary, err := ds.ingest.ImportFile(ds.Name(), name, data)
+	if err != nil {
+		log.Printf("Error importing order file %s: %s\n", name, err.Error())
+		target = "failed"
+	} else {
+		log.Printf("Imported order file %s: %d message(s), %d skipped, statuses %v\n", name, summary.Total, summary.Skipped, summary.Statuses)
+	}
+
+	// Prefix with a timestamp so a file dropped again under the same name
+	// does not overwrite the earlier copy
+	dest := filepath.Join(ds.dir, target, time.Now().Format("20060102-150405")+"-"+name)
+	if err := os.Rename(path, dest); err != nil {
+		log.Printf("Error moving order file %s to %s: %s\n", name, target, err.Error())
+	}
+}
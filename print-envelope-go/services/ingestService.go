@@ -0,0 +1,562 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	logModel "printenvelope/models/log"
+	"printenvelope/models/order"
+	"printenvelope/models/print"
+
+	"gorm.io/gorm"
+)
+
+// Message envelope operations. Messages without an op are creates, which is
+// what upstream sent before the envelope was versioned.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpCancel = "cancel"
+)
+
+// MessageVersion is the newest envelope version this consumer understands.
+// Version 1 messages carry no op and always create an order.
+const MessageVersion = 2
+
+// OrderMessage represents the incoming message structure
+type OrderMessage struct {
+	Version          int                    `json:"version"`
+	Op               string                 `json:"op"`
+	Reason           string                 `json:"reason"` // Why an order is cancelled
+	Sequence         string                 `json:"sequence"`
+	Address          order.Address          `json:"address"`
+	ReturningAddress order.ReturningAddress `json:"returning_address"`
+}
+
+// IngestResult is the outcome of running a message through the pipeline
+type IngestResult struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	OrderID uint   `json:"order_id,omitempty"`
+	Op      string `json:"op,omitempty"`
+	// Flagged is set when a change was applied to an order that is already
+	// batched, so the batch owner should review it before printing
+	Flagged bool `json:"flagged,omitempty"`
+}
+
+// IngestService turns raw order messages into Orders. The Kafka consumer and
+// the admin reprocessing endpoints share it so a message is validated the
+// same way however it arrives.
+type IngestService struct {
+	db *gorm.DB
+}
+
+// NewIngestService creates a new ingestion service instance
+func NewIngestService(db *gorm.DB) *IngestService {
+	return &IngestService{db: db}
+}
+
+// Ingest validates value, applies its operation and records the outcome on
+// kafkaLog. source names where the message came from in the order events.
+// finish, when set, runs inside the transaction that records the outcome
+// when the message was accepted or rejected for good. A message that could
+// not be processed, or whose outcome could not be recorded, returns an error
+// without running finish so the caller can retry it.
+func (is *IngestService) Ingest(kafkaLog *logModel.KafkaMessageLog, value []byte, source string, finish func(tx *gorm.DB) error) (IngestResult, error) {
+	// Clean the JSON message (remove literal newlines and fix trailing commas)
+	cleanedJSON := cleanJSONMessage(value)
+
+	// Parse the JSON message
+	var orderMsg OrderMessage
+	if err := json.Unmarshal(cleanedJSON, &orderMsg); err != nil {
+		log.Printf("Error unmarshaling message: %s\n", err.Error())
+		log.Printf("Cleaned JSON was: %s\n", string(cleanedJSON))
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusParseFailed,
+			Error:  err.Error(),
+		}, nil)
+	}
+
+	if orderMsg.Version == 0 {
+		orderMsg.Version = 1
+	}
+	if orderMsg.Op == "" {
+		orderMsg.Op = OpCreate
+	}
+	if orderMsg.Version > MessageVersion {
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusUnsupportedVersion,
+			Error:  fmt.Sprintf("message version %d is newer than supported version %d", orderMsg.Version, MessageVersion),
+			Op:     orderMsg.Op,
+		}, nil)
+	}
+	if orderMsg.Version == 1 && orderMsg.Op != OpCreate {
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusUnsupportedOp,
+			Error:  fmt.Sprintf("op %q requires message version %d", orderMsg.Op, MessageVersion),
+			Op:     orderMsg.Op,
+		}, nil)
+	}
+
+	// Validate message structure: sequence must exist and not be empty
+	if orderMsg.Sequence == "" {
+		log.Printf("Invalid message structure: missing or empty sequence field\n")
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusInvalidStructure,
+			Error:  "missing or empty sequence field",
+			Op:     orderMsg.Op,
+		}, nil)
+	}
+
+	// Parse sequence string to integer
+	sequenceInt, err := strconv.Atoi(orderMsg.Sequence)
+	if err != nil {
+		log.Printf("Invalid sequence format: %s (must be numeric)\n", orderMsg.Sequence)
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusInvalidSequenceFormat,
+			Error:  fmt.Sprintf("sequence must be numeric: %s", orderMsg.Sequence),
+			Op:     orderMsg.Op,
+		}, nil)
+	}
+
+	switch orderMsg.Op {
+	case OpCreate:
+		return is.create(kafkaLog, orderMsg, sequenceInt, source, finish)
+	case OpUpdate, OpCancel:
+		return is.amend(kafkaLog, orderMsg, sequenceInt, source, finish)
+	default:
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusUnsupportedOp,
+			Error:  fmt.Sprintf("unsupported op %q", orderMsg.Op),
+			Op:     orderMsg.Op,
+		}, nil)
+	}
+}
+
+// create saves a new order with its addresses
+func (is *IngestService) create(kafkaLog *logModel.KafkaMessageLog, orderMsg OrderMessage, sequenceInt int, source string, finish func(tx *gorm.DB) error) (IngestResult, error) {
+	// Validate PhoneNo is not empty
+	if orderMsg.Address.PhoneNo == "" {
+		log.Printf("Invalid message structure: missing or empty phone_no field\n")
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusInvalidStructure,
+			Error:  "missing or empty phone_no field",
+			Op:     OpCreate,
+		}, nil)
+	}
+
+	// Note: Duplicate phone numbers, QR codes, and names are allowed
+	// Multiple orders can be sent to the same recipient
+
+	// Check if order with same sequence already exists
+	var existingOrder order.Order
+	lookupErr := is.db.Where("sequence = ?", sequenceInt).First(&existingOrder).Error
+	if lookupErr != nil && !errors.Is(lookupErr, gorm.ErrRecordNotFound) {
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusProcessingFailed,
+			Error:  fmt.Sprintf("failed to check for existing sequence %d: %s", sequenceInt, lookupErr.Error()),
+			Op:     OpCreate,
+		}, nil)
+	}
+	if lookupErr == nil {
+		log.Printf("Order with sequence %d already exists (ID: %d), skipping\n", sequenceInt, existingOrder.ID)
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status:  logModel.KafkaStatusDuplicateSequence,
+			Error:   fmt.Sprintf("order with sequence %d already exists", sequenceInt),
+			OrderID: existingOrder.ID,
+			Op:      OpCreate,
+		}, nil)
+	}
+
+	var savedOrderID uint
+
+	// Save to database using a transaction
+	err := is.db.Transaction(func(tx *gorm.DB) error {
+		returningAddress, err := resolveReturningAddress(tx, orderMsg.ReturningAddress)
+		if err != nil {
+			return err
+		}
+
+		// Save the address (new address for each order)
+		if err := tx.Create(&orderMsg.Address).Error; err != nil {
+			return fmt.Errorf("failed to save address: %w", err)
+		}
+
+		// Create the order with foreign keys
+		newOrder := order.Order{
+			Sequence:           sequenceInt,
+			AddressID:          orderMsg.Address.ID,
+			ReturningAddressID: returningAddress.ID,
+		}
+
+		if err := tx.Create(&newOrder).Error; err != nil {
+			return fmt.Errorf("failed to save order: %w", err)
+		}
+
+		savedOrderID = newOrder.ID
+
+		// Log OrderReceived event
+		receivedEvent := order.OrderEvent{
+			OrderID: newOrder.ID,
+			Status:  order.OrderReceived,
+			Message: fmt.Sprintf("Order received from %s (Sequence: %s)", source, orderMsg.Sequence),
+		}
+		if err := tx.Create(&receivedEvent).Error; err != nil {
+			return fmt.Errorf("failed to save OrderReceived event: %w", err)
+		}
+
+		// Log OrderSaved event
+		savedEvent := order.OrderEvent{
+			OrderID: newOrder.ID,
+			Status:  order.OrderSaved,
+			Message: fmt.Sprintf("Order saved successfully to database (Sequence: %s)", orderMsg.Sequence),
+		}
+		if err := tx.Create(&savedEvent).Error; err != nil {
+			return fmt.Errorf("failed to save OrderSaved event: %w", err)
+		}
+
+		return markProcessed(tx, kafkaLog, newOrder.ID, finish)
+	})
+
+	if err != nil {
+		log.Printf("Error saving to database: %s\n", err.Error())
+
+		// Try to log failure event (outside transaction)
+		if savedOrderID > 0 {
+			failEvent := order.OrderEvent{
+				OrderID: savedOrderID,
+				Status:  order.OrderSaveFailed,
+				Message: fmt.Sprintf("Failed to save order: %s", err.Error()),
+			}
+			is.db.Create(&failEvent)
+		}
+
+		// Update kafka log with error
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusProcessingFailed,
+			Error:  err.Error(),
+			Op:     OpCreate,
+		}, nil)
+	}
+
+	fmt.Printf("Order (Sequence: %s) processed and saved successfully.\n", orderMsg.Sequence)
+	return IngestResult{Status: logModel.KafkaStatusProcessed, OrderID: savedOrderID, Op: OpCreate}, nil
+}
+
+// amend applies an update or cancel to an existing order. Orders that have
+// gone to print are refused, since their envelope data is already fixed;
+// changes to batched but unprinted orders are applied and flagged.
+func (is *IngestService) amend(kafkaLog *logModel.KafkaMessageLog, orderMsg OrderMessage, sequenceInt int, source string, finish func(tx *gorm.DB) error) (IngestResult, error) {
+	op := orderMsg.Op
+	rejectedStatus := order.OrderUpdateRejected
+	if op == OpCancel {
+		rejectedStatus = order.OrderCancelRejected
+	}
+
+	var existingOrder order.Order
+	if err := is.db.Preload("Address").Where("sequence = ? AND is_deleted = ?", sequenceInt, false).First(&existingOrder).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return is.reject(kafkaLog, finish, IngestResult{
+				Status: logModel.KafkaStatusProcessingFailed,
+				Error:  fmt.Sprintf("failed to look up order with sequence %d: %s", sequenceInt, err.Error()),
+				Op:     op,
+			}, nil)
+		}
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusOrderNotFound,
+			Error:  fmt.Sprintf("no order with sequence %d to %s", sequenceInt, op),
+			Op:     op,
+		}, nil)
+	}
+
+	if existingOrder.IsCancelled {
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status:  logModel.KafkaStatusOrderCancelled,
+			Error:   fmt.Sprintf("order with sequence %d is cancelled", sequenceInt),
+			OrderID: existingOrder.ID,
+			Op:      op,
+		}, &order.OrderEvent{
+			OrderID: existingOrder.ID,
+			Status:  rejectedStatus,
+			Message: fmt.Sprintf("%s from %s refused: order is cancelled", op, source),
+		})
+	}
+
+	printedJobs, err := is.activePrintJobs(existingOrder.ID)
+	if err != nil {
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusProcessingFailed,
+			Error:  err.Error(),
+			Op:     op,
+		}, nil)
+	}
+	if printedJobs > 0 {
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status:  logModel.KafkaStatusOrderLocked,
+			Error:   fmt.Sprintf("order with sequence %d has already been sent to print", sequenceInt),
+			OrderID: existingOrder.ID,
+			Op:      op,
+		}, &order.OrderEvent{
+			OrderID: existingOrder.ID,
+			Status:  rejectedStatus,
+			Message: fmt.Sprintf("%s from %s refused: order has already been sent to print", op, source),
+		})
+	}
+
+	batchNumber, err := is.activeBatchNumber(existingOrder.ID)
+	if err != nil {
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status: logModel.KafkaStatusProcessingFailed,
+			Error:  err.Error(),
+			Op:     op,
+		}, nil)
+	}
+
+	metadata := map[string]interface{}{
+		"op":      op,
+		"version": orderMsg.Version,
+	}
+	if kafkaLog.ID != 0 {
+		metadata["kafka_message_log_id"] = kafkaLog.ID
+	}
+	if batchNumber != "" {
+		metadata["flagged"] = true
+		metadata["batch_number"] = batchNumber
+	}
+
+	err = is.db.Transaction(func(tx *gorm.DB) error {
+		var event order.OrderEvent
+		if op == OpCancel {
+			now := time.Now()
+			if err := tx.Model(&existingOrder).Updates(map[string]interface{}{
+				"is_cancelled":  true,
+				"cancelled_at":  now,
+				"cancel_reason": orderMsg.Reason,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to cancel order: %w", err)
+			}
+			metadata["reason"] = orderMsg.Reason
+			event = order.OrderEvent{
+				OrderID: existingOrder.ID,
+				Status:  order.OrderCancelled,
+				Message: fmt.Sprintf("Order cancelled from %s (Sequence: %s)", source, orderMsg.Sequence),
+			}
+		} else {
+			changes, err := applyOrderUpdate(tx, &existingOrder, orderMsg)
+			if err != nil {
+				return err
+			}
+			metadata["changes"] = changes
+			event = order.OrderEvent{
+				OrderID: existingOrder.ID,
+				Status:  order.OrderUpdated,
+				Message: fmt.Sprintf("Order updated from %s (Sequence: %s, %d field(s) changed)", source, orderMsg.Sequence, len(changes)),
+			}
+		}
+
+		if batchNumber != "" {
+			event.Message += fmt.Sprintf("; order is already in batch %s", batchNumber)
+		}
+		metadataJSON, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event metadata: %w", err)
+		}
+		metadataStr := string(metadataJSON)
+		event.Metadata = &metadataStr
+		if err := tx.Create(&event).Error; err != nil {
+			return fmt.Errorf("failed to save %s event: %w", event.Status, err)
+		}
+
+		return markProcessed(tx, kafkaLog, existingOrder.ID, finish)
+	})
+	if err != nil {
+		log.Printf("Error applying %s to order %d: %s\n", op, sequenceInt, err.Error())
+		return is.reject(kafkaLog, finish, IngestResult{
+			Status:  logModel.KafkaStatusProcessingFailed,
+			Error:   err.Error(),
+			OrderID: existingOrder.ID,
+			Op:      op,
+		}, nil)
+	}
+
+	fmt.Printf("Order (Sequence: %s) %s applied successfully.\n", orderMsg.Sequence, op)
+	return IngestResult{
+		Status:  logModel.KafkaStatusProcessed,
+		OrderID: existingOrder.ID,
+		Op:      op,
+		Flagged: batchNumber != "",
+	}, nil
+}
+
+// fieldChange is one changed field recorded in ORDER_UPDATED metadata
+type fieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// applyOrderUpdate overwrites the order's address fields that are present in
+// the message and switches its returning address when a different zip code
+// is given. Empty fields in the message leave the stored value untouched.
+func applyOrderUpdate(tx *gorm.DB, existingOrder *order.Order, orderMsg OrderMessage) (map[string]fieldChange, error) {
+	changes := make(map[string]fieldChange)
+	updates := make(map[string]interface{})
+
+	current := existingOrder.Address
+	incoming := orderMsg.Address
+	for _, f := range []struct {
+		column   string
+		old, new string
+	}{
+		{"recipient_fore_name", current.RecipientForeName, incoming.RecipientForeName},
+		{"recipient_other_name", current.RecipientOtherName, incoming.RecipientOtherName},
+		{"postal_address", current.PostalAddress, incoming.PostalAddress},
+		{"zip_code", current.ZipCode, incoming.ZipCode},
+		{"city", current.City, incoming.City},
+		{"phone_no", current.PhoneNo, incoming.PhoneNo},
+		{"qr_id", current.QrID, incoming.QrID},
+		{"country_code", current.CountryCode, incoming.CountryCode},
+	} {
+		if f.new != "" && f.new != f.old {
+			updates[f.column] = f.new
+			changes[f.column] = fieldChange{Old: f.old, New: f.new}
+		}
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(&order.Address{}).Where("id = ?", existingOrder.AddressID).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update address: %w", err)
+		}
+	}
+
+	if orderMsg.ReturningAddress.ZipCode != "" {
+		var currentReturning order.ReturningAddress
+		if err := tx.First(&currentReturning, existingOrder.ReturningAddressID).Error; err != nil {
+			return nil, fmt.Errorf("failed to load returning address: %w", err)
+		}
+		if currentReturning.ZipCode != orderMsg.ReturningAddress.ZipCode {
+			returningAddress, err := resolveReturningAddress(tx, orderMsg.ReturningAddress)
+			if err != nil {
+				return nil, err
+			}
+			if err := tx.Model(existingOrder).Update("returning_address_id", returningAddress.ID).Error; err != nil {
+				return nil, fmt.Errorf("failed to update returning address: %w", err)
+			}
+			changes["returning_zip_code"] = fieldChange{Old: currentReturning.ZipCode, New: returningAddress.ZipCode}
+		}
+	}
+
+	return changes, nil
+}
+
+// resolveReturningAddress reuses the returning address with the same zip
+// code, creating it when none exists
+func resolveReturningAddress(tx *gorm.DB, incoming order.ReturningAddress) (order.ReturningAddress, error) {
+	// Check if returning address with same ZipCode exists, reuse if found
+	var returningAddress order.ReturningAddress
+	err := tx.Where("zip_code = ?", incoming.ZipCode).First(&returningAddress).Error
+	if err != nil {
+		// ReturningAddress doesn't exist, create new one
+		if err := tx.Create(&incoming).Error; err != nil {
+			return order.ReturningAddress{}, fmt.Errorf("failed to save returning address: %w", err)
+		}
+		return incoming, nil
+	}
+
+	// ReturningAddress exists, reuse it
+	log.Printf("Reusing existing returning address with zip_code %s (ID: %d)\n", returningAddress.ZipCode, returningAddress.ID)
+	return returningAddress, nil
+}
+
+// activePrintJobs counts the print jobs of an order that have not failed or
+// been cancelled
+func (is *IngestService) activePrintJobs(orderID uint) (int64, error) {
+	var count int64
+	err := is.db.Model(&print.PrintSingleJob{}).
+		Where("order_id = ? AND is_deleted = ?", orderID, false).
+		Where("status NOT IN ?", []print.PrintJobStatus{print.PrintJobFailed, print.PrintJobCancelled}).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to check print jobs: %w", err)
+	}
+	return count, nil
+}
+
+// activeBatchNumber returns the number of the batch holding the order, or ""
+func (is *IngestService) activeBatchNumber(orderID uint) (string, error) {
+	var batchNumbers []string
+	err := is.db.Table("order_batch_items").
+		Select("order_batches.batch_number").
+		Joins("JOIN order_batches ON order_batches.id = order_batch_items.order_batch_id").
+		Where("order_batch_items.order_id = ?", orderID).
+		Where("order_batch_items.deleted_at IS NULL").
+		Where("order_batches.deleted_at IS NULL").
+		Limit(1).
+		Pluck("order_batches.batch_number", &batchNumbers).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to check order batches: %w", err)
+	}
+	if len(batchNumbers) == 0 {
+		return "", nil
+	}
+	return batchNumbers[0], nil
+}
+
+// markProcessed records the order on the kafka log and runs finish
+func markProcessed(tx *gorm.DB, kafkaLog *logModel.KafkaMessageLog, orderID uint, finish func(tx *gorm.DB) error) error {
+	if kafkaLog.ID != 0 {
+		if err := tx.Model(kafkaLog).Updates(map[string]interface{}{
+			"status":   logModel.KafkaStatusProcessed,
+			"error":    "",
+			"order_id": orderID,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update kafka message log: %w", err)
+		}
+	}
+
+	if finish != nil {
+		return finish(tx)
+	}
+	return nil
+}
+
+// reject records a message that was not applied. Terminal rejections run
+// finish in the same transaction; a processing failure only records its
+// status and is returned as an error, so the message is tried again. event,
+// when set, is stored on the affected order.
+func (is *IngestService) reject(kafkaLog *logModel.KafkaMessageLog, finish func(tx *gorm.DB) error, result IngestResult, event *order.OrderEvent) (IngestResult, error) {
+	terminal := logModel.IsRejectedKafkaStatus(result.Status)
+	err := is.db.Transaction(func(tx *gorm.DB) error {
+		if kafkaLog.ID != 0 {
+			updates := map[string]interface{}{
+				"status": result.Status,
+				"error":  result.Error,
+			}
+			if result.OrderID != 0 {
+				updates["order_id"] = result.OrderID
+			}
+			if err := tx.Model(kafkaLog).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if event != nil {
+			if err := tx.Create(event).Error; err != nil {
+				return err
+			}
+		}
+		if terminal && finish != nil {
+			return finish(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error recording message outcome: %s\n", err.Error())
+		return result, fmt.Errorf("failed to record %s outcome: %w", result.Status, err)
+	}
+	if !terminal {
+		return result, fmt.Errorf("%s: %s", result.Status, result.Error)
+	}
+	return result, nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	logModel "printenvelope/models/log"
+)
+
+// OrderSource delivers raw order messages into the ingestion pipeline. Every
+// source hands its messages to IngestService, so validation and Order
+// creation are the same whether orders arrive from Kafka, a drop directory
+// or the HTTP bulk import.
+type OrderSource interface {
+	// Name identifies the source in logs and on KafkaMessageLog.Source
+	Name() string
+	// Start begins delivering messages in the background
+	Start() error
+	// Shutdown stops the source after the message in progress is applied
+	Shutdown() error
+}
+
+// Order source names recorded on KafkaMessageLog.Source
+const (
+	SourceKafka     = "kafka"
+	SourceDirectory = "directory"
+	SourceHTTP      = "http"
+)
+
+// csvColumns maps CSV header names to their place in the message envelope.
+// Address columns are nested under "address"; returning_* columns under
+// "returning_address".
+var csvColumns = map[string][2]string{
+	"version":                   {"", "version"},
+	"op":                        {"", "op"},
+	"reason":                    {"", "reason"},
+	"sequence":                  {"", "sequence"},
+	"recipient_fore_name":       {"address", "recipient_fore_name"},
+	"recipient_other_name":      {"address", "recipient_other_name"},
+	"postal_address":            {"address", "postal_address"},
+	"zip_code":                  {"address", "zip_code"},
+	"city":                      {"address", "city"},
+	"phone_no":                  {"address", "phone_no"},
+	"qr_id":                     {"address", "qr_id"},
+	"country_code":              {"address", "country_code"},
+	"district_head_post_office": {"returning_address", "district_head_post_office"},
+	"returning_zip_code":        {"returning_address", "zip_code"},
+	"district":                  {"returning_address", "district"},
+}
+
+// ParseOrderFile splits a JSON or CSV order file into raw messages in the
+// same shape as a Kafka message value. JSON files hold a single message or
+// an array of messages; CSV files need a header row using csvColumns names.
+func ParseOrderFile(name string, data []byte) ([][]byte, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return parseJSONOrders(data)
+	case ".csv":
+		return parseCSVOrders(data)
+	default:
+		return nil, fmt.Errorf("unsupported file type %q, expected .json or .csv", filepath.Ext(name))
+	}
+}
+
+func parseJSONOrders(data []byte) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if trimmed[0] != '[' {
+		return [][]byte{trimmed}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(cleanJSONMessage(trimmed), &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %w", err)
+	}
+	messages := make([][]byte, len(items))
+	for i, item := range items {
+		messages[i] = item
+	}
+	return messages, nil
+}
+
+func parseCSVOrders(data []byte) ([][]byte, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if _, ok := csvColumns[header[i]]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+	}
+
+	var messages [][]byte
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row: %w", err)
+		}
+
+		msg := map[string]interface{}{}
+		address := map[string]string{}
+		returningAddress := map[string]string{}
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			target := csvColumns[header[i]]
+			switch target[0] {
+			case "address":
+				address[target[1]] = value
+			case "returning_address":
+				returningAddress[target[1]] = value
+			default:
+				if target[1] == "version" {
+					var version int
+					if value != "" {
+						if _, err := fmt.Sscan(value, &version); err != nil {
+							return nil, fmt.Errorf("invalid version %q on row %d", value, len(messages)+2)
+						}
+					}
+					msg["version"] = version
+					continue
+				}
+				msg[target[1]] = value
+			}
+		}
+		msg["address"] = address
+		msg["returning_address"] = returningAddress
+
+		encoded, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, encoded)
+	}
+	return messages, nil
+}
+
+// ImportSummary reports the outcome of an imported file
+type ImportSummary struct {
+	Import   string         `json:"import"`
+	Total    int            `json:"total"`
+	Skipped  int            `json:"skipped"` // Already applied by an earlier import of the same content
+	Statuses map[string]int `json:"statuses"`
+	Results  []IngestResult `json:"results"`
+}
+
+// ErrInvalidOrderFile is returned by ImportFile when the file itself cannot
+// be parsed, as opposed to a failure storing or ingesting its messages
+var ErrInvalidOrderFile = errors.New("invalid order file")
+
+// ImportFile parses a JSON or CSV file and ingests every message in order.
+// Messages are logged under the file name and a content hash, so importing
+// the same content again skips the messages already applied.
+func (is *IngestService) ImportFile(source, name string, data []byte) (*ImportSummary, error) {
+	messages, err := ParseOrderFile(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOrderFile, err)
+	}
+
+	hash := sha256.Sum256(data)
+	importName := fmt.Sprintf("%s@%s", filepath.Base(name), hex.EncodeToString(hash[:6]))
+	summary := &ImportSummary{
+		Import:   importName,
+		Total:    len(messages),
+		Statuses: make(map[string]int),
+		Results:  make([]IngestResult, 0, len(messages)),
+	}
+
+	label := fmt.Sprintf("%s import %s", source, filepath.Base(name))
+	for i, value := range messages {
+		var kafkaLog logModel.KafkaMessageLog
+		err := is.db.Where("source = ? AND topic = ? AND \"offset\" = ?", source, importName, i).
+			Attrs(logModel.KafkaMessageLog{
+				Value:     string(value),
+				Timestamp: time.Now(),
+				Status:    logModel.KafkaStatusReceived,
+			}).
+			FirstOrCreate(&kafkaLog, logModel.KafkaMessageLog{
+				Source: source,
+				Topic:  importName,
+				Offset: int64(i),
+			}).Error
+		if err != nil {
+			return summary, fmt.Errorf("failed to log message %d: %w", i, err)
+		}
+		// Messages that failed to process are retried by importing again
+		if kafkaLog.Status != logModel.KafkaStatusReceived && kafkaLog.Status != logModel.KafkaStatusProcessingFailed {
+			summary.Skipped++
+			continue
+		}
+
+		result, err := is.Ingest(&kafkaLog, value, label, nil)
+		if err != nil {
+			return summary, fmt.Errorf("failed to ingest message %d: %w", i, err)
+		}
+		summary.Statuses[result.Status]++
+		summary.Results = append(summary.Results, result)
+	}
+	return summary, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"strings"
+)
+
+// Bengali letters and the Latin spelling used for them in batch numbers.
+// Consonants carry an inherent "A" that a vowel sign replaces and a
+// hasanta removes; it is also dropped at the end of a word, as spoken.
+var (
+	banglaConsonants = map[rune]string{
+		'ক': "K", 'খ': "KH", 'গ': "G", 'ঘ': "GH", 'ঙ': "NG",
+		'চ': "CH", 'ছ': "CHH", 'জ': "J", 'ঝ': "JH", 'ঞ': "N",
+		'ট': "T", 'ঠ': "TH", 'ড': "D", 'ঢ': "DH", 'ণ': "N",
+		'ত': "T", 'থ': "TH", 'দ': "D", 'ধ': "DH", 'ন': "N",
+		'প': "P", 'ফ': "PH", 'ব': "B", 'ভ': "BH", 'ম': "M",
+		'য': "J", 'র': "R", 'ল': "L", 'শ': "SH", 'ষ': "SH",
+		'স': "S", 'হ': "H", '\u09dc': "R", '\u09dd': "RH", '\u09df': "Y",
+		'ৎ': "T",
+	}
+	banglaVowels = map[rune]string{
+		'অ': "A", 'আ': "A", 'ই': "I", 'ঈ': "I", 'উ': "U", 'ঊ': "U",
+		'ঋ': "RI", 'এ': "E", 'ঐ': "OI", 'ও': "O", 'ঔ': "OU",
+	}
+	banglaVowelSigns = map[rune]string{
+		'া': "A", 'ি': "I", 'ী': "I", 'ু': "U", 'ূ': "U",
+		'ৃ': "RI", 'ে': "E", 'ৈ': "OI", 'ো': "O", 'ৌ': "OU",
+	}
+	banglaSigns = map[rune]string{
+		'ং': "NG", 'ঃ': "H",
+	}
+
+	// Consonants written with a nukta, composed so they map like the rest
+	banglaNukta = strings.NewReplacer("\u09a1\u09bc", "\u09dc", "\u09a2\u09bc", "\u09dd", "\u09af\u09bc", "\u09df")
+)
+
+const (
+	banglaHasanta        = '্'
+	banglaChandrabindu   = 'ঁ'
+	banglaDigitZero      = '০'
+	banglaDigitNine      = '৯'
+	banglaCombiningVowel = 'ৗ' // au length mark, part of ৌ
+)
+
+// transliterateBangla spells Bengali text in upper case Latin letters, e.g.
+// ঢাকা as DHAKA and চট্টগ্রাম as CHATTAGRAM. Bengali digits become ASCII
+// digits; other characters are kept as they are.
+func transliterateBangla(s string) string {
+	var b strings.Builder
+	inherent := false
+	for _, r := range banglaNukta.Replace(s) {
+		switch {
+		case banglaConsonants[r] != "":
+			if inherent {
+				b.WriteString("A")
+			}
+			b.WriteString(banglaConsonants[r])
+			inherent = true
+		case banglaVowelSigns[r] != "":
+			b.WriteString(banglaVowelSigns[r])
+			inherent = false
+		case r == banglaHasanta:
+			inherent = false
+		case r == banglaChandrabindu || r == banglaCombiningVowel:
+		case banglaSigns[r] != "" || banglaVowels[r] != "":
+			if inherent {
+				b.WriteString("A")
+			}
+			b.WriteString(banglaSigns[r] + banglaVowels[r])
+			inherent = false
+		case r >= banglaDigitZero && r <= banglaDigitNine:
+			b.WriteRune('0' + (r - banglaDigitZero))
+			inherent = false
+		default:
+			// End of a word, where the inherent vowel is silent
+			b.WriteRune(r)
+			inherent = false
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestTransliterateBangla(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"ঢাকা", "DHAKA"},
+		{"চট্টগ্রাম", "CHATTAGRAM"},
+		{"কুমিল্লা", "KUMILLA"},
+		{"সিলেট", "SILET"},
+		{"বাংলাদেশ", "BANGLADESH"},
+		{"কক্সবাজার", "KAKSABAJAR"},
+		{"চাঁদপুর", "CHADAPUR"},
+		{"১২৩", "123"},
+		{"Dhaka", "Dhaka"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := transliterateBangla(tt.in); got != tt.want {
+			t.Errorf("transliterateBangla(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Consonants with a nukta may arrive decomposed, as the base letter followed
+// by the nukta sign
+func TestTransliterateBanglaNukta(t *testing.T) {
+	composed := transliterateBangla("পা\u09dcা")
+	decomposed := transliterateBangla("পা\u09a1\u09bcা")
+	if composed != "PARA" || decomposed != composed {
+		t.Errorf("transliterateBangla(পাড়া) = %q composed and %q decomposed, want %q", composed, decomposed, "PARA")
+	}
+}
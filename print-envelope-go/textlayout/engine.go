@@ -0,0 +1,351 @@
+package textlayout
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"github.com/signintech/gopdf"
+	"golang.org/x/image/math/fixed"
+)
+
+// Style selects the fonts and size used for a piece of text. Font draws
+// Latin and other simple scripts; ComplexFont, when set, is used to shape
+// Bangla runs. Both name families added with Engine.AddFont.
+type Style struct {
+	Font        string
+	ComplexFont string
+	Size        float64
+}
+
+// Engine shapes, wraps and draws mixed Bangla/English text on a gopdf
+// document. An Engine belongs to a single document and is not safe for
+// concurrent use.
+type Engine struct {
+	pdf    *gopdf.GoPdf
+	fonts  map[string]*engineFont
+	shaper shaping.HarfbuzzShaper
+}
+
+type engineFont struct {
+	data *fontData
+	face *font.Face // set only for fonts that can shape complex scripts
+}
+
+// New creates an Engine drawing on pdf
+func New(pdf *gopdf.GoPdf) *Engine {
+	return &Engine{pdf: pdf, fonts: make(map[string]*engineFont)}
+}
+
+// AddFont registers a TrueType font with both the engine and the document
+func (e *Engine) AddFont(family, path string) error {
+	data, err := loadFontData(path)
+	if err != nil {
+		return err
+	}
+
+	if err := e.pdf.AddTTFFontData(family, data.raw); err != nil {
+		return fmt.Errorf("failed to add font %s: %w", family, err)
+	}
+
+	f := &engineFont{data: data}
+	if data.glyphs != nil {
+		if err := e.pdf.AddTTFFontData(glyphFamily(family), data.glyphs); err != nil {
+			return fmt.Errorf("failed to add glyph font %s: %w", family, err)
+		}
+		// Faces keep internal caches, so every engine parses its own
+		face, err := font.ParseTTF(bytes.NewReader(data.raw))
+		if err != nil {
+			return fmt.Errorf("failed to parse font %s: %w", family, err)
+		}
+		f.face = face
+	}
+
+	e.fonts[family] = f
+	return nil
+}
+
+// glyphFamily names the PUA-mapped copy of a complex font inside the PDF
+func glyphFamily(family string) string {
+	return family + "-glyphs"
+}
+
+// run is a stretch of a word drawn with a single font
+type run struct {
+	text    string
+	complex bool
+	width   float64
+	glyphs  []shaping.Glyph
+}
+
+// word is a whitespace-delimited token split into script runs
+type word struct {
+	runs  []run
+	width float64
+}
+
+// Line is one wrapped line of text, ready to be drawn
+type Line struct {
+	words []word
+	space float64
+	style Style
+	Width float64
+}
+
+// Wrap breaks text into lines no wider than maxWidth. Lines break at
+// whitespace; a single word wider than maxWidth is split between grapheme
+// clusters so Bangla syllables are never torn apart.
+func (e *Engine) Wrap(text string, style Style, maxWidth float64) ([]Line, error) {
+	space, err := e.measurePlain(" ", style)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []Line
+	current := Line{space: space, style: style}
+	flush := func() {
+		if len(current.words) > 0 {
+			lines = append(lines, current)
+		}
+		current = Line{space: space, style: style}
+	}
+
+	for _, token := range strings.Fields(text) {
+		w, err := e.measureWord(token, style)
+		if err != nil {
+			return nil, err
+		}
+
+		pieces := []word{w}
+		if w.width > maxWidth {
+			if pieces, err = e.splitWord(token, style, maxWidth); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, piece := range pieces {
+			width := piece.width
+			if len(current.words) > 0 {
+				width += space
+			}
+			if len(current.words) > 0 && current.Width+width > maxWidth {
+				flush()
+				width = piece.width
+			}
+			current.words = append(current.words, piece)
+			current.Width += width
+		}
+	}
+	flush()
+
+	return lines, nil
+}
+
+// Measure returns the width of text drawn on a single line
+func (e *Engine) Measure(text string, style Style) (float64, error) {
+	lines, err := e.Wrap(text, style, 1e9)
+	if err != nil || len(lines) == 0 {
+		return 0, err
+	}
+	return lines[0].Width, nil
+}
+
+// DrawLine draws line with its top-left corner at x, top. The baseline sits
+// where a top-aligned gopdf cell in the style's main font would put it, so
+// shaped and plain text line up with the rest of the page.
+func (e *Engine) DrawLine(line Line, x, top float64) error {
+	main, ok := e.fonts[line.style.Font]
+	if !ok {
+		return fmt.Errorf("unknown font %s", line.style.Font)
+	}
+	baseline := top + main.data.typoAscender*line.style.Size/main.data.unitsPerEm
+
+	for i, w := range line.words {
+		if i > 0 {
+			x += line.space
+		}
+		for _, r := range w.runs {
+			if err := e.drawRun(r, line.style, x, baseline); err != nil {
+				return err
+			}
+			x += r.width
+		}
+	}
+	return nil
+}
+
+func (e *Engine) drawRun(r run, style Style, x, baseline float64) error {
+	if !r.complex {
+		if err := e.pdf.SetFont(style.Font, "", style.Size); err != nil {
+			return fmt.Errorf("failed to set font: %w", err)
+		}
+		e.pdf.SetXY(x, baseline)
+		return e.pdf.Text(r.text)
+	}
+
+	f := e.fonts[style.ComplexFont]
+	if err := e.pdf.SetFont(glyphFamily(style.ComplexFont), "", style.Size); err != nil {
+		return fmt.Errorf("failed to set font: %w", err)
+	}
+
+	// Glyphs are placed one by one so GPOS offsets for vowel signs and
+	// conjunct parts land where the shaper put them
+	pen := x
+	for _, g := range r.glyphs {
+		e.pdf.SetXY(pen+toPoints(g.XOffset), baseline-toPoints(g.YOffset))
+		if err := e.pdf.Text(string(f.data.puaBase + rune(g.GlyphID))); err != nil {
+			return err
+		}
+		pen += toPoints(g.Advance)
+	}
+	return nil
+}
+
+// measureWord splits token into script runs and measures each
+func (e *Engine) measureWord(token string, style Style) (word, error) {
+	var w word
+	for _, r := range e.splitRuns(token, style) {
+		var err error
+		if r.complex {
+			r.glyphs, r.width = e.shape(r.text, style)
+		} else {
+			r.width, err = e.measurePlain(r.text, style)
+		}
+		if err != nil {
+			return word{}, err
+		}
+		w.runs = append(w.runs, r)
+		w.width += r.width
+	}
+	return w, nil
+}
+
+// splitWord breaks an overlong token into pieces that each fit maxWidth,
+// cutting only between grapheme clusters
+func (e *Engine) splitWord(token string, style Style, maxWidth float64) ([]word, error) {
+	var pieces []word
+	piece := ""
+	for _, cluster := range e.clusters(token, style) {
+		candidate, err := e.measureWord(piece+cluster, style)
+		if err != nil {
+			return nil, err
+		}
+		if piece != "" && candidate.width > maxWidth {
+			w, err := e.measureWord(piece, style)
+			if err != nil {
+				return nil, err
+			}
+			pieces = append(pieces, w)
+			piece = cluster
+			continue
+		}
+		piece += cluster
+	}
+	if piece != "" {
+		w, err := e.measureWord(piece, style)
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, w)
+	}
+	return pieces, nil
+}
+
+// clusters returns the grapheme clusters of token: shaper clusters for
+// complex runs, single runes otherwise
+func (e *Engine) clusters(token string, style Style) []string {
+	var out []string
+	for _, r := range e.splitRuns(token, style) {
+		if !r.complex {
+			for _, ch := range r.text {
+				out = append(out, string(ch))
+			}
+			continue
+		}
+
+		runes := []rune(r.text)
+		glyphs, _ := e.shape(r.text, style)
+		start := -1
+		for _, g := range glyphs {
+			if g.ClusterIndex == start {
+				continue
+			}
+			start = g.ClusterIndex
+			end := start + g.RuneCount
+			if end > len(runes) {
+				end = len(runes)
+			}
+			out = append(out, string(runes[start:end]))
+		}
+	}
+	return out
+}
+
+// splitRuns groups consecutive runes by whether they need shaping
+func (e *Engine) splitRuns(token string, style Style) []run {
+	canShape := false
+	if f, ok := e.fonts[style.ComplexFont]; ok && f.face != nil {
+		canShape = true
+	}
+
+	var runs []run
+	var current strings.Builder
+	currentComplex := false
+	for _, ch := range token {
+		complex := canShape && isComplex(ch)
+		if current.Len() > 0 && complex != currentComplex {
+			runs = append(runs, run{text: current.String(), complex: currentComplex})
+			current.Reset()
+		}
+		current.WriteRune(ch)
+		currentComplex = complex
+	}
+	if current.Len() > 0 {
+		runs = append(runs, run{text: current.String(), complex: currentComplex})
+	}
+	return runs
+}
+
+func (e *Engine) measurePlain(text string, style Style) (float64, error) {
+	if err := e.pdf.SetFont(style.Font, "", style.Size); err != nil {
+		return 0, fmt.Errorf("failed to set font: %w", err)
+	}
+	return e.pdf.MeasureTextWidth(text)
+}
+
+// shape runs the HarfBuzz shaper over a Bangla run
+func (e *Engine) shape(text string, style Style) ([]shaping.Glyph, float64) {
+	runes := []rune(text)
+	out := e.shaper.Shape(shaping.Input{
+		Text:      runes,
+		RunStart:  0,
+		RunEnd:    len(runes),
+		Direction: di.DirectionLTR,
+		Face:      e.fonts[style.ComplexFont].face,
+		Size:      fixed.Int26_6(style.Size*64 + 0.5),
+		Script:    language.Bengali,
+		Language:  language.NewLanguage("bn"),
+	})
+	return out.Glyphs, toPoints(out.Advance)
+}
+
+// isComplex reports whether r belongs to a Bangla run
+func isComplex(r rune) bool {
+	switch {
+	case r >= 0x0980 && r <= 0x09FF: // Bengali block
+		return true
+	case r == 0x200C || r == 0x200D: // ZWNJ, ZWJ
+		return true
+	case r == 0x0964 || r == 0x0965: // danda, double danda
+		return true
+	}
+	return false
+}
+
+func toPoints(v fixed.Int26_6) float64 {
+	return float64(v) / 64.0
+}
@@ -0,0 +1,130 @@
+package textlayout
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/go-text/typesetting/font"
+)
+
+// Private Use Area used to address shaped glyphs through gopdf, which only
+// knows how to draw runes. Glyph N of a complex font is drawn as rune
+// puaStart+N (shifted further if the font already maps part of the range).
+const (
+	puaStart = 0xE000
+	puaEnd   = 0xF8FF
+)
+
+// fontData is the immutable, shareable part of a loaded font
+type fontData struct {
+	raw          []byte
+	glyphs       []byte // raw with the PUA glyph cmap added; nil for simple fonts
+	puaBase      rune
+	unitsPerEm   float64
+	typoAscender float64
+}
+
+var (
+	fontCacheMu sync.Mutex
+	fontCache   = map[string]*fontData{}
+)
+
+// loadFontData reads and prepares a font file once per process
+func loadFontData(path string) (*fontData, error) {
+	fontCacheMu.Lock()
+	defer fontCacheMu.Unlock()
+
+	if data, ok := fontCache[path]; ok {
+		return data, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font %s: %w", path, err)
+	}
+
+	sf, err := parseSfnt(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", path, err)
+	}
+
+	face, err := font.ParseTTF(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", path, err)
+	}
+
+	data := &fontData{
+		raw:          raw,
+		unitsPerEm:   float64(sf.unitsPerEm()),
+		typoAscender: float64(sf.typoAscender()),
+	}
+
+	// Only fonts covering a complex script need the glyph-addressable copy
+	if _, ok := face.NominalGlyph('ক'); ok {
+		glyphs, base, err := withGlyphCmap(sf, face)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare font %s for shaping: %w", path, err)
+		}
+		data.glyphs = glyphs
+		data.puaBase = base
+	}
+
+	fontCache[path] = data
+	return data, nil
+}
+
+// withGlyphCmap returns a copy of the font whose cmap keeps the original BMP
+// mappings and additionally maps a free PUA range one-to-one onto glyph IDs
+func withGlyphCmap(sf *sfnt, face *font.Face) ([]byte, rune, error) {
+	numGlyphs := sf.numGlyphs()
+
+	var mappings []cmapMapping
+	used := map[rune]bool{}
+	iter := face.Cmap.Iter()
+	for iter.Next() {
+		r, gid := iter.Char()
+		if r > 0xFFFF {
+			continue
+		}
+		mappings = append(mappings, cmapMapping{code: r, glyph: uint16(gid)})
+		used[r] = true
+	}
+
+	// Find a window in the PUA that the font does not already use
+	base := rune(-1)
+	for start := rune(puaStart); start+rune(numGlyphs)-1 <= puaEnd; start += 0x100 {
+		free := true
+		for r := start; r < start+rune(numGlyphs); r++ {
+			if used[r] {
+				free = false
+				break
+			}
+		}
+		if free {
+			base = start
+			break
+		}
+	}
+	if base < 0 {
+		return nil, 0, fmt.Errorf("no free private use range for %d glyphs", numGlyphs)
+	}
+
+	for gid := 0; gid < numGlyphs; gid++ {
+		mappings = append(mappings, cmapMapping{code: base + rune(gid), glyph: uint16(gid)})
+	}
+
+	cmap, err := buildCmapFormat4(mappings)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	patched := &sfnt{version: sf.version, tables: make(map[string][]byte, len(sf.tables))}
+	for tag, table := range sf.tables {
+		patched.tables[tag] = table
+	}
+	patched.tables["cmap"] = cmap
+
+	return patched.bytes(), base, nil
+}
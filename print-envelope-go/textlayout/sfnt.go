@@ -0,0 +1,207 @@
+package textlayout
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// sfnt is a minimal view of a TrueType file: its tables by tag. It is only
+// used to read a few metrics and to swap the cmap table, so nothing beyond
+// the table directory is interpreted.
+type sfnt struct {
+	version uint32
+	tables  map[string][]byte
+}
+
+func parseSfnt(data []byte) (*sfnt, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font file too short")
+	}
+
+	font := &sfnt{
+		version: binary.BigEndian.Uint32(data[0:4]),
+		tables:  make(map[string][]byte),
+	}
+	numTables := int(binary.BigEndian.Uint16(data[4:6]))
+	if len(data) < 12+numTables*16 {
+		return nil, fmt.Errorf("truncated table directory")
+	}
+
+	for i := 0; i < numTables; i++ {
+		record := data[12+i*16 : 12+(i+1)*16]
+		tag := string(record[0:4])
+		offset := binary.BigEndian.Uint32(record[8:12])
+		length := binary.BigEndian.Uint32(record[12:16])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("table %s out of bounds", tag)
+		}
+		font.tables[tag] = data[offset : offset+length]
+	}
+
+	for _, tag := range []string{"head", "maxp", "cmap"} {
+		if _, ok := font.tables[tag]; !ok {
+			return nil, fmt.Errorf("missing %s table", tag)
+		}
+	}
+
+	return font, nil
+}
+
+// unitsPerEm reads head.unitsPerEm
+func (f *sfnt) unitsPerEm() uint16 {
+	return binary.BigEndian.Uint16(f.tables["head"][18:20])
+}
+
+// numGlyphs reads maxp.numGlyphs
+func (f *sfnt) numGlyphs() int {
+	return int(binary.BigEndian.Uint16(f.tables["maxp"][4:6]))
+}
+
+// typoAscender reads OS/2.sTypoAscender, which gopdf uses to place the
+// baseline of a top-aligned cell. Falls back to hhea.ascender.
+func (f *sfnt) typoAscender() int16 {
+	if os2, ok := f.tables["OS/2"]; ok && len(os2) >= 70 {
+		return int16(binary.BigEndian.Uint16(os2[68:70]))
+	}
+	if hhea, ok := f.tables["hhea"]; ok && len(hhea) >= 6 {
+		return int16(binary.BigEndian.Uint16(hhea[4:6]))
+	}
+	return int16(f.unitsPerEm())
+}
+
+// bytes serializes the font with a fresh table directory and checksums
+func (f *sfnt) bytes() []byte {
+	tags := make([]string, 0, len(f.tables))
+	for tag := range f.tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	numTables := len(tags)
+	entrySelector := 0
+	for (1 << (entrySelector + 1)) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	header := make([]byte, 12+numTables*16)
+	binary.BigEndian.PutUint32(header[0:4], f.version)
+	binary.BigEndian.PutUint16(header[4:6], uint16(numTables))
+	binary.BigEndian.PutUint16(header[6:8], uint16(searchRange))
+	binary.BigEndian.PutUint16(header[8:10], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:12], uint16(numTables*16-searchRange))
+
+	out := header
+	headOffset := -1
+	for i, tag := range tags {
+		table := f.tables[tag]
+		if tag == "head" {
+			// checkSumAdjustment must be zero while checksums are computed
+			table = append([]byte(nil), table...)
+			binary.BigEndian.PutUint32(table[8:12], 0)
+			headOffset = len(out)
+		}
+
+		record := out[12+i*16 : 12+(i+1)*16]
+		copy(record[0:4], tag)
+		binary.BigEndian.PutUint32(record[4:8], checksum(table))
+		binary.BigEndian.PutUint32(record[8:12], uint32(len(out)))
+		binary.BigEndian.PutUint32(record[12:16], uint32(len(table)))
+
+		// record aliases out, so it must be filled before out grows
+		out = append(out, table...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:headOffset+12], 0xB1B0AFBA-checksum(out))
+	}
+
+	return out
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// cmapMapping is one rune to glyph assignment
+type cmapMapping struct {
+	code  rune
+	glyph uint16
+}
+
+// buildCmapFormat4 encodes BMP mappings as a (3,1) format 4 cmap table.
+// Consecutive codes with a constant glyph delta share one segment, so only
+// idDelta is used and the glyphIdArray stays empty.
+func buildCmapFormat4(mappings []cmapMapping) ([]byte, error) {
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].code < mappings[j].code })
+
+	type segment struct {
+		start, end uint16
+		delta      uint16
+	}
+	var segments []segment
+	for _, m := range mappings {
+		if m.code < 0 || m.code >= 0xFFFF {
+			continue
+		}
+		code := uint16(m.code)
+		delta := m.glyph - code
+		if n := len(segments); n > 0 && segments[n-1].end+1 == code && segments[n-1].delta == delta {
+			segments[n-1].end = code
+			continue
+		}
+		if n := len(segments); n > 0 && segments[n-1].end >= code {
+			continue // duplicate code, keep the first mapping
+		}
+		segments = append(segments, segment{start: code, end: code, delta: delta})
+	}
+	// Mandatory terminating segment
+	segments = append(segments, segment{start: 0xFFFF, end: 0xFFFF, delta: 1})
+
+	segCount := len(segments)
+	length := 16 + 8*segCount
+	if length > 0xFFFF {
+		return nil, fmt.Errorf("cmap needs %d segments, too many for format 4", segCount)
+	}
+
+	entrySelector := 0
+	for (1 << (entrySelector + 1)) <= segCount {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 2
+
+	sub := make([]byte, length)
+	binary.BigEndian.PutUint16(sub[0:2], 4)
+	binary.BigEndian.PutUint16(sub[2:4], uint16(length))
+	binary.BigEndian.PutUint16(sub[6:8], uint16(segCount*2))
+	binary.BigEndian.PutUint16(sub[8:10], uint16(searchRange))
+	binary.BigEndian.PutUint16(sub[10:12], uint16(entrySelector))
+	binary.BigEndian.PutUint16(sub[12:14], uint16(segCount*2-searchRange))
+
+	endCodes := 14
+	startCodes := endCodes + segCount*2 + 2 // skip reservedPad
+	idDeltas := startCodes + segCount*2
+	// idRangeOffsets follow and stay zero
+	for i, seg := range segments {
+		binary.BigEndian.PutUint16(sub[endCodes+i*2:], seg.end)
+		binary.BigEndian.PutUint16(sub[startCodes+i*2:], seg.start)
+		binary.BigEndian.PutUint16(sub[idDeltas+i*2:], seg.delta)
+	}
+
+	table := make([]byte, 12, 12+len(sub))
+	binary.BigEndian.PutUint16(table[2:4], 1)   // numTables
+	binary.BigEndian.PutUint16(table[4:6], 3)   // platform: Windows
+	binary.BigEndian.PutUint16(table[6:8], 1)   // encoding: Unicode BMP
+	binary.BigEndian.PutUint32(table[8:12], 12) // subtable offset
+	return append(table, sub...), nil
+}
@@ -61,15 +61,8 @@ type InternalJob struct {
 	InternalJobData InternalJobData `json:"job_data"`
 }
 
-type PrintJob struct {
-	PrinterID string  `json:"printer_id"`
-	JobID     string  `json:"job_id"`
-	JobToken  string  `json:"job_token"`
-	Command   string  `json:"command"`
-	Width     float64 `json:"width"`
-	Height    float64 `json:"height"`
-	Unit      string  `json:"unit"`
-	Barcode   string  `json:"barcode"`
-	Mashul    string  `json:"mashul"`
-	Weight    string  `json:"weight"`
+// EnvelopePDFRequest is posted by the print client to download a job's PDF
+type EnvelopePDFRequest struct {
+	JobID    string `json:"job_id"`
+	JobToken string `json:"job_token"`
 }
@@ -0,0 +1,7 @@
+package types
+
+// KafkaMessageUpdateRequest replaces the payload of a rejected Kafka message
+// before it is reprocessed
+type KafkaMessageUpdateRequest struct {
+	Value string `json:"value" validate:"required"`
+}
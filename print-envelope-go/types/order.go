@@ -5,3 +5,27 @@ type BatchOrderRequest struct {
 	StartSequence int `json:"start_sequence" validate:"required"`
 	EndSequence   int `json:"end_sequence" validate:"required"`
 }
+
+// AutoBatchRequest groups unbatched orders into batches by the group_by keys
+// (district, district_head_post_office, returning_zip_code, city). The
+// sequence range is optional; dry_run returns the plan without creating it.
+type AutoBatchRequest struct {
+	GroupBy       []string `json:"group_by"`
+	MaxBatchSize  int      `json:"max_batch_size"`
+	StartSequence int      `json:"start_sequence"`
+	EndSequence   int      `json:"end_sequence"`
+	DryRun        bool     `json:"dry_run"`
+}
+
+// BatchSplitRequest splits an unprinted batch either at a sequence, moving
+// that order and the ones after it to a new batch, or into batches of size
+// orders. Exactly one of the two is given.
+type BatchSplitRequest struct {
+	AtSequence int `json:"at_sequence"`
+	Size       int `json:"size"`
+}
+
+// BatchMergeRequest merges unprinted batches into the first of batch_ids
+type BatchMergeRequest struct {
+	BatchIDs []uint `json:"batch_ids" validate:"required"`
+}
@@ -0,0 +1,16 @@
+package types
+
+// PrinterUpdateRequest changes the admin-managed fields of a registered
+// printer. Fields left out are not changed; operator_id 0 clears the operator.
+type PrinterUpdateRequest struct {
+	Name        *string `json:"name"`
+	PrintCenter *string `json:"print_center"`
+	OperatorID  *uint   `json:"operator_id"`
+	Enabled     *bool   `json:"enabled"`
+}
+
+// EnrollmentReviewRequest approves, rejects or revokes a print client
+// enrollment. The note is kept as the review note or the revoke reason.
+type EnrollmentReviewRequest struct {
+	Note string `json:"note"`
+}
@@ -0,0 +1,17 @@
+package types
+
+// ReprintRequestCreate asks for printed sequences to be printed again
+type ReprintRequestCreate struct {
+	Sequences []int  `json:"sequences" validate:"required"`
+	Reason    string `json:"reason" validate:"required"` // spoiled, misprint or lost
+	Note      string `json:"note"`
+	JobType   string `json:"job_type" validate:"required"`
+	PrinterID string `json:"printer_id"`
+}
+
+// ReprintReviewRequest approves or rejects a reprint request. PrinterID
+// overrides the printer chosen when the request was raised.
+type ReprintReviewRequest struct {
+	Note      string `json:"note"`
+	PrinterID string `json:"printer_id"`
+}
@@ -0,0 +1,34 @@
+package printprotocol
+
+// Commands the server sends in a Job
+const (
+	CommandLivePrint     = "live-print"
+	CommandSpecimenPrint = "specimen-print"
+	CommandTestPrint     = "test-print"
+	CommandPong          = "pong"
+)
+
+// Events the client reports
+const (
+	EventPing = "ping"
+
+	EventLivePrintSent         = "live-print-sent-to-printer"
+	EventLivePDFFailed         = "live-pdf-download-failed"
+	EventSpecimenPrintSent     = "specimen-print-sent-to-printer"
+	EventSpecimenPDFFailed     = "specimen-pdf-download-failed"
+	EventPrintFailed           = "print-failed"
+	EventPrintQueueNotAttached = "print-queue-not-attached"
+	EventPrinterSelected       = "printer-selected"
+	EventWeightDimData         = "weight-dim-data"
+
+	// Spooler events of a job
+	EventJobQueued       = "job-queued"
+	EventJobSpooling     = "job-spooling"
+	EventJobPrinting     = "job-printing"
+	EventJobRendering    = "job-rendering"
+	EventJobProgress     = "job-progress"
+	EventJobCompleted    = "job-completed"
+	EventJobFailed       = "job-failed"
+	EventJobPagesPrinted = "job-pages-printed"
+	EventQueueProgress   = "print-queue-progress"
+)
@@ -0,0 +1,3 @@
+module printprotocol
+
+go 1.22
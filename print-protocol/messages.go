@@ -0,0 +1,90 @@
+package printprotocol
+
+// Auth is the first message a client sends on a new connection
+type Auth struct {
+	Type          string `json:"type"`           // TypeAuth
+	Token         string `json:"token"`          // Printer ID derived from the machine's hardware
+	Processor     string `json:"processor"`      // Machine's processor details
+	Platform      string `json:"platform"`       // Machine's platform details (e.g., OS)
+	HardwareID    string `json:"hardware_id"`    // Unique hardware identifier
+	ClientVersion string `json:"client_version"` // Client software version
+	PublicKey     string `json:"public_key"`     // Base64 Ed25519 key the client enrolled with
+
+	ProtocolVersion int `json:"protocol_version"` // Newest protocol the client speaks, 0 if not sent
+}
+
+// Challenge carries the nonce an enrolled client must sign
+type Challenge struct {
+	Type  string `json:"type"` // TypeChallenge
+	Nonce string `json:"nonce"`
+}
+
+// ChallengeResponse is the client's signature over ChallengePayload
+type ChallengeResponse struct {
+	Type      string `json:"type"` // TypeChallengeResponse
+	Signature string `json:"signature"`
+}
+
+// AuthResult ends the handshake. It is sent as TypeEnrollment when the
+// client's key may not be used yet, and as TypeAuthOK with the negotiated
+// protocol version once the session is authenticated.
+type AuthResult struct {
+	Type            string `json:"type"`
+	Status          string `json:"status"`
+	Fingerprint     string `json:"fingerprint"`
+	Message         string `json:"message,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+}
+
+// Job is a command sent by the server to a printer. From protocol 1 it
+// carries the envelope fields and must be acknowledged with a Receipt.
+type Job struct {
+	Type      string `json:"type,omitempty"` // TypeJob
+	Version   int    `json:"v,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+
+	PrinterID string  `json:"printer_id"`
+	JobID     string  `json:"job_id"`
+	JobToken  string  `json:"job_token"`
+	Command   string  `json:"command"` // One of the Command constants
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+	Unit      string  `json:"unit"`
+	Barcode   string  `json:"barcode"`
+	Mashul    string  `json:"mashul"`
+	Weight    string  `json:"weight"`
+
+	// PageSizes, when set, is the paper size of each page of an order in
+	// turn, repeating for every order, for kits whose pages differ in size.
+	// Width and Height are then the largest page, which clients that do not
+	// read PageSizes print every page on.
+	PageSizes []PageSize `json:"page_sizes,omitempty"`
+}
+
+// PageSize is the paper size of one page, in the job's Unit
+type PageSize struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Receipt acknowledges a job (TypeAck) or refuses it with a reason
+// (TypeNack)
+type Receipt struct {
+	Type      string `json:"type"`
+	Version   int    `json:"v"`
+	MessageID string `json:"message_id"`
+	JobID     string `json:"JobId,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Event is a log or job event reported by the client. It has no type
+// field; its Event is one of the Event constants.
+type Event struct {
+	JobID   string `json:"JobId"`
+	Event   string `json:"Event"`
+	Message string `json:"Message"`
+
+	// Page progress, set on EventJobPagesPrinted only
+	PagesPrinted int `json:"PagesPrinted,omitempty"`
+	TotalPages   int `json:"TotalPages,omitempty"`
+}
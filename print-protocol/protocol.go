@@ -0,0 +1,63 @@
+// Package printprotocol defines the messages exchanged between the print
+// server and the cloud print client over their WebSocket, so both sides
+// encode and decode the same shapes.
+package printprotocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Version is the newest protocol version this package describes. Version 0
+// is the original protocol, in which jobs are sent once and never
+// acknowledged; from version 1 every job carries a message ID that the
+// client answers with an ack or a nack.
+const Version = 1
+
+// Message types, sent in the "type" field
+const (
+	TypeAuth              = "auth"
+	TypeChallenge         = "challenge"
+	TypeChallengeResponse = "auth-response"
+	TypeAuthOK            = "auth-ok"
+	TypeEnrollment        = "enrollment"
+	TypeJob               = "job"
+	TypeAck               = "ack"
+	TypeNack              = "nack"
+)
+
+// Negotiate returns the protocol version two sides speaking local and
+// remote use: the highest both understand. A peer that does not send a
+// version speaks version 0.
+func Negotiate(local, remote int) int {
+	if remote < 0 || local < 0 {
+		return 0
+	}
+	if remote < local {
+		return remote
+	}
+	return local
+}
+
+// ChallengePayload is the message a client signs to prove it holds its
+// enrolled key: the protocol label, the printer ID and the server nonce.
+// Binding the printer ID stops a signature from being replayed for another
+// printer.
+func ChallengePayload(printerID, nonce string) []byte {
+	return []byte("postal-ballot-print/auth/v1:" + printerID + ":" + nonce)
+}
+
+// envelope holds the fields common to typed messages
+type envelope struct {
+	Type string `json:"type"`
+}
+
+// PeekType returns the type of an encoded message without decoding the
+// rest of it. Client events have no type and return "".
+func PeekType(data []byte) (string, error) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return "", fmt.Errorf("invalid message: %w", err)
+	}
+	return e.Type, nil
+}
@@ -0,0 +1,192 @@
+package printprotocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// roundTrip encodes v, decodes it into a new value of the same type and
+// returns the encoding and the decoded value
+func roundTrip(t *testing.T, v interface{}) ([]byte, interface{}) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %T: %v", v, err)
+	}
+	decoded := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("unmarshal %T: %v", v, err)
+	}
+	return data, decoded
+}
+
+func TestRoundTrip(t *testing.T) {
+	messages := []interface{}{
+		&Auth{
+			Type:            TypeAuth,
+			Token:           "a1b2c3d4e5f6a7b8c9d",
+			Processor:       "amd64",
+			Platform:        "windows",
+			HardwareID:      "4C4C4544-0042",
+			ClientVersion:   "1.4.0",
+			PublicKey:       "MCowBQYDK2VwAyEA",
+			ProtocolVersion: Version,
+		},
+		&Challenge{Type: TypeChallenge, Nonce: "bm9uY2U="},
+		&ChallengeResponse{Type: TypeChallengeResponse, Signature: "c2lnbmF0dXJl"},
+		&AuthResult{Type: TypeAuthOK, Status: "APPROVED", Fingerprint: "ab12", ProtocolVersion: 1},
+		&AuthResult{Type: TypeEnrollment, Status: "PENDING", Fingerprint: "ab12", Message: "Waiting for approval"},
+		&Job{
+			Type:      TypeJob,
+			Version:   Version,
+			MessageID: "7f3c2a10-0000-4000-8000-000000000001",
+			PrinterID: "a1b2c3d4e5f6a7b8c9d",
+			JobID:     "0b6f4d3e-0000-4000-8000-000000000002",
+			JobToken:  "token",
+			Command:   CommandLivePrint,
+			Width:     9.5,
+			Height:    4.125,
+			Unit:      "inch",
+		},
+		&Job{
+			Type:      TypeJob,
+			Version:   Version,
+			MessageID: "7f3c2a10-0000-4000-8000-000000000003",
+			JobID:     "0b6f4d3e-0000-4000-8000-000000000004",
+			Command:   CommandLivePrint,
+			Width:     9.5,
+			Height:    11,
+			Unit:      "inch",
+			PageSizes: []PageSize{{Width: 9.5, Height: 4.125}, {Width: 8.5, Height: 11}},
+		},
+		&Receipt{Type: TypeAck, Version: Version, MessageID: "7f3c", JobID: "0b6f"},
+		&Receipt{Type: TypeNack, Version: Version, MessageID: "7f3c", Reason: "unknown command"},
+		&Event{JobID: "0b6f", Event: EventJobPagesPrinted, Message: "12 of 40 pages", PagesPrinted: 12, TotalPages: 40},
+	}
+
+	for _, message := range messages {
+		_, decoded := roundTrip(t, message)
+		if !reflect.DeepEqual(message, decoded) {
+			t.Errorf("%T changed in round trip:\n got  %+v\n want %+v", message, decoded, message)
+		}
+	}
+}
+
+// The wire names are fixed by deployed clients and servers
+func TestWireNames(t *testing.T) {
+	tests := []struct {
+		message interface{}
+		want    []string
+	}{
+		{&Auth{}, []string{`"type"`, `"token"`, `"hardware_id"`, `"client_version"`, `"public_key"`, `"protocol_version"`}},
+		{&Job{Type: TypeJob, Version: 1, MessageID: "m"}, []string{`"type":"job"`, `"v":1`, `"message_id":"m"`, `"job_id"`, `"job_token"`, `"command"`}},
+		{&Receipt{}, []string{`"type"`, `"v"`, `"message_id"`}},
+		{&Event{JobID: "j"}, []string{`"JobId":"j"`, `"Event"`, `"Message"`}},
+	}
+
+	for _, tt := range tests {
+		data, _ := roundTrip(t, tt.message)
+		for _, name := range tt.want {
+			if !strings.Contains(string(data), name) {
+				t.Errorf("%T encoding %s lacks %s", tt.message, data, name)
+			}
+		}
+	}
+}
+
+// A protocol 0 job has no envelope fields, so old clients see the message
+// they always have
+func TestLegacyJobHasNoEnvelope(t *testing.T) {
+	data, err := json.Marshal(Job{JobID: "j", Command: CommandLivePrint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{`"type"`, `"v"`, `"message_id"`} {
+		if strings.Contains(string(data), name) {
+			t.Errorf("legacy job %s has %s", data, name)
+		}
+	}
+}
+
+func TestPeekType(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{`{"type":"ack","v":1,"message_id":"m"}`, TypeAck, false},
+		{`{"type":"auth-response","signature":"s"}`, TypeChallengeResponse, false},
+		{`{"JobId":"j","Event":"ping","Message":"ping"}`, "", false},
+		{`not json`, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := PeekType([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PeekType(%s) error = %v, want error %v", tt.data, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("PeekType(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		local, remote, want int
+	}{
+		{1, 1, 1},
+		{1, 0, 0},
+		{1, 2, 1},
+		{2, 1, 1},
+		{1, -1, 0},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.local, tt.remote); got != tt.want {
+			t.Errorf("Negotiate(%d, %d) = %d, want %d", tt.local, tt.remote, got, tt.want)
+		}
+	}
+}
+
+// A handshake as each side sees it: the client's auth carries its version
+// and the server's auth-ok the negotiated one
+func TestHandshake(t *testing.T) {
+	authData, _ := json.Marshal(Auth{Type: TypeAuth, Token: "p", ProtocolVersion: Version + 1})
+
+	var auth Auth
+	if err := json.Unmarshal(authData, &auth); err != nil {
+		t.Fatal(err)
+	}
+	okData, _ := json.Marshal(AuthResult{Type: TypeAuthOK, Status: "APPROVED", ProtocolVersion: Negotiate(Version, auth.ProtocolVersion)})
+
+	typ, err := PeekType(okData)
+	if err != nil || typ != TypeAuthOK {
+		t.Fatalf("PeekType(auth-ok) = %q, %v", typ, err)
+	}
+	var result AuthResult
+	if err := json.Unmarshal(okData, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.ProtocolVersion != Version {
+		t.Errorf("negotiated version = %d, want %d", result.ProtocolVersion, Version)
+	}
+
+	// A client that sends no version speaks protocol 0
+	var legacy Auth
+	if err := json.Unmarshal([]byte(`{"type":"auth","token":"p"}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if got := Negotiate(Version, legacy.ProtocolVersion); got != 0 {
+		t.Errorf("legacy client negotiated %d, want 0", got)
+	}
+}
+
+func TestChallengePayload(t *testing.T) {
+	got := string(ChallengePayload("printer", "nonce"))
+	if want := "postal-ballot-print/auth/v1:printer:nonce"; got != want {
+		t.Errorf("ChallengePayload = %q, want %q", got, want)
+	}
+}